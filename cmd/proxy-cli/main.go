@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/wolfeidau/website-openid-proxy/internal/app"
+	"github.com/wolfeidau/website-openid-proxy/internal/cli"
+	"golang.org/x/oauth2"
+)
+
+var flags struct {
+	Version    kong.VersionFlag `help:"Print the version and exit."`
+	AuthPrefix string           `help:"The path prefix for the authentication routes of the site." default:"/auth"`
+	Cache      string           `help:"The file tokens are cached in, defaults to proxy-cli/tokens.json in the user config directory." type:"path"`
+	Timeout    time.Duration    `help:"How long to wait for requests to the site." default:"30s"`
+
+	Login struct {
+		Site     string `arg:"" help:"The URL of the site."`
+		Loopback bool   `help:"Login in a browser on this machine rather than approving a code on another device."`
+	} `cmd:"" help:"Login to a site and cache the token."`
+
+	Get struct {
+		URL    string `arg:"" help:"The URL of the file to download."`
+		Output string `short:"o" help:"Write the file to this path rather than stdout." type:"path"`
+	} `cmd:"" help:"Download a file from a site using the cached token."`
+
+	Token struct {
+		Site string `arg:"" help:"The URL of the site."`
+	} `cmd:"" help:"Print a bearer token for the site, for use with tools such as curl."`
+
+	Logout struct {
+		Site string `arg:"" help:"The URL of the site."`
+	} `cmd:"" help:"Remove the cached token for a site."`
+}
+
+func main() {
+	ctx := kong.Parse(&flags,
+		kong.Name("proxy-cli"),
+		kong.Description("Login to sites protected by website-openid-proxy and download files."),
+		kong.Vars{"version": fmt.Sprintf("%s_%s", app.Commit, app.BuildDate)},
+	)
+
+	if flags.Cache == "" {
+		path, err := cli.DefaultCachePath()
+		ctx.FatalIfErrorf(err)
+		flags.Cache = path
+	}
+
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cache := &cli.TokenCache{Path: flags.Cache}
+	client := &http.Client{Timeout: flags.Timeout}
+
+	var err error
+
+	switch ctx.Command() {
+	case "login <site>":
+		err = login(sigCtx, client, cache)
+	case "get <url>":
+		err = get(sigCtx, client, cache)
+	case "token <site>":
+		err = token(sigCtx, client, cache)
+	case "logout <site>":
+		err = logout(cache)
+	}
+
+	ctx.FatalIfErrorf(err)
+}
+
+func login(ctx context.Context, client *http.Client, cache *cli.TokenCache) error {
+	site, err := cli.SiteKey(flags.Login.Site)
+	if err != nil {
+		return err
+	}
+
+	d, err := cli.Discover(ctx, client, site, flags.AuthPrefix)
+	if err != nil {
+		return err
+	}
+
+	var tok *oauth2.Token
+
+	if !flags.Login.Loopback {
+		// the device flow polls for longer than a single request
+		tok, err = cli.DeviceLogin(ctx, client, d, func(auth *cli.DeviceAuthorization) {
+			fmt.Fprintf(os.Stderr, "To login visit %s and enter the code %s\n", auth.VerificationURI, auth.UserCode)
+			if auth.VerificationURIComplete != "" {
+				fmt.Fprintf(os.Stderr, "or visit %s\n", auth.VerificationURIComplete)
+			}
+		})
+	}
+
+	if flags.Login.Loopback || errors.Is(err, cli.ErrDeviceNotSupported) {
+		tok, err = cli.LoopbackLogin(ctx, client, d, func(authURL string) {
+			fmt.Fprintf(os.Stderr, "To login visit %s\n", authURL)
+			openBrowser(authURL)
+		})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	cached, err := cli.NewToken(d, tok)
+	if err != nil {
+		return err
+	}
+
+	err = cache.Put(site, cached)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Logged in to %s until %s\n", site, cached.Expiry.Format(time.RFC1123))
+
+	return nil
+}
+
+func get(ctx context.Context, client *http.Client, cache *cli.TokenCache) error {
+	site, err := cli.SiteKey(flags.Get.URL)
+	if err != nil {
+		return err
+	}
+
+	bearer, err := cache.BearerToken(ctx, client, site)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, flags.Get.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+bearer)
+
+	// downloads can take longer than the request timeout, large files are redirected to s3
+	res, err := (&http.Client{}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s: %s", flags.Get.URL, res.Status)
+	}
+
+	var w io.Writer = os.Stdout
+
+	if flags.Get.Output != "" {
+		f, err := os.Create(flags.Get.Output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		w = f
+	}
+
+	_, err = io.Copy(w, res.Body)
+
+	return err
+}
+
+func token(ctx context.Context, client *http.Client, cache *cli.TokenCache) error {
+	site, err := cli.SiteKey(flags.Token.Site)
+	if err != nil {
+		return err
+	}
+
+	bearer, err := cache.BearerToken(ctx, client, site)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(bearer)
+
+	return nil
+}
+
+func logout(cache *cli.TokenCache) error {
+	site, err := cli.SiteKey(flags.Logout.Site)
+	if err != nil {
+		return err
+	}
+
+	return cache.Delete(site)
+}
+
+// openBrowser tries to open the URL in the user's browser, the URL has already been printed if this fails
+func openBrowser(u string) {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", u)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	default:
+		cmd = exec.Command("xdg-open", u)
+	}
+
+	_ = cmd.Start()
+}
@@ -1,40 +1,81 @@
 package main
 
 import (
-	"context"
 	"fmt"
 
 	"github.com/alecthomas/kong"
-	"github.com/apex/gateway/v2"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/coreos/go-oidc"
 	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog/log"
-	s3middleware "github.com/wolfeidau/echo-s3-middleware"
 	lmw "github.com/wolfeidau/lambda-go-extras/middleware"
 	"github.com/wolfeidau/lambda-go-extras/middleware/raw"
 	zlog "github.com/wolfeidau/lambda-go-extras/middleware/zerolog"
 	"github.com/wolfeidau/website-openid-proxy/internal/app"
+	"github.com/wolfeidau/website-openid-proxy/internal/audit"
+	"github.com/wolfeidau/website-openid-proxy/internal/content"
 	"github.com/wolfeidau/website-openid-proxy/internal/flags"
+	"github.com/wolfeidau/website-openid-proxy/internal/gateway"
+	"github.com/wolfeidau/website-openid-proxy/internal/ratelimit"
+	"github.com/wolfeidau/website-openid-proxy/internal/registry"
 	"github.com/wolfeidau/website-openid-proxy/internal/secrets"
 	"github.com/wolfeidau/website-openid-proxy/internal/server"
 	"github.com/wolfeidau/website-openid-proxy/internal/session"
+	"github.com/wolfeidau/website-openid-proxy/internal/ticket"
+	"github.com/wolfeidau/website-openid-proxy/internal/tokens"
 )
 
-var cfg = new(flags.API)
+var cli struct {
+	flags.API
+
+	Serve  struct{} `cmd:"" default:"1" help:"Serve the website, this is the default command."`
+	Config struct {
+		Check struct{} `cmd:"" help:"Validate the configuration and report any errors."`
+		Dump  struct{} `cmd:"" help:"Print the effective configuration with secrets redacted."`
+	} `cmd:"" help:"Configuration related commands."`
+}
 
 func main() {
-	kong.Parse(cfg,
+	ctx := kong.Parse(&cli,
 		kong.Vars{"version": fmt.Sprintf("%s_%s", app.Commit, app.BuildDate)}, // bind a var for version
+		flags.Configuration(),
 	)
 
+	cfg := &cli.API
+
+	if err := cfg.LoadConfigFile(); err != nil {
+		log.Fatal().Err(err).Msg("config load failed")
+	}
+
+	switch ctx.Command() {
+	case "config check":
+		if err := cfg.Valid(); err != nil {
+			ctx.Fatalf("config validation failed: %s", err)
+		}
+		fmt.Fprintln(ctx.Stdout, "config is valid")
+		return
+	case "config dump":
+		ctx.FatalIfErrorf(cfg.Dump(ctx, ctx.Stdout))
+		return
+	}
+
 	if err := cfg.Valid(); err != nil {
 		log.Fatal().Err(err).Msg("config validation failed")
 	}
 
+	serve(cfg)
+}
+
+func serve(cfg *flags.API) {
 	e := echo.New()
 
+	// the client IP is the source IP seen by API Gateway, X-Forwarded-For can be set by the client
+	e.IPExtractor = ratelimit.SourceIP
+
+	// security headers are added to the auth routes as well as the content
+	e.Use(server.SecurityHeaders(cfg.SecurityHeaders))
+
 	secretCache := secrets.NewCache(&aws.Config{})
 
 	// session middleware is available everwhere
@@ -45,32 +86,104 @@ func main() {
 
 	e.Use(sessionMiddleware)
 
-	agr := e.Group("/auth")
+	rules, userRules, err := server.RateLimitRules(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("rate limit config failed")
+	}
+
+	var rateLimitStore ratelimit.Store = ratelimit.NewMemoryStore()
+
+	if cfg.RateLimitStore == "dynamodb" {
+		rateLimitStore = ratelimit.NewDynamoDBStore(&aws.Config{}, cfg.RateLimitTable)
+	}
+
+	if len(rules) > 0 {
+		e.Use(ratelimit.MiddlewareWithConfig(ratelimit.Config{
+			Store: rateLimitStore,
+			Rules: rules,
+		}))
+	}
+
+	agr := e.Group(cfg.AuthPrefix)
+
+	sites := server.NewSiteRouter(buildSites(cfg))
+
+	opts := []server.AuthOption{server.WithSites(sites)}
+
+	if cfg.SSOEnabled() {
+		ticketSecret, err := secretCache.GetValue(cfg.TicketSecretArn)
+		if err != nil {
+			log.Fatal().Err(err).Msg("ticket secret load failed")
+		}
+
+		opts = append(opts, server.WithTicketCodec(ticket.NewCodec([]byte(ticketSecret), cfg.TicketTTL)))
+	}
+
+	if cfg.TokensEnabled() {
+		var store tokens.Store = tokens.NewMemoryStore()
+
+		if cfg.TokenStore == "dynamodb" {
+			store = tokens.NewDynamoDBStore(&aws.Config{}, cfg.TokenTable)
+		}
+
+		opts = append(opts, server.WithTokenStore(store))
+	}
+
+	var sessionRegistry registry.Store
+
+	if cfg.SessionRegistryEnabled() {
+		sessionRegistry = registry.NewMemoryStore()
+
+		if cfg.SessionStore == "dynamodb" {
+			sessionRegistry = registry.NewDynamoDBStore(&aws.Config{}, cfg.SessionTable)
+		}
+
+		opts = append(opts, server.WithSessionRegistry(sessionRegistry))
+	}
+
+	if cfg.AuditHistory > 0 {
+		opts = append(opts, server.WithAuditHistory(audit.NewHistory(cfg.AuditHistory)))
+	}
 
-	login, err := server.NewAuth(cfg, oidc.NewProvider)
+	login, err := server.NewAuth(cfg, oidc.NewProvider, opts...)
 	if err != nil {
 		log.Fatal().Err(err).Msg("auth config failed")
 	}
 
 	login.RegisterRoutes(agr)
 
-	fs := s3middleware.New(s3middleware.FilesConfig{
-		SPA:     true,
-		Index:   "index.html",
-		Skipper: server.LoginSkipper("/auth"),
-		Summary: func(ctx context.Context, data map[string]interface{}) {
-			log.Ctx(ctx).Info().Fields(data).Msg("processed s3 request")
-		},
-		OnErr: func(ctx context.Context, err error) {
-			log.Ctx(ctx).Error().Err(err).Msgf("failed to process s3 request")
-		},
-	})
+	e.Use(sites.Middleware(server.LoginSkipper(cfg.AuthPrefix)))
 
-	e.Use(server.CheckAuthWithConfig(server.Config{
-		Skipper: server.LoginSkipper("/auth"),
-	}))
+	authConfig := server.Config{
+		Skipper:  server.LoginSkipper(cfg.AuthPrefix),
+		LoginURL: cfg.AuthPrefix + "/login",
 
-	e.Use(fs.StaticBucket(cfg.WebsiteBucket))
+		IdleTimeout: cfg.SessionIdleTimeout,
+		Registry:    sessionRegistry,
+	}
+
+	// personal access tokens and id tokens from proxy-cli are accepted as bearer tokens
+	if cfg.CLIClientID != "" || cfg.TokensEnabled() {
+		authConfig.Bearer = login.VerifyBearer
+	}
+
+	e.Use(server.CheckAuthWithConfig(authConfig))
+
+	// the user limit is checked once the user of a bearer token is known
+	if len(userRules) > 0 {
+		e.Use(ratelimit.MiddlewareWithConfig(ratelimit.Config{
+			Store: rateLimitStore,
+			Rules: userRules,
+		}))
+	}
+
+	if cfg.Compression {
+		e.Use(content.CompressWithConfig(content.CompressConfig{
+			MinLength: cfg.CompressMinSize,
+		}))
+	}
+
+	e.Use(sites.Content())
 
 	gw := gateway.NewGateway(e)
 
@@ -88,3 +201,105 @@ func main() {
 
 	lambda.StartWithOptions(h)
 }
+
+// buildSites creates the content middleware for each site, sites sharing a bucket also share the object cache.
+func buildSites(cfg *flags.API) []*server.Site {
+	buckets := make(map[string]*content.Bucket)
+	stores := make(map[string]content.Store)
+
+	// HTML documents are only rewritten when needed as they are buffered and lose their validators, the injected
+	// script is added before the nonce so it is allowed by the content security policy
+	var rewrite []content.Rewriter
+	if cfg.Inject.Enabled() {
+		rewrite = append(rewrite, server.InjectRewriter(cfg.Inject))
+	}
+	if server.NonceEnabled(cfg.SecurityHeaders) {
+		rewrite = append(rewrite, server.NonceRewriter)
+	}
+
+	var sites []*server.Site
+
+	for _, sc := range cfg.SiteConfigs() {
+		bucket, ok := buckets[sc.Bucket]
+		if !ok {
+			bucket = content.NewBucket(&aws.Config{}, sc.Bucket)
+			buckets[sc.Bucket] = bucket
+
+			stores[sc.Bucket] = bucket
+
+			// warm containers keep small objects in memory
+			if cfg.ObjectCacheSize > 0 {
+				stores[sc.Bucket] = content.NewCache(bucket, content.CacheConfig{
+					MaxBytes:      cfg.ObjectCacheSize,
+					MaxObjectSize: cfg.ObjectCacheMaxObject,
+					TTL:           cfg.ObjectCacheTTL,
+					Exclude:       cfg.ObjectCacheExclude,
+				})
+			}
+		}
+
+		contentConfig := content.Config{
+			Store:         stores[sc.Bucket],
+			SPA:           sc.SPA,
+			Index:         sc.Index,
+			PathPrefix:    sc.PathPrefix,
+			KeyPrefix:     sc.KeyPrefix,
+			CachePolicies: cfg.CachePolicies,
+
+			SPAPaths:         sc.SPAPaths,
+			SPAExtensionless: sc.SPAExtensionless,
+			NotFound:         sc.NotFound,
+			TrailingSlash:    sc.TrailingSlash,
+			CleanURLs:        sc.CleanURLs,
+
+			Presigner:       bucket,
+			LargeObjectSize: cfg.LargeObjectSize,
+			PresignTTL:      cfg.PresignTTL,
+
+			Rewrite:       rewrite,
+			Precompressed: cfg.Precompressed,
+		}
+
+		site := &server.Site{Site: sc, Presigner: bucket}
+
+		if sc.DirectoryListing || sc.Preview != "" {
+			contentConfig.DirectoryListing = sc.DirectoryListing
+			contentConfig.Lister = bucket
+			contentConfig.ListFilter = server.AuthorizeFilter(sc.Policies)
+		}
+
+		if sc.Preview != "" {
+			contentConfig.Preview = site.PreviewPrefix
+			contentConfig.PreviewURL = site.PreviewURL
+		}
+
+		site.Content = content.MiddlewareWithConfig(contentConfig)
+
+		// rules are evaluated after auth so a rewrite is checked against the site policies
+		if len(sc.Redirects) > 0 || sc.RedirectsKey != "" {
+			rulesConfig := content.RulesConfig{
+				Rules:      sc.Redirects,
+				PathPrefix: sc.PathPrefix,
+				Authorize:  server.RewriteFilter(sc.Policies, sc.PublicPaths),
+			}
+
+			if sc.RedirectsKey != "" {
+				rulesConfig.Store = bucket
+				rulesConfig.Key = sc.KeyPrefix + sc.RedirectsKey
+			}
+
+			site.Content = chain(content.RulesWithConfig(rulesConfig), site.Content)
+		}
+
+		sites = append(sites, site)
+	}
+
+	return sites
+}
+
+// chain returns a middleware which runs the middleware in order
+func chain(first, second echo.MiddlewareFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return first(second(next))
+	}
+}
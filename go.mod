@@ -4,27 +4,28 @@ go 1.19
 
 require (
 	github.com/alecthomas/kong v0.7.1
+	github.com/andybalholm/brotli v1.0.5
 	github.com/apex/gateway/v2 v2.0.0
 	github.com/aws/aws-lambda-go v1.37.0
 	github.com/aws/aws-sdk-go v1.44.209
 	github.com/coreos/go-oidc v2.2.1+incompatible
 	github.com/dghubble/sessions v0.4.0
 	github.com/golang/mock v1.6.0
+	github.com/gorilla/securecookie v1.1.1
 	github.com/labstack/echo/v4 v4.10.2
 	github.com/rs/zerolog v1.29.0
 	github.com/stretchr/testify v1.8.1
-	github.com/wolfeidau/echo-s3-middleware v1.2.1-0.20210114095551-db494251c0ef
 	github.com/wolfeidau/lambda-go-extras v1.5.0
 	github.com/wolfeidau/lambda-go-extras/middleware/raw v1.5.0
 	github.com/wolfeidau/lambda-go-extras/middleware/zerolog v1.5.0
 	golang.org/x/oauth2 v0.5.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/golang-jwt/jwt v3.2.2+incompatible // indirect
 	github.com/golang/protobuf v1.5.2 // indirect
-	github.com/gorilla/securecookie v1.1.1 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
 	github.com/labstack/gommon v0.4.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
@@ -41,6 +42,7 @@ require (
 	golang.org/x/time v0.3.0 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
 	google.golang.org/protobuf v1.28.1 // indirect
+	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 	gopkg.in/square/go-jose.v2 v2.6.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -0,0 +1,122 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Event a security related action taken by or on behalf of a user
+type Event struct {
+	// Action such as login, logout or share.
+	Action string `json:"action"`
+
+	// Subject and Email of the user who took the action.
+	Subject string `json:"sub"`
+	Email   string `json:"email"`
+
+	// Path the action applies to, if any.
+	Path string `json:"path,omitempty"`
+
+	// Allowed is false when the action was denied.
+	Allowed bool `json:"allowed"`
+
+	// Fields with additional details about the action.
+	Fields map[string]interface{} `json:"fields,omitempty"`
+
+	// Time the event was recorded, this is set by the History.
+	Time time.Time `json:"time"`
+}
+
+// Logger records audit events
+type Logger interface {
+	Record(ctx context.Context, evt Event)
+}
+
+// LoggerFunc is an adapter to allow the use of ordinary functions as a Logger
+type LoggerFunc func(ctx context.Context, evt Event)
+
+// Record calls f(ctx, evt)
+func (f LoggerFunc) Record(ctx context.Context, evt Event) {
+	f(ctx, evt)
+}
+
+// NewLogger returns a logger which writes events to the request logger, each event has the audit field
+// set to the action so they can be filtered from other log messages.
+func NewLogger() Logger {
+	return LoggerFunc(func(ctx context.Context, evt Event) {
+		log.Ctx(ctx).Info().
+			Str("audit", evt.Action).
+			Str("sub", evt.Subject).
+			Str("email", evt.Email).
+			Str("path", evt.Path).
+			Bool("allowed", evt.Allowed).
+			Fields(evt.Fields).
+			Msg("audit event")
+	})
+}
+
+// Multi returns a logger which records events with each of the loggers
+func Multi(loggers ...Logger) Logger {
+	return LoggerFunc(func(ctx context.Context, evt Event) {
+		for _, l := range loggers {
+			l.Record(ctx, evt)
+		}
+	})
+}
+
+// History keeps the most recent events in memory so they can be shown to admins, this is only the events
+// recorded by the current process.
+type History struct {
+	mu     sync.Mutex
+	events []Event
+	next   int
+	full   bool
+}
+
+// NewHistory create a history which keeps the number of events
+func NewHistory(size int) *History {
+	return &History{events: make([]Event, size)}
+}
+
+// Record adds the event to the history, replacing the oldest event once it is full
+func (h *History) Record(ctx context.Context, evt Event) {
+	if len(h.events) == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if evt.Time.IsZero() {
+		evt.Time = time.Now()
+	}
+
+	h.events[h.next] = evt
+	h.next = (h.next + 1) % len(h.events)
+
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Events returns the events in the history, most recent first
+func (h *History) Events() []Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	count := h.next
+	if h.full {
+		count = len(h.events)
+	}
+
+	events := make([]Event, 0, count)
+
+	for i := 1; i <= count; i++ {
+		events = append(events, h.events[(h.next-i+len(h.events))%len(h.events)])
+	}
+
+	return events
+}
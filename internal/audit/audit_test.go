@@ -0,0 +1,34 @@
+package audit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	assert := require.New(t)
+
+	h := NewHistory(3)
+	assert.Empty(h.Events())
+
+	var actions []string
+
+	logger := Multi(h, LoggerFunc(func(ctx context.Context, evt Event) {
+		actions = append(actions, evt.Action)
+	}))
+
+	for _, action := range []string{"login", "share", "logout", "login"} {
+		logger.Record(context.TODO(), Event{Action: action})
+	}
+
+	assert.Equal([]string{"login", "share", "logout", "login"}, actions)
+
+	events := h.Events()
+	assert.Len(events, 3)
+	assert.Equal("login", events[0].Action)
+	assert.Equal("logout", events[1].Action)
+	assert.Equal("share", events[2].Action)
+	assert.False(events[0].Time.IsZero())
+}
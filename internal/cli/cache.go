@@ -0,0 +1,244 @@
+package cli
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// expiryLeeway tokens are refreshed this long before they expire so they aren't rejected in flight
+const expiryLeeway = 30 * time.Second
+
+// ErrNotLoggedIn returned when the cache doesn't have a token for the site
+var ErrNotLoggedIn = errors.New("not logged in, run proxy-cli login first")
+
+// Token the id token used as a bearer token for a site along with what is needed to refresh it
+type Token struct {
+	Issuer       string    `json:"issuer"`
+	ClientID     string    `json:"client_id"`
+	TokenURL     string    `json:"token_url"`
+	IDToken      string    `json:"id_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// NewToken returns the token to cache from the tokens issued by the openid provider
+func NewToken(d *Discovery, tok *oauth2.Token) (*Token, error) {
+	idToken, _ := tok.Extra("id_token").(string)
+	if idToken == "" {
+		return nil, errors.New("openid provider didn't issue an id token")
+	}
+
+	expiry, err := tokenExpiry(idToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Token{
+		Issuer:       d.Issuer,
+		ClientID:     d.ClientID,
+		TokenURL:     d.Endpoint.TokenURL,
+		IDToken:      idToken,
+		RefreshToken: tok.RefreshToken,
+		Expiry:       expiry,
+	}, nil
+}
+
+// Valid returns true if the id token hasn't expired
+func (t *Token) Valid(now time.Time) bool {
+	return now.Add(expiryLeeway).Before(t.Expiry)
+}
+
+// Refresh uses the refresh token to get a new id token
+func (t *Token) Refresh(ctx context.Context, client *http.Client) (*Token, error) {
+	if t.RefreshToken == "" {
+		return nil, errors.New("token expired, run proxy-cli login again")
+	}
+
+	conf := &oauth2.Config{ClientID: t.ClientID, Endpoint: oauth2.Endpoint{TokenURL: t.TokenURL}}
+
+	// the expired access token forces a refresh
+	tok, err := conf.TokenSource(context.WithValue(ctx, oauth2.HTTPClient, client), &oauth2.Token{
+		RefreshToken: t.RefreshToken,
+		Expiry:       time.Unix(1, 0),
+	}).Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token, run proxy-cli login again: %w", err)
+	}
+
+	refreshed, err := NewToken(&Discovery{Issuer: t.Issuer, ClientID: t.ClientID, Endpoint: conf.Endpoint}, tok)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token, run proxy-cli login again: %w", err)
+	}
+
+	// providers which don't rotate refresh tokens omit them
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = t.RefreshToken
+	}
+
+	return refreshed, nil
+}
+
+// TokenCache stores the tokens of each site in a file readable only by the user
+type TokenCache struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// DefaultCachePath returns the path of the token cache in the user's config directory
+func DefaultCachePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "proxy-cli", "tokens.json"), nil
+}
+
+// Get returns the token for the site
+func (tc *TokenCache) Get(site string) (*Token, error) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tokens, err := tc.read()
+	if err != nil {
+		return nil, err
+	}
+
+	tok, ok := tokens[site]
+	if !ok {
+		return nil, ErrNotLoggedIn
+	}
+
+	return tok, nil
+}
+
+// Put stores the token for the site
+func (tc *TokenCache) Put(site string, tok *Token) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tokens, err := tc.read()
+	if err != nil {
+		return err
+	}
+
+	tokens[site] = tok
+
+	return tc.write(tokens)
+}
+
+// Delete removes the token for the site
+func (tc *TokenCache) Delete(site string) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tokens, err := tc.read()
+	if err != nil {
+		return err
+	}
+
+	delete(tokens, site)
+
+	return tc.write(tokens)
+}
+
+// BearerToken returns a current id token for the site, refreshing and caching it if it has expired
+func (tc *TokenCache) BearerToken(ctx context.Context, client *http.Client, site string) (string, error) {
+	tok, err := tc.Get(site)
+	if err != nil {
+		return "", err
+	}
+
+	if tok.Valid(time.Now()) {
+		return tok.IDToken, nil
+	}
+
+	tok, err = tok.Refresh(ctx, client)
+	if err != nil {
+		return "", err
+	}
+
+	err = tc.Put(site, tok)
+	if err != nil {
+		return "", err
+	}
+
+	return tok.IDToken, nil
+}
+
+func (tc *TokenCache) read() (map[string]*Token, error) {
+	tokens := make(map[string]*Token)
+
+	data, err := os.ReadFile(tc.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token cache: %w", err)
+	}
+
+	err = json.Unmarshal(data, &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token cache: %w", err)
+	}
+
+	return tokens, nil
+}
+
+func (tc *TokenCache) write(tokens map[string]*Token) error {
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(tc.Path), 0o700)
+	if err != nil {
+		return fmt.Errorf("failed to create token cache: %w", err)
+	}
+
+	// write a new file and rename it so a failed write doesn't lose the other tokens
+	tmp := tc.Path + ".tmp"
+
+	err = os.WriteFile(tmp, data, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write token cache: %w", err)
+	}
+
+	return os.Rename(tmp, tc.Path)
+}
+
+// tokenExpiry reads the expiry of the id token, the token is verified by the proxy so it isn't verified here
+func tokenExpiry(idToken string) (time.Time, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("invalid id token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+
+	err = json.Unmarshal(payload, &claims)
+	if err != nil || claims.Exp == 0 {
+		return time.Time{}, errors.New("invalid id token missing exp")
+	}
+
+	return time.Unix(claims.Exp, 0), nil
+}
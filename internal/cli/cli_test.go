@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// fakeIDToken returns an unsigned token with the expiry, the cli doesn't verify tokens
+func fakeIDToken(exp time.Time) string {
+	payload, _ := json.Marshal(map[string]interface{}{"sub": "abc123", "exp": exp.Unix()})
+	return "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+}
+
+func newProvider(t *testing.T, pending int) *httptest.Server {
+	mux := http.NewServeMux()
+
+	var srv *httptest.Server
+
+	mux.HandleFunc("/auth/cli", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"issuer": srv.URL, "client_id": "cli", "scopes": []string{"openid", "email"}})
+	})
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                        srv.URL,
+			"authorization_endpoint":        srv.URL + "/authorize",
+			"token_endpoint":                srv.URL + "/token",
+			"device_authorization_endpoint": srv.URL + "/device",
+			"jwks_uri":                      srv.URL + "/keys",
+			"scopes_supported":              []string{"openid", "email", "offline_access"},
+		})
+	})
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "openid email offline_access", r.FormValue("scope"))
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"device_code": "device123", "user_code": "ABCD-EFGH", "verification_uri": srv.URL + "/activate", "expires_in": 60, "interval": 1,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.FormValue("grant_type") == "refresh_token" {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "access", "id_token": fakeIDToken(time.Now().Add(2 * time.Hour)), "expires_in": 3600})
+			return
+		}
+
+		require.Equal(t, "device123", r.FormValue("device_code"))
+
+		if pending > 0 {
+			pending--
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "authorization_pending"})
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access", "refresh_token": "refresh", "id_token": fakeIDToken(time.Now().Add(time.Hour)), "expires_in": 3600,
+		})
+	})
+
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestDeviceLogin(t *testing.T) {
+	assert := require.New(t)
+
+	srv := newProvider(t, 1)
+
+	d, err := Discover(context.Background(), srv.Client(), srv.URL+"/docs/", "/auth")
+	assert.NoError(err)
+	assert.Equal("cli", d.ClientID)
+	assert.Equal(srv.URL+"/device", d.DeviceAuthorizationEndpoint)
+	assert.Equal([]string{"openid", "email", "offline_access"}, d.Scopes)
+
+	var prompted *DeviceAuthorization
+
+	tok, err := DeviceLogin(context.Background(), srv.Client(), d, func(auth *DeviceAuthorization) {
+		prompted = auth
+	})
+	assert.NoError(err)
+	assert.Equal("ABCD-EFGH", prompted.UserCode)
+	assert.Equal("refresh", tok.RefreshToken)
+
+	cached, err := NewToken(d, tok)
+	assert.NoError(err)
+	assert.True(cached.Valid(time.Now()))
+	assert.False(cached.Valid(time.Now().Add(time.Hour)))
+}
+
+func TestDeviceLogin_NotSupported(t *testing.T) {
+	_, err := DeviceLogin(context.Background(), http.DefaultClient, &Discovery{}, func(*DeviceAuthorization) {})
+	require.ErrorIs(t, err, ErrDeviceNotSupported)
+}
+
+func TestTokenCache(t *testing.T) {
+	assert := require.New(t)
+
+	srv := newProvider(t, 0)
+
+	cache := &TokenCache{Path: filepath.Join(t.TempDir(), "proxy-cli", "tokens.json")}
+
+	_, err := cache.BearerToken(context.Background(), srv.Client(), "https://docs.example.com")
+	assert.ErrorIs(err, ErrNotLoggedIn)
+
+	expired := &Token{
+		ClientID:     "cli",
+		TokenURL:     srv.URL + "/token",
+		IDToken:      fakeIDToken(time.Now().Add(-time.Minute)),
+		RefreshToken: "refresh",
+		Expiry:       time.Now().Add(-time.Minute),
+	}
+
+	assert.NoError(cache.Put("https://docs.example.com", expired))
+
+	bearer, err := cache.BearerToken(context.Background(), srv.Client(), "https://docs.example.com")
+	assert.NoError(err)
+	assert.NotEqual(expired.IDToken, bearer)
+
+	tok, err := cache.Get("https://docs.example.com")
+	assert.NoError(err)
+	assert.Equal(bearer, tok.IDToken)
+	assert.Equal("refresh", tok.RefreshToken)
+	assert.True(tok.Valid(time.Now()))
+
+	assert.NoError(cache.Delete("https://docs.example.com"))
+
+	_, err = cache.Get("https://docs.example.com")
+	assert.ErrorIs(err, ErrNotLoggedIn)
+}
+
+func TestNewToken(t *testing.T) {
+	assert := require.New(t)
+
+	_, err := NewToken(&Discovery{}, &oauth2.Token{AccessToken: "access"})
+	assert.EqualError(err, "openid provider didn't issue an id token")
+
+	_, err = NewToken(&Discovery{}, (&oauth2.Token{}).WithExtra(map[string]interface{}{"id_token": "invalid"}))
+	assert.EqualError(err, "invalid id token")
+}
+
+func TestSiteKey(t *testing.T) {
+	assert := require.New(t)
+
+	site, err := SiteKey("https://docs.example.com/guide/install.html?v=1")
+	assert.NoError(err)
+	assert.Equal("https://docs.example.com", site)
+
+	_, err = SiteKey("docs.example.com")
+	assert.EqualError(err, fmt.Sprintf("invalid site url %q must be an absolute http or https url", "docs.example.com"))
+}
@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+	defaultPollInterval = 5 * time.Second
+	slowDownInterval    = 5 * time.Second
+)
+
+// ErrDeviceNotSupported returned when the openid provider doesn't support the device authorization grant
+var ErrDeviceNotSupported = errors.New("openid provider doesn't support the device authorization grant")
+
+// DeviceAuthorization the code the user enters on another device to approve the login
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+
+	// VerificationURL is used by some providers instead of VerificationURI
+	VerificationURL string `json:"verification_url"`
+}
+
+// tokenResponse the response of the token endpoint, including the error of a pending authorization
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	ExpiresIn    int    `json:"expires_in"`
+
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// DeviceLogin performs the OAuth 2.0 device authorization grant, prompt is called with the code the user
+// must approve, then the token endpoint is polled until the login is approved, denied or expires.
+func DeviceLogin(ctx context.Context, client *http.Client, d *Discovery, prompt func(*DeviceAuthorization)) (*oauth2.Token, error) {
+	if d.DeviceAuthorizationEndpoint == "" {
+		return nil, ErrDeviceNotSupported
+	}
+
+	auth := new(DeviceAuthorization)
+
+	err := postForm(ctx, client, d.DeviceAuthorizationEndpoint, url.Values{
+		"client_id": {d.ClientID},
+		"scope":     {strings.Join(d.Scopes, " ")},
+	}, auth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start device authorization: %w", err)
+	}
+
+	if auth.VerificationURI == "" {
+		auth.VerificationURI = auth.VerificationURL
+	}
+
+	prompt(auth)
+
+	interval := time.Duration(auth.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	if auth.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(auth.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, errors.New("device authorization expired before it was approved")
+		case <-time.After(interval):
+		}
+
+		res := new(tokenResponse)
+
+		err := postForm(ctx, client, d.Endpoint.TokenURL, url.Values{
+			"grant_type":  {deviceGrantType},
+			"device_code": {auth.DeviceCode},
+			"client_id":   {d.ClientID},
+		}, res)
+
+		switch res.Error {
+		case "":
+			if err != nil {
+				return nil, fmt.Errorf("failed to poll token endpoint: %w", err)
+			}
+			return res.token(), nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += slowDownInterval
+		case "access_denied":
+			return nil, errors.New("device authorization was denied")
+		case "expired_token":
+			return nil, errors.New("device authorization expired before it was approved")
+		default:
+			return nil, fmt.Errorf("device authorization failed: %s %s", res.Error, res.ErrorDescription)
+		}
+	}
+}
+
+func (r *tokenResponse) token() *oauth2.Token {
+	tok := &oauth2.Token{
+		AccessToken:  r.AccessToken,
+		TokenType:    r.TokenType,
+		RefreshToken: r.RefreshToken,
+	}
+
+	if r.ExpiresIn > 0 {
+		tok.Expiry = time.Now().Add(time.Duration(r.ExpiresIn) * time.Second)
+	}
+
+	return tok.WithExtra(map[string]interface{}{"id_token": r.IDToken})
+}
+
+// postForm posts the form and decodes the JSON response, error responses are decoded before the error is returned
+func postForm(ctx context.Context, client *http.Client, endpoint string, form url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	err = json.NewDecoder(res.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("failed to parse response: %s", res.Status)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response: %s", res.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+// Package cli implements the login flows and token cache used by proxy-cli.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/coreos/go-oidc"
+	"golang.org/x/oauth2"
+)
+
+// Discovery the openid provider and client used to login to a site
+type Discovery struct {
+	Issuer   string   `json:"issuer"`
+	ClientID string   `json:"client_id"`
+	Scopes   []string `json:"scopes"`
+
+	// Endpoint the authorization and token endpoints of the provider
+	Endpoint oauth2.Endpoint `json:"-"`
+	// DeviceAuthorizationEndpoint is empty if the provider doesn't support the device authorization grant
+	DeviceAuthorizationEndpoint string `json:"-"`
+}
+
+// SiteKey returns the scheme and host of the site URL which identifies its token in the cache
+func SiteKey(siteURL string) (string, error) {
+	u, err := url.Parse(siteURL)
+	if err != nil {
+		return "", err
+	}
+
+	if u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return "", fmt.Errorf("invalid site url %q must be an absolute http or https url", siteURL)
+	}
+
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// Discover reads the cli config of the site from the auth routes, then the configuration of its openid provider.
+func Discover(ctx context.Context, client *http.Client, siteURL, authPrefix string) (*Discovery, error) {
+	site, err := SiteKey(siteURL)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, site+authPrefix+"/cli", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover cli config: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to discover cli config: %s isn't enabled for this site", res.Status)
+	}
+
+	d := new(Discovery)
+
+	err = json.NewDecoder(res.Body).Decode(d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cli config: %w", err)
+	}
+
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, client), d.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover openid provider: %w", err)
+	}
+
+	var claims struct {
+		DeviceAuthorizationEndpoint string   `json:"device_authorization_endpoint"`
+		ScopesSupported             []string `json:"scopes_supported"`
+	}
+
+	err = provider.Claims(&claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read openid provider configuration: %w", err)
+	}
+
+	d.Endpoint = provider.Endpoint()
+	d.DeviceAuthorizationEndpoint = claims.DeviceAuthorizationEndpoint
+
+	// a refresh token avoids logging in again when the id token expires
+	if contains(claims.ScopesSupported, oidc.ScopeOfflineAccess) && !contains(d.Scopes, oidc.ScopeOfflineAccess) {
+		d.Scopes = append(d.Scopes, oidc.ScopeOfflineAccess)
+	}
+
+	if !contains(d.Scopes, oidc.ScopeOpenID) {
+		d.Scopes = append([]string{oidc.ScopeOpenID}, d.Scopes...)
+	}
+
+	return d, nil
+}
+
+// OAuthConfig returns the oauth2 config used to exchange and refresh tokens
+func (d *Discovery) OAuthConfig(redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:    d.ClientID,
+		Endpoint:    d.Endpoint,
+		RedirectURL: redirectURL,
+		Scopes:      d.Scopes,
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
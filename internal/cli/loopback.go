@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/wolfeidau/website-openid-proxy/internal/pkce"
+	"golang.org/x/oauth2"
+)
+
+const (
+	stateLength    = 32
+	verifierLength = 32
+)
+
+// LoopbackLogin performs the authorization code grant with PKCE, open is called with the URL the user must visit
+// in their browser which redirects back to a server listening on the loopback interface.
+func LoopbackLogin(ctx context.Context, client *http.Client, d *Discovery, open func(authURL string)) (*oauth2.Token, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the callback: %w", err)
+	}
+	defer listener.Close()
+
+	redirectURL := fmt.Sprintf("http://%s/callback", listener.Addr())
+
+	conf := d.OAuthConfig(redirectURL)
+
+	state := pkce.MustNewVerifier(stateLength)
+	verifier := pkce.MustNewVerifier(verifierLength)
+
+	type result struct {
+		code string
+		err  error
+	}
+
+	results := make(chan result, 1)
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(w, r)
+			return
+		}
+
+		q := r.URL.Query()
+
+		if q.Get("state") != state {
+			http.Error(w, "invalid state", http.StatusBadRequest)
+			return
+		}
+
+		res := result{code: q.Get("code")}
+		if q.Get("error") != "" {
+			res = result{err: fmt.Errorf("login failed: %s %s", q.Get("error"), q.Get("error_description"))}
+		}
+
+		// only the first callback is used
+		select {
+		case results <- res:
+		default:
+		}
+
+		fmt.Fprintln(w, "Login complete, you can close this window and return to the terminal.")
+	})}
+
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+	defer srv.Close()
+
+	open(conf.AuthCodeURL(state,
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+		oauth2.SetAuthURLParam("code_challenge", pkce.MustCodeChallengeS256(verifier)),
+	))
+
+	var res result
+
+	select {
+	case <-ctx.Done():
+		return nil, errors.New("login cancelled before the callback was received")
+	case res = <-results:
+	}
+
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	tok, err := conf.Exchange(context.WithValue(ctx, oauth2.HTTPClient, client), res.code, oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange tokens: %w", err)
+	}
+
+	return tok, nil
+}
@@ -0,0 +1,339 @@
+package content
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/wolfeidau/website-openid-proxy/internal/pathmatch"
+)
+
+// statsInterval how often the cache stats are logged
+const statsInterval = time.Minute
+
+// Cache statuses recorded on objects returned by the cache
+const (
+	CacheHit         = "hit"
+	CacheMiss        = "miss"
+	CacheRevalidated = "revalidated"
+	CacheBypass      = "bypass"
+)
+
+// CacheConfig defines the config for the object cache.
+type CacheConfig struct {
+	// MaxBytes the total size of the cached objects.
+	MaxBytes int64
+
+	// MaxObjectSize the size of the largest object which is cached.
+	MaxObjectSize int64
+
+	// TTL how long objects are used before they are revalidated with the store.
+	TTL time.Duration
+
+	// Exclude request path patterns which are never cached, these are matched against the Path of the
+	// conditions so objects read without a request path are always cached.
+	Exclude []string
+
+	// Now returns the current time, defaults to time.Now.
+	Now func() time.Time
+}
+
+// CacheStats counts the requests served by the cache
+type CacheStats struct {
+	Hits        int64
+	Misses      int64
+	Revalidated int64
+	Bypassed    int64
+	Evictions   int64
+	Bytes       int64
+	Objects     int
+}
+
+// HitRate the fraction of cacheable requests served without reading the object from the store
+func (s CacheStats) HitRate() float64 {
+	total := s.Hits + s.Revalidated + s.Misses
+	if total == 0 {
+		return 0
+	}
+
+	return float64(s.Hits+s.Revalidated) / float64(total)
+}
+
+// cacheKey identifies a version of an object, entries are keyed by the object key and ETag so an entry is only
+// ever used for the version of the object it was read from
+type cacheKey struct {
+	key  string
+	etag string
+}
+
+type cacheEntry struct {
+	obj     Object
+	data    []byte
+	fetched time.Time
+}
+
+// Cache keeps small objects in memory keyed by their key and ETag, the least recently used objects are evicted
+// when the size budget is exceeded and objects older than the TTL are revalidated using their ETag.
+type Cache struct {
+	store  Store
+	config CacheConfig
+
+	mu       sync.Mutex
+	entries  map[cacheKey]*list.Element
+	versions map[string]string
+	lru      *list.List
+	bytes    int64
+	loggedAt time.Time
+
+	hits, misses, revalidated, bypassed, evictions int64
+}
+
+var _ Store = &Cache{}
+
+// NewCache create a cache of objects read from the store
+func NewCache(store Store, config CacheConfig) *Cache {
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	return &Cache{
+		store:    store,
+		config:   config,
+		entries:  make(map[cacheKey]*list.Element),
+		versions: make(map[string]string),
+		lru:      list.New(),
+	}
+}
+
+// Get returns the object from the cache, or reads it from the store and caches it if it is small enough.
+func (ch *Cache) Get(ctx context.Context, key string, cond Conditions) (*Object, error) {
+	// ranges are read from the store as they are mostly used for large objects
+	if cond.Range != "" || (cond.Path != "" && pathmatch.MatchAny(ch.config.Exclude, cond.Path)) {
+		atomic.AddInt64(&ch.bypassed, 1)
+
+		obj, err := ch.store.Get(ctx, key, cond)
+		if obj != nil {
+			obj.CacheStatus = CacheBypass
+		}
+
+		return obj, err
+	}
+
+	now := ch.config.Now()
+
+	ch.logStats(ctx, now)
+
+	entry := ch.lookup(key)
+	if entry != nil && now.Sub(entry.fetched) < ch.config.TTL {
+		atomic.AddInt64(&ch.hits, 1)
+		return entry.object(CacheHit, cond)
+	}
+
+	var storeCond Conditions
+	if entry != nil {
+		storeCond.IfNoneMatch = entry.obj.ETag
+	}
+
+	obj, err := ch.store.Get(ctx, key, storeCond)
+	switch err {
+	case nil:
+	case ErrNotModified:
+		if entry == nil {
+			return nil, err
+		}
+
+		atomic.AddInt64(&ch.revalidated, 1)
+
+		ch.add(key, &cacheEntry{obj: entry.obj, data: entry.data, fetched: now})
+
+		return entry.object(CacheRevalidated, cond)
+	case ErrNotFound:
+		ch.remove(key)
+		return nil, err
+	default:
+		return nil, err
+	}
+
+	atomic.AddInt64(&ch.misses, 1)
+
+	if obj.ContentLength < 0 || obj.ContentLength > ch.config.MaxObjectSize {
+		ch.remove(key)
+
+		obj.CacheStatus = CacheMiss
+
+		if notModified(cond, obj.ETag, obj.LastModified) {
+			obj.Body.Close()
+			return nil, ErrNotModified
+		}
+
+		return obj, nil
+	}
+
+	defer obj.Body.Close()
+
+	data, err := io.ReadAll(obj.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	entry = &cacheEntry{obj: *obj, data: data, fetched: now}
+	entry.obj.Key = key
+	entry.obj.Body = nil
+
+	ch.add(key, entry)
+
+	return entry.object(CacheMiss, cond)
+}
+
+// Stats returns the counts of requests served by the cache
+func (ch *Cache) Stats() CacheStats {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	return CacheStats{
+		Hits:        atomic.LoadInt64(&ch.hits),
+		Misses:      atomic.LoadInt64(&ch.misses),
+		Revalidated: atomic.LoadInt64(&ch.revalidated),
+		Bypassed:    atomic.LoadInt64(&ch.bypassed),
+		Evictions:   atomic.LoadInt64(&ch.evictions),
+		Bytes:       ch.bytes,
+		Objects:     ch.lru.Len(),
+	}
+}
+
+// logStats periodically logs the stats so the hit rate of each container can be monitored
+func (ch *Cache) logStats(ctx context.Context, now time.Time) {
+	ch.mu.Lock()
+	due := now.Sub(ch.loggedAt) >= statsInterval
+	if due {
+		ch.loggedAt = now
+	}
+	ch.mu.Unlock()
+
+	if !due {
+		return
+	}
+
+	stats := ch.Stats()
+
+	log.Ctx(ctx).Info().
+		Int64("hits", stats.Hits).
+		Int64("misses", stats.Misses).
+		Int64("revalidated", stats.Revalidated).
+		Int64("bypassed", stats.Bypassed).
+		Int64("evictions", stats.Evictions).
+		Int64("bytes", stats.Bytes).
+		Int("objects", stats.Objects).
+		Float64("hit_rate", stats.HitRate()).
+		Msg("object cache stats")
+}
+
+func (ch *Cache) lookup(key string) *cacheEntry {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	etag, ok := ch.versions[key]
+	if !ok {
+		return nil
+	}
+
+	el, ok := ch.entries[cacheKey{key: key, etag: etag}]
+	if !ok {
+		return nil
+	}
+
+	ch.lru.MoveToFront(el)
+
+	return el.Value.(*cacheEntry)
+}
+
+func (ch *Cache) add(key string, entry *cacheEntry) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	ch.removeLocked(key)
+
+	if int64(len(entry.data)) > ch.config.MaxBytes {
+		return
+	}
+
+	ch.entries[cacheKey{key: key, etag: entry.obj.ETag}] = ch.lru.PushFront(entry)
+	ch.versions[key] = entry.obj.ETag
+	ch.bytes += int64(len(entry.data))
+
+	for ch.bytes > ch.config.MaxBytes {
+		oldest := ch.lru.Back()
+		ch.removeLocked(oldest.Value.(*cacheEntry).obj.Key)
+		atomic.AddInt64(&ch.evictions, 1)
+	}
+}
+
+func (ch *Cache) remove(key string) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	ch.removeLocked(key)
+}
+
+func (ch *Cache) removeLocked(key string) {
+	etag, ok := ch.versions[key]
+	if !ok {
+		return
+	}
+
+	ck := cacheKey{key: key, etag: etag}
+
+	el, ok := ch.entries[ck]
+	if !ok {
+		return
+	}
+
+	ch.lru.Remove(el)
+	delete(ch.entries, ck)
+	delete(ch.versions, key)
+	ch.bytes -= int64(len(el.Value.(*cacheEntry).data))
+}
+
+// object returns a copy of the cached object, conditions from the client are checked against the cached version.
+func (e *cacheEntry) object(status string, cond Conditions) (*Object, error) {
+	if notModified(cond, e.obj.ETag, e.obj.LastModified) {
+		return nil, ErrNotModified
+	}
+
+	obj := e.obj
+	obj.Body = io.NopCloser(bytes.NewReader(e.data))
+	obj.CacheStatus = status
+
+	return &obj, nil
+}
+
+// notModified evaluates the conditions against the object as described in RFC 7232, If-None-Match takes
+// precedence and uses a weak comparison.
+func notModified(cond Conditions, etag string, lastModified time.Time) bool {
+	if cond.IfNoneMatch != "" {
+		if etag == "" {
+			return false
+		}
+
+		for _, candidate := range strings.Split(cond.IfNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if cond.IfModifiedSince.IsZero() || lastModified.IsZero() {
+		return false
+	}
+
+	return !lastModified.Truncate(time.Second).After(cond.IfModifiedSince)
+}
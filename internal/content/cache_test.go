@@ -0,0 +1,211 @@
+package content
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newCache(store Store, now *time.Time) *Cache {
+	return NewCache(store, CacheConfig{
+		MaxBytes:      40,
+		MaxObjectSize: 20,
+		TTL:           time.Minute,
+		Exclude:       []string{"/guide/**"},
+		Now:           func() time.Time { return *now },
+	})
+}
+
+func readObject(t *testing.T, ch *Cache, key string, cond Conditions) (*Object, string) {
+	obj, err := ch.Get(context.TODO(), key, cond)
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(obj.Body)
+	require.NoError(t, err)
+
+	return obj, string(data)
+}
+
+func TestCache(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Now()
+
+	_, store := newConfig()
+	ch := newCache(store, &now)
+
+	obj, body := readObject(t, ch, "index.html", Conditions{})
+	assert.Equal(CacheMiss, obj.CacheStatus)
+	assert.Equal("<html>index</html>", body)
+
+	obj, body = readObject(t, ch, "index.html", Conditions{})
+	assert.Equal(CacheHit, obj.CacheStatus)
+	assert.Equal("<html>index</html>", body)
+	assert.Equal([]string{"index.html"}, store.gets)
+
+	// client conditions are answered from the cache
+	_, err := ch.Get(context.TODO(), "index.html", Conditions{IfNoneMatch: `W/"index.html"`})
+	assert.Equal(ErrNotModified, err)
+
+	// once the ttl has passed the object is revalidated
+	now = now.Add(2 * time.Minute)
+
+	obj, body = readObject(t, ch, "index.html", Conditions{})
+	assert.Equal(CacheRevalidated, obj.CacheStatus)
+	assert.Equal("<html>index</html>", body)
+	assert.Equal([]string{"index.html", "index.html"}, store.gets)
+
+	stats := ch.Stats()
+	assert.Equal(int64(2), stats.Hits)
+	assert.Equal(int64(1), stats.Misses)
+	assert.Equal(int64(1), stats.Revalidated)
+	assert.Equal(0.75, stats.HitRate())
+}
+
+func TestCache_Evict(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Now()
+
+	_, store := newConfig()
+	store.objects["a.js"] = "aaaaaaaaaaaaaaa"
+	store.objects["b.js"] = "bbbbbbbbbbbbbbb"
+	store.objects["c.js"] = "ccccccccccccccc"
+	store.objects["big.js"] = "this object is larger than the limit"
+
+	ch := newCache(store, &now)
+
+	readObject(t, ch, "a.js", Conditions{})
+	readObject(t, ch, "b.js", Conditions{})
+	readObject(t, ch, "a.js", Conditions{})
+	readObject(t, ch, "c.js", Conditions{})
+
+	// b.js was the least recently used
+	stats := ch.Stats()
+	assert.Equal(2, stats.Objects)
+	assert.Equal(int64(30), stats.Bytes)
+	assert.Equal(int64(1), stats.Evictions)
+
+	obj, _ := readObject(t, ch, "b.js", Conditions{})
+	assert.Equal(CacheMiss, obj.CacheStatus)
+
+	// large objects are streamed from the store
+	obj, body := readObject(t, ch, "big.js", Conditions{})
+	assert.Equal(CacheMiss, obj.CacheStatus)
+	assert.Equal("this object is larger than the limit", body)
+
+	obj, _ = readObject(t, ch, "big.js", Conditions{})
+	assert.Equal(CacheMiss, obj.CacheStatus)
+}
+
+func TestCache_Changed(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Now()
+
+	_, store := newConfig()
+	ch := newCache(store, &now)
+
+	readObject(t, ch, "index.html", Conditions{})
+
+	store.objects["index.html"] = "<html>new</html>"
+	store.etags = map[string]string{"index.html": `"v2"`}
+
+	// the cached version is used until it is revalidated
+	obj, body := readObject(t, ch, "index.html", Conditions{})
+	assert.Equal(CacheHit, obj.CacheStatus)
+	assert.Equal("<html>index</html>", body)
+
+	now = now.Add(2 * time.Minute)
+
+	obj, body = readObject(t, ch, "index.html", Conditions{})
+	assert.Equal(CacheMiss, obj.CacheStatus)
+	assert.Equal(`"v2"`, obj.ETag)
+	assert.Equal("<html>new</html>", body)
+
+	// the previous version is replaced
+	stats := ch.Stats()
+	assert.Equal(1, stats.Objects)
+	assert.Equal(int64(len("<html>new</html>")), stats.Bytes)
+
+	_, err := ch.Get(context.TODO(), "index.html", Conditions{IfNoneMatch: `"index.html"`})
+	assert.NoError(err)
+}
+
+func TestCache_Exclude(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Now()
+
+	_, store := newConfig()
+	ch := newCache(store, &now)
+
+	readObject(t, ch, "guide/install.html", Conditions{Path: "/guide/install.html"})
+
+	obj, _ := readObject(t, ch, "guide/install.html", Conditions{Path: "/guide/install.html"})
+	assert.Equal(CacheBypass, obj.CacheStatus)
+	assert.Equal([]string{"guide/install.html", "guide/install.html"}, store.gets)
+	assert.Equal(0, ch.Stats().Objects)
+
+	_, err := ch.Get(context.TODO(), "missing.html", Conditions{})
+	assert.Equal(ErrNotFound, err)
+}
+
+func TestNotModified(t *testing.T) {
+	modified := time.Date(2023, 3, 1, 10, 0, 0, 500, time.UTC)
+
+	tests := []struct {
+		name string
+		cond Conditions
+		want bool
+	}{
+		{name: "none", cond: Conditions{}, want: false},
+		{name: "etag", cond: Conditions{IfNoneMatch: `"abc"`}, want: true},
+		{name: "weak etag", cond: Conditions{IfNoneMatch: `"xyz", W/"abc"`}, want: true},
+		{name: "any", cond: Conditions{IfNoneMatch: "*"}, want: true},
+		{name: "changed etag", cond: Conditions{IfNoneMatch: `"xyz"`, IfModifiedSince: modified}, want: false},
+		{name: "modified since", cond: Conditions{IfModifiedSince: modified.Truncate(time.Second)}, want: true},
+		{name: "modified after", cond: Conditions{IfModifiedSince: modified.Add(-time.Hour)}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, notModified(tt.cond, `"abc"`, modified))
+		})
+	}
+}
+
+func TestCache_ExcludePrefixedSite(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Now()
+
+	config, store := newConfig()
+	store.objects["docs/guide/install.html"] = "<html>install</html>"
+	store.objects["docs/index.html"] = "<html>index</html>"
+
+	ch := newCache(store, &now)
+
+	config.Store = ch
+	config.PathPrefix = "/docs"
+	config.KeyPrefix = "docs/"
+
+	// the exclusions match the request path rather than the key
+	ch.config.Exclude = []string{"/docs/guide/**"}
+
+	for i := 0; i < 2; i++ {
+		rec := serve(config, httptest.NewRequest(http.MethodGet, "/docs/guide/install.html", nil))
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.Equal("<html>install</html>", rec.Body.String())
+
+		rec = serve(config, httptest.NewRequest(http.MethodGet, "/docs/", nil))
+		assert.Equal(http.StatusOK, rec.Code)
+	}
+
+	assert.Equal([]string{"docs/guide/install.html", "docs/index.html", "docs/guide/install.html"}, store.gets)
+	assert.Equal(int64(2), ch.Stats().Bypassed)
+}
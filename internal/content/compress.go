@@ -0,0 +1,317 @@
+package content
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	// EncodingBrotli the brotli content encoding
+	EncodingBrotli = "br"
+	// EncodingGzip the gzip content encoding
+	EncodingGzip = "gzip"
+
+	// DefaultCompressMinLength responses smaller than this aren't worth compressing
+	DefaultCompressMinLength = 1024
+
+	brotliQuality = 5
+)
+
+// DefaultCompressTypes the content types which are compressed, other types such as images are already compressed.
+var DefaultCompressTypes = []string{
+	"text/*",
+	"application/javascript",
+	"application/json",
+	"application/manifest+json",
+	"application/wasm",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// CompressConfig defines the config for the compress middleware.
+type CompressConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Encodings offered to clients in order of preference, defaults to br and gzip.
+	Encodings []string
+
+	// MinLength responses shorter than this are sent uncompressed, defaults to DefaultCompressMinLength.
+	MinLength int
+
+	// Types the content types which are compressed, defaults to DefaultCompressTypes.
+	Types []string
+}
+
+// CompressWithConfig returns a middleware which compresses responses using the encoding preferred by the
+// Accept-Encoding header. Responses which already have a Content-Encoding, such as precompressed objects, are
+// sent as is.
+func CompressWithConfig(config CompressConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if len(config.Encodings) == 0 {
+		config.Encodings = []string{EncodingBrotli, EncodingGzip}
+	}
+	if config.MinLength == 0 {
+		config.MinLength = DefaultCompressMinLength
+	}
+	if len(config.Types) == 0 {
+		config.Types = DefaultCompressTypes
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) || c.Request().Method == http.MethodHead {
+				return next(c)
+			}
+
+			res := c.Response()
+
+			cw := &compressWriter{
+				ResponseWriter: res.Writer,
+				config:         config,
+				encoding:       Negotiate(c.Request().Header.Get(echo.HeaderAcceptEncoding), config.Encodings),
+			}
+
+			res.Writer = cw
+			defer func() {
+				res.Writer = cw.ResponseWriter
+			}()
+
+			err := next(c)
+
+			// errors are written by the error handler once the middleware returns
+			if err != nil {
+				cw.passthrough()
+				return err
+			}
+
+			return cw.Close()
+		}
+	}
+}
+
+// Negotiate returns the first of the offered encodings accepted by the Accept-Encoding header, or an empty string
+// if none are accepted.
+func Negotiate(acceptEncoding string, offered []string) string {
+	accepted := make(map[string]bool)
+	wildcard := false
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		ok := true
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			if v, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64); err == nil && v == 0 {
+				ok = false
+			}
+		}
+
+		if name == "*" {
+			wildcard = ok
+			continue
+		}
+
+		accepted[name] = ok
+	}
+
+	for _, enc := range offered {
+		if ok, found := accepted[enc]; ok || (!found && wildcard) {
+			return enc
+		}
+	}
+
+	return ""
+}
+
+// addVary adds Accept-Encoding to the Vary header unless it is already listed
+func addVary(h http.Header) {
+	for _, v := range h.Values(echo.HeaderVary) {
+		for _, name := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(name), echo.HeaderAcceptEncoding) {
+				return
+			}
+		}
+	}
+
+	h.Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+}
+
+// compressible reports whether responses with the content type are compressed
+func compressible(contentType string, types []string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, t := range types {
+		if strings.HasSuffix(t, "/*") {
+			if strings.HasPrefix(mt, strings.TrimSuffix(t, "*")) {
+				return true
+			}
+			continue
+		}
+
+		if mt == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compressWriter buffers the start of the response until it is known to be long enough to compress.
+type compressWriter struct {
+	http.ResponseWriter
+
+	config   CompressConfig
+	encoding string
+
+	status  int
+	pending bool
+	buf     bytes.Buffer
+	enc     io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.status != 0 {
+		return
+	}
+
+	w.status = code
+
+	h := w.Header()
+
+	if !compressible(h.Get(echo.HeaderContentType), w.config.Types) || h.Get(echo.HeaderContentEncoding) != "" {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	addVary(h)
+
+	// partial and empty responses are never compressed
+	if w.encoding == "" || code != http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	if n, err := strconv.Atoi(h.Get(echo.HeaderContentLength)); err == nil && n < w.config.MinLength {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	w.pending = true
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	switch {
+	case w.enc != nil:
+		return w.enc.Write(b)
+	case !w.pending:
+		return w.ResponseWriter.Write(b)
+	}
+
+	n, _ := w.buf.Write(b)
+
+	if w.buf.Len() >= w.config.MinLength {
+		if err := w.start(); err != nil {
+			return 0, err
+		}
+	}
+
+	return n, nil
+}
+
+// start compressing the response, writing the buffered content to the encoder
+func (w *compressWriter) start() error {
+	w.pending = false
+
+	h := w.Header()
+	h.Del(echo.HeaderContentLength)
+	h.Set(echo.HeaderContentEncoding, w.encoding)
+
+	// the compressed response has different bytes to the object so the etag can only be a weak match
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+
+	switch w.encoding {
+	case EncodingBrotli:
+		w.enc = brotli.NewWriterLevel(w.ResponseWriter, brotliQuality)
+	default:
+		w.enc = gzip.NewWriter(w.ResponseWriter)
+	}
+
+	_, err := w.enc.Write(w.buf.Bytes())
+	w.buf.Reset()
+
+	return err
+}
+
+// passthrough sends anything buffered without compression
+func (w *compressWriter) passthrough() {
+	if !w.pending {
+		return
+	}
+
+	w.pending = false
+
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+	w.buf.Reset()
+}
+
+// Close sends a short buffered response as is or finishes the compressed response
+func (w *compressWriter) Close() error {
+	if w.enc == nil {
+		w.passthrough()
+		return nil
+	}
+
+	return w.enc.Close()
+}
+
+// Flush sends what has been compressed so far, short responses are still buffered.
+func (w *compressWriter) Flush() {
+	if w.enc != nil {
+		if f, ok := w.enc.(interface{ Flush() error }); ok {
+			_ = f.Flush()
+		}
+	}
+
+	if w.pending {
+		return
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+
+	return nil, nil, errors.New("content: response does not support hijack")
+}
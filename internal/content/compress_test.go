@@ -0,0 +1,166 @@
+package content
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	offered := []string{EncodingBrotli, EncodingGzip}
+
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "gzip, deflate, br", want: EncodingBrotli},
+		{header: "gzip", want: EncodingGzip},
+		{header: "br;q=0, gzip;q=0.8", want: EncodingGzip},
+		{header: "*", want: EncodingBrotli},
+		{header: "*, br;q=0", want: EncodingGzip},
+		{header: "identity", want: ""},
+		{header: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			require.Equal(t, tt.want, Negotiate(tt.header, offered))
+		})
+	}
+}
+
+func compressServer(body, contentType string) *echo.Echo {
+	e := echo.New()
+	e.Use(CompressWithConfig(CompressConfig{MinLength: 16}))
+	e.GET("/*", func(c echo.Context) error {
+		c.Response().Header().Set("ETag", `"abc"`)
+		return c.Stream(http.StatusOK, contentType, strings.NewReader(body))
+	})
+
+	return e
+}
+
+func TestCompress(t *testing.T) {
+	assert := require.New(t)
+
+	body := strings.Repeat("console.log('app');", 10)
+
+	e := compressServer(body, "application/javascript")
+
+	req := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	req.Header.Set(echo.HeaderAcceptEncoding, "gzip, br")
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal(EncodingBrotli, rec.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(echo.HeaderAcceptEncoding, rec.Header().Get(echo.HeaderVary))
+	assert.Equal(`W/"abc"`, rec.Header().Get("ETag"))
+
+	data, err := io.ReadAll(brotli.NewReader(rec.Body))
+	assert.NoError(err)
+	assert.Equal(body, string(data))
+
+	req = httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	req.Header.Set(echo.HeaderAcceptEncoding, "gzip")
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(EncodingGzip, rec.Header().Get(echo.HeaderContentEncoding))
+
+	gr, err := gzip.NewReader(rec.Body)
+	assert.NoError(err)
+	data, err = io.ReadAll(gr)
+	assert.NoError(err)
+	assert.Equal(body, string(data))
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/app.js", nil))
+
+	assert.Empty(rec.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(echo.HeaderAcceptEncoding, rec.Header().Get(echo.HeaderVary))
+	assert.Equal(body, rec.Body.String())
+}
+
+func TestCompress_Skipped(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+	}{
+		{name: "short", body: "console.log(1)", contentType: "application/javascript"},
+		{name: "image", body: strings.Repeat("png", 100), contentType: "image/png"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/file", nil)
+		req.Header.Set(echo.HeaderAcceptEncoding, "gzip, br")
+
+		rec := httptest.NewRecorder()
+		compressServer(tt.body, tt.contentType).ServeHTTP(rec, req)
+
+		assert.Equal(http.StatusOK, rec.Code, tt.name)
+		assert.Empty(rec.Header().Get(echo.HeaderContentEncoding), tt.name)
+		assert.Equal(`"abc"`, rec.Header().Get("ETag"), tt.name)
+		assert.Equal(tt.body, rec.Body.String(), tt.name)
+	}
+}
+
+func TestMiddleware_Precompressed(t *testing.T) {
+	assert := require.New(t)
+
+	config, store := newConfig()
+	config.Precompressed = true
+	store.objects["assets/app.abc.js.br"] = "brotli"
+
+	req := httptest.NewRequest(http.MethodGet, "/assets/app.abc.js", nil)
+	req.Header.Set(echo.HeaderAcceptEncoding, "gzip, br")
+
+	rec := serve(config, req)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("brotli", rec.Body.String())
+	assert.Equal(EncodingBrotli, rec.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(echo.HeaderAcceptEncoding, rec.Header().Get(echo.HeaderVary))
+	assert.Equal(`"assets/app.abc.js.br"`, rec.Header().Get("ETag"))
+	assert.Equal("private, max-age=31536000, immutable", rec.Header().Get(echo.HeaderCacheControl))
+	assert.Contains(rec.Header().Get(echo.HeaderContentType), "javascript")
+
+	// the variant is unchanged
+	req.Header.Set("If-None-Match", `"assets/app.abc.js.br"`)
+
+	rec = serve(config, req)
+	assert.Equal(http.StatusNotModified, rec.Code)
+	assert.Equal(echo.HeaderAcceptEncoding, rec.Header().Get(echo.HeaderVary))
+	assert.Equal(`"assets/app.abc.js.br"`, rec.Header().Get("ETag"))
+	assert.Equal("private, max-age=31536000, immutable", rec.Header().Get(echo.HeaderCacheControl))
+
+	req.Header.Del("If-None-Match")
+	store.gets = nil
+	req.Header.Set(echo.HeaderAcceptEncoding, "gzip")
+
+	rec = serve(config, req)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("console.log('app')", rec.Body.String())
+	assert.Empty(rec.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(echo.HeaderAcceptEncoding, rec.Header().Get(echo.HeaderVary))
+	assert.Equal([]string{"assets/app.abc.js.gz", "assets/app.abc.js"}, store.gets)
+
+	store.gets = nil
+	req.Header.Set(echo.HeaderAcceptEncoding, "br")
+	req.Header.Set("Range", "bytes=0-6")
+
+	rec = serve(config, req)
+	assert.Equal(http.StatusPartialContent, rec.Code)
+	assert.Equal([]string{"assets/app.abc.js"}, store.gets)
+}
@@ -0,0 +1,180 @@
+package content
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultListPageSize the number of entries on each page of a directory listing
+const DefaultListPageSize = 200
+
+// Entry an object or sub directory in a listing
+type Entry struct {
+	Name         string    `json:"name"`
+	Path         string    `json:"path"`
+	Dir          bool      `json:"dir,omitempty"`
+	Size         int64     `json:"size,omitempty"`
+	LastModified time.Time `json:"last_modified,omitempty"`
+}
+
+// Listing a page of the entries under a prefix
+type Listing struct {
+	Path      string  `json:"path"`
+	Entries   []Entry `json:"entries"`
+	NextToken string  `json:"next_token,omitempty"`
+}
+
+// Lister lists the objects and sub directories under a prefix
+type Lister interface {
+	List(ctx context.Context, prefix, token string, limit int) (*Listing, error)
+}
+
+var _ Lister = &Bucket{}
+
+// List returns a page of entries under the prefix, the token from the previous page is used to continue
+// the listing.
+func (b *Bucket) List(ctx context.Context, prefix, token string, limit int) (*Listing, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(b.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+		MaxKeys:   aws.Int64(int64(limit)),
+	}
+
+	if token != "" {
+		input.ContinuationToken = aws.String(token)
+	}
+
+	res, err := b.s3svc.ListObjectsV2WithContext(ctx, input)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	listing := &Listing{
+		Path:      "/" + prefix,
+		NextToken: aws.StringValue(res.NextContinuationToken),
+	}
+
+	for _, cp := range res.CommonPrefixes {
+		p := aws.StringValue(cp.Prefix)
+
+		listing.Entries = append(listing.Entries, Entry{
+			Name: strings.TrimPrefix(p, prefix),
+			Path: "/" + p,
+			Dir:  true,
+		})
+	}
+
+	for _, obj := range res.Contents {
+		key := aws.StringValue(obj.Key)
+
+		// the prefix itself is returned when a folder was created in the console
+		if key == prefix {
+			continue
+		}
+
+		listing.Entries = append(listing.Entries, Entry{
+			Name:         strings.TrimPrefix(key, prefix),
+			Path:         "/" + key,
+			Size:         aws.Int64Value(obj.Size),
+			LastModified: aws.TimeValue(obj.LastModified),
+		})
+	}
+
+	return listing, nil
+}
+
+var listingTemplate = template.Must(template.New("listing").Funcs(template.FuncMap{
+	"size": humanSize,
+	"time": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04:05") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Index of {{.Path}}</title>
+</head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<thead><tr><th>Name</th><th>Size</th><th>Modified</th></tr></thead>
+<tbody>
+{{if ne .Path "/"}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{end}}{{range .Entries}}<tr><td><a href="{{.Path}}">{{.Name}}</a></td><td>{{if not .Dir}}{{size .Size}}{{end}}</td><td>{{if not .Dir}}{{time .LastModified}}{{end}}</td></tr>
+{{end}}</tbody>
+</table>
+{{if .NextToken}}<p><a href="?page={{.NextToken}}">Next page</a></p>{{end}}
+</body>
+</html>
+`))
+
+// list renders the directory listing for the path as HTML, or JSON for clients which accept it
+func (config Config) list(c echo.Context, p string) error {
+	ctx := c.Request().Context()
+
+	prefix := config.KeyPrefix + strings.TrimPrefix(strings.TrimPrefix(p, config.PathPrefix), "/")
+
+	listing, err := config.Lister.List(ctx, prefix, c.QueryParam("page"), config.ListPageSize)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("path", p).Msg("failed to list s3 prefix")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to process request")
+	}
+
+	// the first page of a prefix without any objects doesn't exist
+	if len(listing.Entries) == 0 && prefix != config.KeyPrefix && c.QueryParam("page") == "" {
+		return echo.NewHTTPError(http.StatusNotFound, "document not found")
+	}
+
+	listing.Path = p
+
+	// hide entries the user isn't permitted to access
+	entries := listing.Entries[:0]
+	for _, entry := range listing.Entries {
+		entry.Path = config.requestPath(strings.TrimPrefix(entry.Path, "/"))
+
+		if config.ListFilter == nil || config.ListFilter(c, entry.Path) {
+			entries = append(entries, entry)
+		}
+	}
+	listing.Entries = entries
+
+	return render(c, listing)
+}
+
+// render writes the listing as HTML, or JSON for clients which accept it
+func render(c echo.Context, listing *Listing) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, "private, no-cache")
+
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMEApplicationJSON) {
+		return c.JSON(http.StatusOK, listing)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+	c.Response().WriteHeader(http.StatusOK)
+
+	return listingTemplate.Execute(c.Response(), listing)
+}
+
+func humanSize(size int64) string {
+	const unit = 1024
+
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
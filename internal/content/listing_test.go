@@ -0,0 +1,114 @@
+package content
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLister struct {
+	tokens []string
+}
+
+func (f *fakeLister) List(ctx context.Context, prefix, token string, limit int) (*Listing, error) {
+	f.tokens = append(f.tokens, token)
+
+	if prefix != "builds/" {
+		return &Listing{Path: "/" + prefix}, nil
+	}
+
+	return &Listing{
+		Path: "/builds/",
+		Entries: []Entry{
+			{Name: "internal/", Path: "/builds/internal/", Dir: true},
+			{Name: "release/", Path: "/builds/release/", Dir: true},
+			{Name: "app-1.0.tar.gz", Path: "/builds/app-1.0.tar.gz", Size: 1536, LastModified: lastModified},
+		},
+		NextToken: "next/page",
+	}, nil
+}
+
+func TestMiddleware_Listing(t *testing.T) {
+	assert := require.New(t)
+
+	lister := &fakeLister{}
+
+	config, _ := newConfig()
+	config.DirectoryListing = true
+	config.Lister = lister
+	config.ListFilter = func(c echo.Context, p string) bool {
+		return !strings.HasPrefix(p, "/builds/internal/")
+	}
+
+	rec := serve(config, httptest.NewRequest(http.MethodGet, "/builds/", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), `<a href="/builds/release/">release/</a>`)
+	assert.Contains(rec.Body.String(), "1.5 KiB")
+	assert.Contains(rec.Body.String(), "2023-03-01 10:00:00")
+	assert.Contains(rec.Body.String(), `<a href="?page=next%2fpage">Next page</a>`)
+	assert.NotContains(rec.Body.String(), "internal")
+
+	req := httptest.NewRequest(http.MethodGet, "/builds/?page=next%2Fpage", nil)
+	req.Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+
+	rec = serve(config, req)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), `"next_token":"next/page"`)
+	assert.Equal([]string{"", "next/page"}, lister.tokens)
+
+	// directories with an index are served as normal
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("<html>index</html>", rec.Body.String())
+
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/missing/", nil))
+	assert.Equal(http.StatusNotFound, rec.Code)
+
+	// the spa fallback is replaced by listings
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/users/123", nil))
+	assert.Equal(http.StatusNotFound, rec.Code)
+}
+
+func (f *fakeS3) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	return &s3.ListObjectsV2Output{
+		CommonPrefixes: []*s3.CommonPrefix{{Prefix: aws.String("builds/release/")}},
+		Contents: []*s3.Object{
+			{Key: aws.String("builds/"), Size: aws.Int64(0)},
+			{Key: aws.String("builds/app.tar.gz"), Size: aws.Int64(10), LastModified: aws.Time(lastModified)},
+		},
+		NextContinuationToken: aws.String("abc"),
+	}, nil
+}
+
+func TestBucket_List(t *testing.T) {
+	assert := require.New(t)
+
+	b := &Bucket{s3svc: &fakeS3{}, bucket: "website"}
+
+	listing, err := b.List(context.TODO(), "builds/", "", 100)
+	assert.NoError(err)
+	assert.Equal(&Listing{
+		Path: "/builds/",
+		Entries: []Entry{
+			{Name: "release/", Path: "/builds/release/", Dir: true},
+			{Name: "app.tar.gz", Path: "/builds/app.tar.gz", Size: 10, LastModified: lastModified},
+		},
+		NextToken: "abc",
+	}, listing)
+}
+
+func TestHumanSize(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal("512 B", humanSize(512))
+	assert.Equal("1.0 KiB", humanSize(1024))
+	assert.Equal("2.5 MiB", humanSize(5*1024*1024/2))
+}
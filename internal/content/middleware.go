@@ -0,0 +1,608 @@
+package content
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/rs/zerolog/log"
+	"github.com/wolfeidau/website-openid-proxy/internal/flags"
+	"github.com/wolfeidau/website-openid-proxy/internal/pathmatch"
+)
+
+// DefaultCacheControl is used for content which doesn't match a cache policy, browsers keep a copy
+// but check it is current using the ETag before each use.
+const DefaultCacheControl = "no-cache"
+
+// Config defines the config for the content middleware.
+type Config struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Store the content is read from.
+	// Required.
+	Store Store
+
+	// Index file served for the root, defaults to index.html.
+	Index string
+
+	// PathPrefix is removed from the request path and KeyPrefix added to build the object key, this allows a
+	// site to be served from a folder of a bucket.
+	PathPrefix string
+	KeyPrefix  string
+
+	// SPA forwards requests for missing content to the index so the single page application
+	// can handle the routing.
+	SPA bool
+
+	// SPAPaths limits the SPA fallback to request paths matching these patterns, defaults to all paths.
+	SPAPaths []string
+
+	// SPAExtensionless skips the SPA fallback for paths with a file extension, so a missing asset is a 404
+	// rather than the index.
+	SPAExtensionless bool
+
+	// NotFound the key of the document served with a 404 status when nothing else matches, relative to the
+	// KeyPrefix.
+	NotFound string
+
+	// TrailingSlash redirects paths to add or remove the trailing slash, see flags.TrailingSlashAdd and
+	// flags.TrailingSlashRemove. When slashes are removed directories are served from their index.
+	TrailingSlash string
+
+	// CleanURLs serves page.html for /page and redirects requests for HTML documents to the path without
+	// the extension.
+	CleanURLs bool
+
+	// CachePolicies set the Cache-Control header for paths, the first matching policy is used.
+	CachePolicies []flags.CachePolicy
+
+	// Presigner creates the URLs large objects are redirected to.
+	Presigner Presigner
+
+	// LargeObjectSize objects larger than this are redirected to a presigned URL rather than passing
+	// through the proxy, zero disables the redirect.
+	LargeObjectSize int64
+
+	// PresignTTL how long presigned URLs are valid, defaults to 1 minute.
+	PresignTTL time.Duration
+
+	// DirectoryListing lists the contents of paths ending in / which don't have an index object using the
+	// Lister, this replaces the SPA fallback.
+	DirectoryListing bool
+
+	// Lister lists the objects of directories and previews.
+	Lister Lister
+
+	// ListFilter reports whether an entry is shown in a directory listing, defaults to showing all entries.
+	ListFilter func(c echo.Context, p string) bool
+
+	// ListPageSize the number of entries on each page of a listing, defaults to DefaultListPageSize.
+	ListPageSize int
+
+	// Preview selects the preview build serving the request, returning the path and key prefix of the build.
+	// Requests which don't select a preview are shown an index of the available previews.
+	Preview func(c echo.Context) (pathPrefix, keyPrefix string, ok bool)
+
+	// PreviewURL returns the link to a preview from the index.
+	PreviewURL func(c echo.Context, name string) string
+
+	// Rewrite is applied in order to the body of HTML documents before they are served, rewritten documents
+	// differ for each request so they aren't cached by the browser or served as ranges.
+	Rewrite []Rewriter
+
+	// Precompressed serves the .br and .gz variants stored alongside an object when the client accepts the
+	// encoding, each variant which doesn't exist costs a request to the store.
+	Precompressed bool
+}
+
+// precompressedSuffixes the suffix of the variant stored for each encoding
+var precompressedSuffixes = map[string]string{
+	EncodingBrotli: ".br",
+	EncodingGzip:   ".gz",
+}
+
+// Rewriter returns the rewritten body of a HTML document.
+type Rewriter func(c echo.Context, body []byte) ([]byte, error)
+
+// MiddlewareWithConfig returns a middleware which serves content from the store, responses include the ETag
+// and Last-Modified of the object and conditional requests are answered with 304 Not Modified.
+func MiddlewareWithConfig(config Config) echo.MiddlewareFunc {
+	if config.Store == nil {
+		panic("echo: content middleware requires store")
+	}
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.Index == "" {
+		config.Index = "index.html"
+	}
+	if config.PresignTTL == 0 {
+		config.PresignTTL = time.Minute
+	}
+	if config.ListPageSize == 0 {
+		config.ListPageSize = DefaultListPageSize
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			// each request uses its own copy of the config as previews change the prefixes
+			config := config
+
+			req := c.Request()
+			ctx := req.Context()
+
+			if req.Method != http.MethodGet && req.Method != http.MethodHead {
+				c.Response().Header().Set(echo.HeaderAllow, "GET, HEAD")
+				return echo.NewHTTPError(http.StatusMethodNotAllowed)
+			}
+
+			// keys are joined to the key prefix, so dot segments could otherwise read objects outside of it
+			if !pathmatch.IsClean(req.URL.Path) {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid path")
+			}
+
+			if config.Preview != nil {
+				pathPrefix, keyPrefix, ok := config.Preview(c)
+				if !ok {
+					return config.previews(c)
+				}
+
+				config.PathPrefix, config.KeyPrefix = pathPrefix, keyPrefix
+			}
+
+			// relative links in the index need the trailing slash
+			if config.PathPrefix != "" && req.URL.Path == config.PathPrefix {
+				return c.Redirect(http.StatusMovedPermanently, config.PathPrefix+"/")
+			}
+
+			if p := config.canonicalPath(req.URL.Path); p != req.URL.Path {
+				// the location must not be followed to another host
+				if !localPath(p) {
+					return echo.NewHTTPError(http.StatusBadRequest, "invalid path")
+				}
+
+				u := *req.URL
+				u.Path = p
+				return c.Redirect(http.StatusMovedPermanently, u.RequestURI())
+			}
+
+			for _, key := range config.keys(req.URL.Path) {
+				cond := Conditions{}
+				if !config.rewritten(key) {
+					cond = conditions(req)
+				}
+				cond.Path = req.URL.Path
+
+				if config.Precompressed {
+					addVary(c.Response().Header())
+
+					// variants are encoded so they can't be rewritten and ranges of them aren't useful
+					if cond.Range == "" && !config.rewritten(key) {
+						done, err := config.precompressed(c, key, cond)
+						if done || err != nil {
+							return err
+						}
+					}
+				}
+
+				large, err := config.large(ctx, key)
+				switch err {
+				case nil:
+				case ErrNotFound:
+					continue // try the next key
+				default:
+					log.Ctx(ctx).Error().Err(err).Str("key", key).Msg("failed to process s3 request")
+					return echo.NewHTTPError(http.StatusInternalServerError, "failed to process request")
+				}
+
+				if large {
+					return config.redirect(c, key)
+				}
+
+				start := time.Now()
+
+				obj, err := config.Store.Get(ctx, key, cond)
+				switch err {
+				case nil:
+				case ErrNotFound:
+					continue // try the next key
+				case ErrNotModified:
+					return config.unchanged(c, key)
+				case ErrRangeNotSatisfiable:
+					return echo.NewHTTPError(http.StatusRequestedRangeNotSatisfiable)
+				default:
+					log.Ctx(ctx).Error().Err(err).Str("key", key).Msg("failed to process s3 request")
+					return echo.NewHTTPError(http.StatusInternalServerError, "failed to process request")
+				}
+
+				defer obj.Body.Close()
+
+				log.Ctx(ctx).Info().
+					Str("key", key).
+					Str("etag", obj.ETag).
+					Str("cache", obj.CacheStatus).
+					Str("content_range", obj.ContentRange).
+					Int64("content_length", obj.ContentLength).
+					Dur("latency", time.Since(start)).
+					Msg("processed s3 request")
+
+				if config.rewritten(key) {
+					return config.rewrite(c, key, obj, http.StatusOK)
+				}
+
+				return config.serve(c, key, obj)
+			}
+
+			if config.DirectoryListing && config.Lister != nil && strings.HasSuffix(req.URL.Path, "/") {
+				return config.list(c, req.URL.Path)
+			}
+
+			if config.NotFound != "" {
+				return config.notFound(c)
+			}
+
+			return echo.NewHTTPError(http.StatusNotFound, "document not found")
+		}
+	}
+}
+
+// serve writes the object to the response, the body is streamed rather than buffered.
+func (config Config) serve(c echo.Context, key string, obj *Object) error {
+	h := c.Response().Header()
+	h.Set(echo.HeaderCacheControl, config.cacheControl(key))
+	h.Set("Accept-Ranges", "bytes")
+
+	if obj.ETag != "" {
+		h.Set("ETag", obj.ETag)
+	}
+	if !obj.LastModified.IsZero() {
+		h.Set(echo.HeaderLastModified, obj.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if obj.ContentLength > 0 {
+		h.Set(echo.HeaderContentLength, strconv.FormatInt(obj.ContentLength, 10))
+	}
+
+	status := http.StatusOK
+	if obj.ContentRange != "" {
+		h.Set("Content-Range", obj.ContentRange)
+		status = http.StatusPartialContent
+	}
+
+	if c.Request().Method == http.MethodHead {
+		h.Set(echo.HeaderContentType, obj.ContentType)
+		return c.NoContent(status)
+	}
+
+	return c.Stream(status, obj.ContentType, obj.Body)
+}
+
+// unchanged answers a conditional request with 304 Not Modified, the headers which would be sent with the object
+// are included so the client can update its copy. The store doesn't return the object when it is unchanged so the
+// ETag is only known when the client sent a single one, which must have matched. The Vary header is added before
+// the object is read when precompressed variants are served.
+func (config Config) unchanged(c echo.Context, key string) error {
+	h := c.Response().Header()
+	h.Set(echo.HeaderCacheControl, config.cacheControl(key))
+
+	if etag := c.Request().Header.Get("If-None-Match"); etag != "" && etag != "*" && !strings.Contains(etag, ",") {
+		h.Set("ETag", strings.TrimSpace(etag))
+	}
+
+	return c.NoContent(http.StatusNotModified)
+}
+
+// precompressed serves the variant of the object for the encoding accepted by the client, this reports
+// whether a response was written.
+func (config Config) precompressed(c echo.Context, key string, cond Conditions) (bool, error) {
+	ctx := c.Request().Context()
+
+	encoding := Negotiate(c.Request().Header.Get(echo.HeaderAcceptEncoding), []string{EncodingBrotli, EncodingGzip})
+	if encoding == "" {
+		return false, nil
+	}
+
+	variant := key + precompressedSuffixes[encoding]
+
+	// large variants are skipped so the object is redirected to instead, a presigned url wouldn't
+	// have the content encoding
+	large, err := config.large(ctx, variant)
+	switch err {
+	case nil:
+	case ErrNotFound:
+		return false, nil
+	default:
+		log.Ctx(ctx).Error().Err(err).Str("key", variant).Msg("failed to process s3 request")
+		return true, echo.NewHTTPError(http.StatusInternalServerError, "failed to process request")
+	}
+
+	if large {
+		return false, nil
+	}
+
+	obj, err := config.Store.Get(ctx, variant, cond)
+	switch err {
+	case nil:
+	case ErrNotFound:
+		return false, nil
+	case ErrNotModified:
+		return true, config.unchanged(c, key)
+	default:
+		log.Ctx(ctx).Error().Err(err).Str("key", variant).Msg("failed to process s3 request")
+		return true, echo.NewHTTPError(http.StatusInternalServerError, "failed to process request")
+	}
+
+	defer obj.Body.Close()
+
+	log.Ctx(ctx).Info().
+		Str("key", variant).
+		Str("etag", obj.ETag).
+		Str("cache", obj.CacheStatus).
+		Str("content_encoding", encoding).
+		Int64("content_length", obj.ContentLength).
+		Msg("processed s3 request")
+
+	// the variant is stored with the type of the compressed file rather than the content
+	if ct := mime.TypeByExtension(path.Ext(key)); ct != "" {
+		obj.ContentType = ct
+	}
+
+	c.Response().Header().Set(echo.HeaderContentEncoding, encoding)
+
+	return true, config.serve(c, key, obj)
+}
+
+// rewrite reads the whole document and applies the rewriters before writing the result.
+func (config Config) rewrite(c echo.Context, key string, obj *Object, status int) error {
+	ctx := c.Request().Context()
+
+	body, err := io.ReadAll(obj.Body)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("key", key).Msg("failed to read s3 object")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to process request")
+	}
+
+	for _, rw := range config.Rewrite {
+		body, err = rw(c, body)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("key", key).Msg("failed to rewrite document")
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to process request")
+		}
+	}
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "private, no-cache")
+
+	if c.Request().Method == http.MethodHead {
+		c.Response().Header().Set(echo.HeaderContentType, obj.ContentType)
+		return c.NoContent(status)
+	}
+
+	return c.Blob(status, obj.ContentType, body)
+}
+
+// notFound serves the not found document with a 404 status, the default error is used if it is missing.
+func (config Config) notFound(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	key := config.KeyPrefix + config.NotFound
+
+	obj, err := config.Store.Get(ctx, key, Conditions{Path: c.Request().URL.Path})
+	switch err {
+	case nil:
+	case ErrNotFound:
+		log.Ctx(ctx).Warn().Str("key", key).Msg("not found document is missing")
+		return echo.NewHTTPError(http.StatusNotFound, "document not found")
+	default:
+		log.Ctx(ctx).Error().Err(err).Str("key", key).Msg("failed to process s3 request")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to process request")
+	}
+
+	defer obj.Body.Close()
+
+	if config.rewritten(key) {
+		return config.rewrite(c, key, obj, http.StatusNotFound)
+	}
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "private, no-cache")
+
+	if c.Request().Method == http.MethodHead {
+		c.Response().Header().Set(echo.HeaderContentType, obj.ContentType)
+		return c.NoContent(http.StatusNotFound)
+	}
+
+	return c.Stream(http.StatusNotFound, obj.ContentType, obj.Body)
+}
+
+// rewritten reports whether the object is rewritten before it is served.
+func (config Config) rewritten(key string) bool {
+	if len(config.Rewrite) == 0 {
+		return false
+	}
+
+	switch strings.ToLower(path.Ext(key)) {
+	case ".html", ".htm":
+		return true
+	}
+
+	return false
+}
+
+// large reports whether the object is redirected to a presigned URL, the size is read before the object is opened
+// so the content of large objects isn't read by the proxy.
+func (config Config) large(ctx context.Context, key string) (bool, error) {
+	if config.LargeObjectSize <= 0 || config.Presigner == nil {
+		return false, nil
+	}
+
+	obj, err := config.Presigner.Head(ctx, key)
+	if err != nil {
+		return false, err
+	}
+
+	return obj.Size > config.LargeObjectSize, nil
+}
+
+// redirect sends the client to a presigned URL to read a large object directly from the bucket, this
+// is only reached once the user has been authorised.
+func (config Config) redirect(c echo.Context, key string) error {
+	ctx := c.Request().Context()
+
+	u, err := config.Presigner.Presign(key, config.PresignTTL)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("key", key).Msg("failed to presign s3 request")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to process request")
+	}
+
+	log.Ctx(ctx).Info().Str("key", key).Msg("redirected to presigned url")
+
+	// the url expires so it mustn't be reused
+	c.Response().Header().Set(echo.HeaderCacheControl, "private, no-store")
+
+	return c.Redirect(http.StatusTemporaryRedirect, u)
+}
+
+// keys returns the objects to try for the path in order
+func (config Config) keys(p string) []string {
+	key := strings.TrimPrefix(strings.TrimPrefix(p, config.PathPrefix), "/")
+
+	// if we let a directory key through to s3 it will return a xml listing for a GetObject call,
+	// so directories are served using their index.
+	dir := key == "" || strings.HasSuffix(key, "/")
+	if dir {
+		key += config.Index
+	}
+
+	keys := []string{config.KeyPrefix + key}
+
+	// pages and directories can be requested without the extension or trailing slash
+	if dir && config.CleanURLs && key != config.Index {
+		keys = append(keys, config.KeyPrefix+strings.TrimSuffix(key, "/"+config.Index)+".html")
+	}
+	if !dir && path.Ext(key) == "" {
+		if config.CleanURLs {
+			keys = append(keys, config.KeyPrefix+key+".html")
+		}
+		if config.CleanURLs || config.TrailingSlash == flags.TrailingSlashRemove {
+			keys = append(keys, config.KeyPrefix+key+"/"+config.Index)
+		}
+	}
+
+	if config.SPA && !config.DirectoryListing && key != config.Index && config.spaFallback(p) {
+		keys = append(keys, config.KeyPrefix+config.Index)
+	}
+
+	return keys
+}
+
+// spaFallback reports whether the index is served for a missing path
+func (config Config) spaFallback(p string) bool {
+	if config.SPAExtensionless && path.Ext(p) != "" {
+		return false
+	}
+
+	if len(config.SPAPaths) == 0 {
+		return true
+	}
+
+	for _, pattern := range config.SPAPaths {
+		if pathmatch.Match(pattern, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canonicalPath returns the path the request is redirected to by the clean url and trailing slash rules
+func (config Config) canonicalPath(p string) string {
+	if config.CleanURLs {
+		switch {
+		case strings.HasSuffix(p, "/"+config.Index):
+			p = strings.TrimSuffix(p, config.Index)
+		case strings.HasSuffix(p, ".html"):
+			p = strings.TrimSuffix(p, ".html")
+		}
+	}
+
+	// the root of the site always has a slash
+	root := p == "/" || p == config.PathPrefix+"/"
+
+	switch config.TrailingSlash {
+	case flags.TrailingSlashAdd:
+		if !strings.HasSuffix(p, "/") && path.Ext(p) == "" {
+			p += "/"
+		}
+	case flags.TrailingSlashRemove:
+		if strings.HasSuffix(p, "/") && !root {
+			p = strings.TrimSuffix(p, "/")
+		}
+	}
+
+	return p
+}
+
+// localPath reports whether a redirect to the path stays on this host, browsers treat a location starting with
+// // or /\ as a link to another host.
+func localPath(p string) bool {
+	return strings.HasPrefix(p, "/") && !strings.HasPrefix(p, "//") && !strings.HasPrefix(p, "/\\")
+}
+
+// requestPath returns the request path used to read the object key
+func (config Config) requestPath(key string) string {
+	return path.Join("/", config.PathPrefix, strings.TrimPrefix(key, config.KeyPrefix)) + trailingSlash(key)
+}
+
+func trailingSlash(key string) string {
+	if strings.HasSuffix(key, "/") {
+		return "/"
+	}
+
+	return ""
+}
+
+// cacheControl returns the Cache-Control header for the key using the first matching policy, content requires
+// a login so it is always private.
+func (config Config) cacheControl(key string) string {
+	value := DefaultCacheControl
+
+	for _, p := range config.CachePolicies {
+		if pathmatch.Match(p.Path, config.requestPath(key)) {
+			value = p.CacheControl
+			break
+		}
+	}
+
+	if strings.Contains(strings.ToLower(value), "private") {
+		return value
+	}
+
+	return "private, " + value
+}
+
+func conditions(req *http.Request) Conditions {
+	// compressed responses have a weak version of the object etag
+	cond := Conditions{IfNoneMatch: strings.TrimPrefix(req.Header.Get("If-None-Match"), "W/")}
+
+	if t, err := http.ParseTime(req.Header.Get(echo.HeaderIfModifiedSince)); err == nil {
+		cond.IfModifiedSince = t
+	}
+
+	// s3 only supports a single range, other ranges are ignored and the whole object is returned
+	if r := req.Header.Get("Range"); strings.HasPrefix(r, "bytes=") && !strings.Contains(r, ",") {
+		cond.Range = r
+		cond.IfRange = req.Header.Get("If-Range")
+	}
+
+	return cond
+}
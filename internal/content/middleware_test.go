@@ -0,0 +1,420 @@
+package content
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/website-openid-proxy/internal/flags"
+)
+
+var lastModified = time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC)
+
+type fakeStore struct {
+	objects map[string]string
+	etags   map[string]string
+	gets    []string
+}
+
+func (f *fakeStore) Get(ctx context.Context, key string, cond Conditions) (*Object, error) {
+	f.gets = append(f.gets, key)
+
+	body, ok := f.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	etag := `"` + key + `"`
+	if v, ok := f.etags[key]; ok {
+		etag = v
+	}
+
+	if cond.IfNoneMatch == etag || (cond.IfNoneMatch == "" && !cond.IfModifiedSince.Before(lastModified)) {
+		return nil, ErrNotModified
+	}
+
+	obj := &Object{
+		Key:           key,
+		ContentType:   "text/html",
+		ETag:          etag,
+		LastModified:  lastModified,
+		ContentLength: int64(len(body)),
+		Size:          int64(len(body)),
+	}
+
+	if cond.Range != "" && (cond.IfRange == "" || cond.IfRange == etag) {
+		var first, last int
+		if _, err := fmt.Sscanf(cond.Range, "bytes=%d-%d", &first, &last); err != nil || first >= len(body) {
+			return nil, ErrRangeNotSatisfiable
+		}
+		if last >= len(body) {
+			last = len(body) - 1
+		}
+
+		obj.ContentRange = fmt.Sprintf("bytes %d-%d/%d", first, last, len(body))
+		body = body[first : last+1]
+		obj.ContentLength = int64(len(body))
+	}
+
+	obj.Body = io.NopCloser(strings.NewReader(body))
+
+	return obj, nil
+}
+
+type fakePresigner struct {
+	store *fakeStore
+}
+
+func (fakePresigner) Presign(key string, ttl time.Duration) (string, error) {
+	return "https://website.s3.amazonaws.com/" + key + "?X-Amz-Expires=" + strconv.Itoa(int(ttl.Seconds())), nil
+}
+
+func (f fakePresigner) Head(ctx context.Context, key string) (*Object, error) {
+	body, ok := f.store.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &Object{Key: key, ContentLength: int64(len(body)), Size: int64(len(body))}, nil
+}
+
+func newConfig() (Config, *fakeStore) {
+	store := &fakeStore{objects: map[string]string{
+		"index.html":         "<html>index</html>",
+		"assets/app.abc.js":  "console.log('app')",
+		"guide/install.html": "<html>install</html>",
+	}}
+
+	return Config{
+		Store: store,
+		SPA:   true,
+		CachePolicies: []flags.CachePolicy{
+			{Path: "/assets/**", CacheControl: "max-age=31536000, immutable"},
+			{Path: "/index.html", CacheControl: "no-cache"},
+		},
+	}, store
+}
+
+func serve(config Config, req *http.Request) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.Use(MiddlewareWithConfig(config))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	assert := require.New(t)
+
+	config, _ := newConfig()
+
+	rec := serve(config, httptest.NewRequest(http.MethodGet, "/assets/app.abc.js", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("console.log('app')", rec.Body.String())
+	assert.Equal(`"assets/app.abc.js"`, rec.Header().Get("ETag"))
+	assert.Equal("Wed, 01 Mar 2023 10:00:00 GMT", rec.Header().Get(echo.HeaderLastModified))
+	assert.Equal("private, max-age=31536000, immutable", rec.Header().Get(echo.HeaderCacheControl))
+
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/guide/install.html", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("private, "+DefaultCacheControl, rec.Header().Get(echo.HeaderCacheControl))
+
+	rec = serve(config, httptest.NewRequest(http.MethodHead, "/guide/install.html", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Empty(rec.Body.String())
+	assert.Equal("20", rec.Header().Get(echo.HeaderContentLength))
+
+	rec = serve(config, httptest.NewRequest(http.MethodPost, "/guide/install.html", nil))
+	assert.Equal(http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestMiddleware_SPA(t *testing.T) {
+	assert := require.New(t)
+
+	config, store := newConfig()
+
+	rec := serve(config, httptest.NewRequest(http.MethodGet, "/users/123", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("<html>index</html>", rec.Body.String())
+	assert.Equal("private, no-cache", rec.Header().Get(echo.HeaderCacheControl))
+	assert.Equal([]string{"users/123", "index.html"}, store.gets)
+
+	config.SPA = false
+
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/users/123", nil))
+	assert.Equal(http.StatusNotFound, rec.Code)
+}
+
+func TestMiddleware_NotModified(t *testing.T) {
+	assert := require.New(t)
+
+	config, _ := newConfig()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", `"index.html"`)
+
+	rec := serve(config, req)
+	assert.Equal(http.StatusNotModified, rec.Code)
+	assert.Empty(rec.Body.String())
+	assert.Equal("private, no-cache", rec.Header().Get(echo.HeaderCacheControl))
+	assert.Equal(`"index.html"`, rec.Header().Get("ETag"))
+
+	// the etag of a compressed response is weak
+	req.Header.Set("If-None-Match", `W/"index.html"`)
+
+	rec = serve(config, req)
+	assert.Equal(http.StatusNotModified, rec.Code)
+	assert.Equal(`W/"index.html"`, rec.Header().Get("ETag"))
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderIfModifiedSince, "Wed, 01 Mar 2023 10:00:00 GMT")
+
+	rec = serve(config, req)
+	assert.Equal(http.StatusNotModified, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderIfModifiedSince, "Tue, 28 Feb 2023 10:00:00 GMT")
+
+	rec = serve(config, req)
+	assert.Equal(http.StatusOK, rec.Code)
+}
+
+func TestMiddleware_Range(t *testing.T) {
+	assert := require.New(t)
+
+	config, _ := newConfig()
+
+	req := httptest.NewRequest(http.MethodGet, "/guide/install.html", nil)
+	req.Header.Set("Range", "bytes=6-12")
+
+	rec := serve(config, req)
+	assert.Equal(http.StatusPartialContent, rec.Code)
+	assert.Equal("install", rec.Body.String())
+	assert.Equal("bytes 6-12/20", rec.Header().Get("Content-Range"))
+	assert.Equal("7", rec.Header().Get(echo.HeaderContentLength))
+	assert.Equal("bytes", rec.Header().Get("Accept-Ranges"))
+
+	// the object has changed so all of it is returned
+	req = httptest.NewRequest(http.MethodGet, "/guide/install.html", nil)
+	req.Header.Set("Range", "bytes=6-12")
+	req.Header.Set("If-Range", `"old"`)
+
+	rec = serve(config, req)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("<html>install</html>", rec.Body.String())
+
+	// multiple ranges aren't supported
+	req = httptest.NewRequest(http.MethodGet, "/guide/install.html", nil)
+	req.Header.Set("Range", "bytes=0-1,6-12")
+
+	rec = serve(config, req)
+	assert.Equal(http.StatusOK, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/guide/install.html", nil)
+	req.Header.Set("Range", "bytes=100-200")
+
+	rec = serve(config, req)
+	assert.Equal(http.StatusRequestedRangeNotSatisfiable, rec.Code)
+}
+
+func TestMiddleware_LargeObject(t *testing.T) {
+	assert := require.New(t)
+
+	config, store := newConfig()
+	config.Presigner = fakePresigner{store: store}
+	config.LargeObjectSize = 18
+
+	rec := serve(config, httptest.NewRequest(http.MethodGet, "/guide/install.html", nil))
+	assert.Equal(http.StatusTemporaryRedirect, rec.Code)
+	assert.Equal("https://website.s3.amazonaws.com/guide/install.html?X-Amz-Expires=60", rec.Header().Get(echo.HeaderLocation))
+	assert.Equal("private, no-store", rec.Header().Get(echo.HeaderCacheControl))
+
+	// the large object is never opened
+	assert.Empty(store.gets)
+
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+}
+
+func TestMiddleware_Prefix(t *testing.T) {
+	assert := require.New(t)
+
+	config, store := newConfig()
+	config.PathPrefix = "/docs"
+	config.KeyPrefix = "guide/"
+	config.Index = "install.html"
+	config.CachePolicies = []flags.CachePolicy{{Path: "/docs/install.html", CacheControl: "max-age=60"}}
+
+	rec := serve(config, httptest.NewRequest(http.MethodGet, "/docs/", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("<html>install</html>", rec.Body.String())
+	assert.Equal("private, max-age=60", rec.Header().Get(echo.HeaderCacheControl))
+
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/docs/missing", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal([]string{"guide/install.html", "guide/missing", "guide/install.html"}, store.gets)
+
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Equal(http.StatusMovedPermanently, rec.Code)
+	assert.Equal("/docs/", rec.Header().Get(echo.HeaderLocation))
+
+	// dot segments can't escape the key prefix
+	store.gets = nil
+
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/docs/%2e%2e/index.html", nil))
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Empty(store.gets)
+}
+
+func TestMiddleware_Rewrite(t *testing.T) {
+	assert := require.New(t)
+
+	config, _ := newConfig()
+	config.Rewrite = []Rewriter{
+		func(c echo.Context, body []byte) ([]byte, error) {
+			return []byte(strings.Replace(string(body), "index", "rewritten", 1)), nil
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", `"index.html"`)
+	req.Header.Set("Range", "bytes=0-4")
+
+	rec := serve(config, req)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("<html>rewritten</html>", rec.Body.String())
+	assert.Equal("private, no-cache", rec.Header().Get(echo.HeaderCacheControl))
+	assert.Empty(rec.Header().Get("ETag"))
+	assert.Empty(rec.Header().Get(echo.HeaderLastModified))
+
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/assets/app.abc.js", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("console.log('app')", rec.Body.String())
+	assert.Equal(`"assets/app.abc.js"`, rec.Header().Get("ETag"))
+}
+
+func TestMiddleware_SPAFallback(t *testing.T) {
+	assert := require.New(t)
+
+	config, _ := newConfig()
+	config.SPAExtensionless = true
+	config.SPAPaths = []string{"/app/**"}
+
+	rec := serve(config, httptest.NewRequest(http.MethodGet, "/app/users/123", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("<html>index</html>", rec.Body.String())
+
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/app/assets/missing.js", nil))
+	assert.Equal(http.StatusNotFound, rec.Code)
+
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/blog/post", nil))
+	assert.Equal(http.StatusNotFound, rec.Code)
+}
+
+func TestMiddleware_NotFound(t *testing.T) {
+	assert := require.New(t)
+
+	config, store := newConfig()
+	config.SPA = false
+	config.NotFound = "404.html"
+
+	rec := serve(config, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	assert.Equal(http.StatusNotFound, rec.Code)
+	assert.Contains(rec.Body.String(), "document not found")
+
+	store.objects["404.html"] = "<html>not found</html>"
+
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	assert.Equal(http.StatusNotFound, rec.Code)
+	assert.Equal("<html>not found</html>", rec.Body.String())
+	assert.Equal("private, no-cache", rec.Header().Get(echo.HeaderCacheControl))
+	assert.Empty(rec.Header().Get("ETag"))
+
+	config.Rewrite = []Rewriter{
+		func(c echo.Context, body []byte) ([]byte, error) {
+			return []byte(strings.Replace(string(body), "not found", "rewritten", 1)), nil
+		},
+	}
+
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	assert.Equal(http.StatusNotFound, rec.Code)
+	assert.Equal("<html>rewritten</html>", rec.Body.String())
+}
+
+func TestMiddleware_CleanURLs(t *testing.T) {
+	assert := require.New(t)
+
+	config, store := newConfig()
+	config.SPA = false
+	config.CleanURLs = true
+	store.objects["guide/index.html"] = "<html>guide</html>"
+
+	rec := serve(config, httptest.NewRequest(http.MethodGet, "/guide/install", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("<html>install</html>", rec.Body.String())
+
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/guide", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("<html>guide</html>", rec.Body.String())
+
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/guide/install.html?v=1", nil))
+	assert.Equal(http.StatusMovedPermanently, rec.Code)
+	assert.Equal("/guide/install?v=1", rec.Header().Get(echo.HeaderLocation))
+
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/guide/index.html", nil))
+	assert.Equal(http.StatusMovedPermanently, rec.Code)
+	assert.Equal("/guide/", rec.Header().Get(echo.HeaderLocation))
+
+	// encoded slashes must not redirect to another host
+	for _, target := range []string{"/%2Fevil.com/x.html", "/%5Cevil.com/x.html"} {
+		rec = serve(config, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(http.StatusBadRequest, rec.Code, target)
+		assert.Empty(rec.Header().Get(echo.HeaderLocation), target)
+	}
+}
+
+func TestMiddleware_TrailingSlash(t *testing.T) {
+	assert := require.New(t)
+
+	config, store := newConfig()
+	config.SPA = false
+	config.TrailingSlash = flags.TrailingSlashRemove
+	store.objects["guide/index.html"] = "<html>guide</html>"
+
+	rec := serve(config, httptest.NewRequest(http.MethodGet, "/guide/", nil))
+	assert.Equal(http.StatusMovedPermanently, rec.Code)
+	assert.Equal("/guide", rec.Header().Get(echo.HeaderLocation))
+
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/guide", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("<html>guide</html>", rec.Body.String())
+
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+
+	// encoded slashes must not redirect to another host
+	for _, target := range []string{"/%2Fevil.com/", "/%5Cevil.com/"} {
+		rec = serve(config, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(http.StatusBadRequest, rec.Code, target)
+		assert.Empty(rec.Header().Get(echo.HeaderLocation), target)
+	}
+
+	config.TrailingSlash = flags.TrailingSlashAdd
+
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/guide", nil))
+	assert.Equal(http.StatusMovedPermanently, rec.Code)
+	assert.Equal("/guide/", rec.Header().Get(echo.HeaderLocation))
+
+	rec = serve(config, httptest.NewRequest(http.MethodGet, "/guide/install.html", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+}
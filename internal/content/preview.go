@@ -0,0 +1,46 @@
+package content
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// previews renders an index of the preview builds, each is a folder of the key prefix
+func (config Config) previews(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if config.Lister == nil || config.PreviewURL == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "document not found")
+	}
+
+	listing, err := config.Lister.List(ctx, config.KeyPrefix, c.QueryParam("page"), config.ListPageSize)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("prefix", config.KeyPrefix).Msg("failed to list previews")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to process request")
+	}
+
+	listing.Path = c.Request().URL.Path
+
+	// only folders are previews, these link to the preview using the host or path
+	entries := listing.Entries[:0]
+	for _, entry := range listing.Entries {
+		if !entry.Dir {
+			continue
+		}
+
+		if config.ListFilter != nil && !config.ListFilter(c, config.requestPath(strings.TrimPrefix(entry.Path, "/"))) {
+			continue
+		}
+
+		entry.Name = strings.TrimSuffix(entry.Name, "/")
+		entry.Path = config.PreviewURL(c, entry.Name)
+
+		entries = append(entries, entry)
+	}
+	listing.Entries = entries
+
+	return render(c, listing)
+}
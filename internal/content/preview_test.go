@@ -0,0 +1,75 @@
+package content
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+type previewLister struct{}
+
+func (previewLister) List(ctx context.Context, prefix, token string, limit int) (*Listing, error) {
+	return &Listing{
+		Path: "/" + prefix,
+		Entries: []Entry{
+			{Name: "pr-1/", Path: "/guide/pr-1/", Dir: true},
+			{Name: "pr-2/", Path: "/guide/pr-2/", Dir: true},
+			{Name: "secret/", Path: "/guide/secret/", Dir: true},
+			{Name: "README.md", Path: "/guide/README.md", Size: 10},
+		},
+	}, nil
+}
+
+func TestMiddleware_Preview(t *testing.T) {
+	assert := require.New(t)
+
+	config, store := newConfig()
+	config.Lister = previewLister{}
+	config.Index = "install.html"
+	config.KeyPrefix = "guide/"
+	config.ListFilter = func(c echo.Context, p string) bool {
+		return p != "/secret/"
+	}
+	config.Preview = func(c echo.Context) (string, string, bool) {
+		name := strings.SplitN(c.Request().Host, ".", 2)[0]
+		if name == "preview" {
+			return "", "", false
+		}
+		return "", "guide/" + name + "/", true
+	}
+	config.PreviewURL = func(c echo.Context, name string) string {
+		return "https://" + name + ".preview.example.com/"
+	}
+
+	store.objects["guide/pr-1/install.html"] = "<html>pr-1</html>"
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "pr-1.preview.example.com"
+
+	rec := serve(config, req)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("<html>pr-1</html>", rec.Body.String())
+
+	// the spa fallback stays within the preview
+	req = httptest.NewRequest(http.MethodGet, "/users/123", nil)
+	req.Host = "pr-1.preview.example.com"
+
+	rec = serve(config, req)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("<html>pr-1</html>", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "preview.example.com"
+
+	rec = serve(config, req)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), `<a href="https://pr-1.preview.example.com/">pr-1</a>`)
+	assert.Contains(rec.Body.String(), `<a href="https://pr-2.preview.example.com/">pr-2</a>`)
+	assert.NotContains(rec.Body.String(), "secret")
+	assert.NotContains(rec.Body.String(), "README.md")
+}
@@ -0,0 +1,217 @@
+package content
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/rs/zerolog/log"
+	"github.com/wolfeidau/website-openid-proxy/internal/rules"
+)
+
+// DefaultRulesRefreshInterval how often the rules file is checked for changes
+const DefaultRulesRefreshInterval = time.Minute
+
+// RulesConfig defines the config for the rules middleware.
+type RulesConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Rules from the configuration, these are matched before the rules file.
+	Rules []rules.Rule
+
+	// Store and Key of the rules file, this is reloaded when its ETag changes.
+	Store Store
+	Key   string
+
+	// RefreshInterval how often the rules file is checked for changes, defaults to DefaultRulesRefreshInterval.
+	RefreshInterval time.Duration
+
+	// PathPrefix the rules match paths relative to the root of the site, the prefix is added to the targets.
+	PathPrefix string
+
+	// Authorize reports whether the user can access the target of a rewrite, as access was only checked
+	// for the request path. Defaults to allowing all targets.
+	Authorize func(c echo.Context, p string) bool
+
+	// Now returns the current time, defaults to time.Now.
+	Now func() time.Time
+}
+
+// RulesWithConfig returns a middleware which redirects or rewrites requests matching the rules before they reach
+// the content middleware, the first matching rule is used.
+func RulesWithConfig(config RulesConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.RefreshInterval == 0 {
+		config.RefreshInterval = DefaultRulesRefreshInterval
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	file := &ruleFile{config: config}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			ctx := req.Context()
+
+			p := strings.TrimPrefix(req.URL.Path, config.PathPrefix)
+			if p == "" {
+				p = "/"
+			}
+
+			matching := config.Rules
+			if config.Store != nil && config.Key != "" {
+				matching = append(matching[:len(matching):len(matching)], file.load(ctx)...)
+			}
+
+			for _, rule := range matching {
+				to, ok := rule.Match(p)
+				if !ok {
+					continue
+				}
+
+				// targets on the site are relative to the prefix, they are cleaned as the substituted values could
+				// add dot or empty segments
+				site := strings.HasPrefix(rule.To, "/") && !strings.HasPrefix(rule.To, "//")
+				if site {
+					to = config.PathPrefix + cleanTarget(to)
+				}
+
+				if rule.Redirect() {
+					// the substituted values must not turn the location into a link to another host
+					if site && !localPath(to) {
+						log.Ctx(ctx).Warn().Str("from", rule.From).Str("to", to).Msg("redirect target denied")
+						return echo.NewHTTPError(http.StatusBadRequest, "invalid path")
+					}
+
+					log.Ctx(ctx).Info().Str("from", rule.From).Str("to", to).Msg("redirected request")
+					return c.Redirect(rule.RedirectStatus(), ruleTarget(to, req.URL.RawQuery))
+				}
+
+				// the query of the target replaces the query of the request
+				p, query, hasQuery := strings.Cut(to, "?")
+
+				if config.Authorize != nil && !config.Authorize(c, p) {
+					log.Ctx(ctx).Warn().Str("from", rule.From).Str("to", to).Msg("rewrite target denied")
+					return c.String(http.StatusForbidden, "access denied")
+				}
+
+				log.Ctx(ctx).Info().Str("from", rule.From).Str("to", to).Msg("rewrote request")
+
+				req.URL.Path = p
+				req.URL.RawPath = ""
+				if hasQuery {
+					req.URL.RawQuery = query
+				}
+
+				break
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// ruleFile holds the rules read from the store, the file is checked for changes once the refresh interval
+// has passed and the previous rules are kept if it can't be read.
+type ruleFile struct {
+	config RulesConfig
+
+	mu      sync.Mutex
+	rules   []rules.Rule
+	etag    string
+	checked time.Time
+}
+
+func (f *ruleFile) load(ctx context.Context) []rules.Rule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.config.Now()
+
+	if !f.checked.IsZero() && now.Sub(f.checked) < f.config.RefreshInterval {
+		return f.rules
+	}
+
+	f.checked = now
+
+	obj, err := f.config.Store.Get(ctx, f.config.Key, Conditions{IfNoneMatch: f.etag})
+	switch err {
+	case nil:
+	case ErrNotModified:
+		return f.rules
+	case ErrNotFound:
+		f.rules, f.etag = nil, ""
+		return f.rules
+	default:
+		log.Ctx(ctx).Error().Err(err).Str("key", f.config.Key).Msg("failed to read rules")
+		return f.rules
+	}
+
+	defer obj.Body.Close()
+
+	data, err := io.ReadAll(obj.Body)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("key", f.config.Key).Msg("failed to read rules")
+		return f.rules
+	}
+
+	parsed, err := rules.Parse(f.config.Key, data)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("key", f.config.Key).Msg("failed to parse rules")
+		return f.rules
+	}
+
+	log.Ctx(ctx).Info().Str("key", f.config.Key).Str("etag", obj.ETag).Int("rules", len(parsed)).Msg("loaded rules")
+
+	f.rules, f.etag = parsed, obj.ETag
+
+	return f.rules
+}
+
+// cleanTarget removes dot and empty segments from the path of a target, the query is left as is
+func cleanTarget(to string) string {
+	p, query, hasQuery := strings.Cut(to, "?")
+
+	clean := path.Clean(p)
+	if clean != "/" && strings.HasSuffix(p, "/") {
+		clean += "/"
+	}
+
+	if hasQuery {
+		clean += "?" + query
+	}
+
+	return clean
+}
+
+// ruleTarget returns the location of the target with the query of the request added if the target doesn't have one
+func ruleTarget(to string, query string) string {
+	if query == "" {
+		return to
+	}
+
+	u, err := url.Parse(to)
+	if err != nil || u.RawQuery != "" {
+		return to
+	}
+
+	u.RawQuery = query
+
+	return u.String()
+}
@@ -0,0 +1,161 @@
+package content
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/website-openid-proxy/internal/rules"
+)
+
+func TestRules(t *testing.T) {
+	assert := require.New(t)
+
+	config, store := newConfig()
+	config.PathPrefix = "/docs"
+
+	store.objects["_redirects"] = "/news/* /blog/:splat 302\n/start /guide/install.html 200!\n/admin /admin/index.html 200!"
+
+	now := time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	e := echo.New()
+	e.Use(RulesWithConfig(RulesConfig{
+		Rules: []rules.Rule{
+			{From: "/old", To: "https://example.com/new"},
+			{From: "/view/*", To: "/public/:splat", Status: rules.StatusRewrite, Force: true},
+			{From: "/search/:term", To: "/guide/install.html?q=:term", Status: rules.StatusRewrite, Force: true},
+			{From: "/go/*", To: "/:splat", Status: http.StatusFound},
+		},
+		Store:      store,
+		Key:        "_redirects",
+		PathPrefix: "/docs",
+		Authorize: func(c echo.Context, p string) bool {
+			return p != "/docs/admin/index.html"
+		},
+		Now: func() time.Time { return now },
+	}))
+	e.Use(MiddlewareWithConfig(config))
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	rec := serve("/docs/old?ref=home")
+	assert.Equal(http.StatusMovedPermanently, rec.Code)
+	assert.Equal("https://example.com/new?ref=home", rec.Header().Get(echo.HeaderLocation))
+
+	rec = serve("/docs/news/2023/post")
+	assert.Equal(http.StatusFound, rec.Code)
+	assert.Equal("/docs/blog/2023/post", rec.Header().Get(echo.HeaderLocation))
+
+	rec = serve("/docs/start")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("<html>install</html>", rec.Body.String())
+
+	rec = serve("/docs/admin")
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	// the query of the target isn't part of the path
+	rec = serve("/docs/search/install?page=2")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("<html>install</html>", rec.Body.String())
+
+	// substituted values are cleaned before the target is authorized
+	rec = serve("/docs/view/%2e%2e/admin/index.html")
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = serve("/docs/go/guide//install.html")
+	assert.Equal(http.StatusFound, rec.Code)
+	assert.Equal("/docs/guide/install.html", rec.Header().Get(echo.HeaderLocation))
+
+	// the file is only checked for changes once the refresh interval has passed
+	store.objects["_redirects"] = "/start /index.html 200!"
+	store.etags = map[string]string{"_redirects": `"v2"`}
+
+	rec = serve("/docs/start")
+	assert.Equal("<html>install</html>", rec.Body.String())
+
+	now = now.Add(DefaultRulesRefreshInterval)
+
+	rec = serve("/docs/start")
+	assert.Equal("<html>index</html>", rec.Body.String())
+
+	// invalid files keep the previous rules
+	store.objects["_redirects"] = "/start"
+	store.etags["_redirects"] = `"v3"`
+	now = now.Add(DefaultRulesRefreshInterval)
+
+	rec = serve("/docs/start")
+	assert.Equal("<html>index</html>", rec.Body.String())
+
+	delete(store.objects, "_redirects")
+	now = now.Add(DefaultRulesRefreshInterval)
+
+	rec = serve("/docs/start")
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("<html>index</html>", rec.Body.String())
+	rec = serve("/docs/news/2023/post")
+	assert.Equal(http.StatusOK, rec.Code)
+}
+
+func TestRules_RedirectHost(t *testing.T) {
+	e := echo.New()
+	e.Use(RulesWithConfig(RulesConfig{
+		Rules: []rules.Rule{{From: "/go/*", To: "/:splat", Status: http.StatusFound}},
+	}))
+
+	tests := []struct {
+		target   string
+		code     int
+		location string
+	}{
+		{target: "/go//evil.com", code: http.StatusFound, location: "/evil.com"},
+		{target: "/go/%2Fevil.com", code: http.StatusFound, location: "/evil.com"},
+		{target: "/go/%5Cevil.com", code: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			assert := require.New(t)
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			assert.Equal(tt.code, rec.Code)
+			assert.Equal(tt.location, rec.Header().Get(echo.HeaderLocation))
+		})
+	}
+}
+
+func TestRules_RewriteQuery(t *testing.T) {
+	assert := require.New(t)
+
+	e := echo.New()
+	e.Use(RulesWithConfig(RulesConfig{
+		Rules: []rules.Rule{
+			{From: "/search/:term", To: "/search.html?q=:term", Status: rules.StatusRewrite, Force: true},
+			{From: "/app/*", To: "/app/index.html", Status: rules.StatusRewrite, Force: true},
+		},
+		Authorize: func(c echo.Context, p string) bool {
+			return p == "/search.html" || p == "/app/index.html"
+		},
+	}))
+	e.GET("/*", func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Request().URL.RequestURI())
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search/install?page=2", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("/search.html?q=install", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/app/settings?tab=2", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("/app/index.html?tab=2", rec.Body.String())
+}
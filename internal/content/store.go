@@ -0,0 +1,230 @@
+package content
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+var (
+	// ErrNotFound the object doesn't exist
+	ErrNotFound = errors.New("object not found")
+
+	// ErrNotModified the object matches the conditions supplied by the client
+	ErrNotModified = errors.New("object not modified")
+
+	// ErrRangeNotSatisfiable the requested range is outside the object
+	ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+
+	// errPreconditionFailed the If-Range condition didn't match so the range is ignored
+	errPreconditionFailed = errors.New("precondition failed")
+)
+
+// Object the attributes and content of an object
+type Object struct {
+	Key           string
+	ContentType   string
+	ETag          string
+	LastModified  time.Time
+	ContentLength int64
+	Body          io.ReadCloser
+
+	// ContentRange is set when the body only contains part of the object.
+	ContentRange string
+
+	// Size of the whole object, this differs from ContentLength for ranges.
+	Size int64
+
+	// CacheStatus records how the object was served when it is read through a cache.
+	CacheStatus string
+}
+
+// Conditions are passed on from the client request so unchanged objects aren't read again
+type Conditions struct {
+	IfNoneMatch     string
+	IfModifiedSince time.Time
+
+	// Range of bytes requested, only a single range is supported.
+	Range string
+
+	// IfRange the range is only returned if the object still has this ETag or Last-Modified date,
+	// otherwise the whole object is returned.
+	IfRange string
+
+	// Path of the request the object is read for, this isn't sent to the store but is used by the cache to
+	// match the excluded paths as the key has the key prefix of the site or preview.
+	Path string
+}
+
+// Store reads objects
+type Store interface {
+	Get(ctx context.Context, key string, cond Conditions) (*Object, error)
+}
+
+// Presigner creates URLs which allow the object to be read directly from the store, Head reads the size of an
+// object without opening its content so large objects can be redirected before they are read.
+type Presigner interface {
+	Presign(key string, ttl time.Duration) (string, error)
+	Head(ctx context.Context, key string) (*Object, error)
+}
+
+// Bucket reads objects from an S3 bucket
+type Bucket struct {
+	s3svc  s3iface.S3API
+	bucket string
+}
+
+var (
+	_ Store     = &Bucket{}
+	_ Presigner = &Bucket{}
+)
+
+// NewBucket create a new store reading objects from the bucket
+func NewBucket(awscfg *aws.Config, bucket string) *Bucket {
+	sess := session.Must(session.NewSession(awscfg))
+
+	// keys are used as is, otherwise dot segments in a key would be resolved to another object
+	return &Bucket{
+		s3svc:  s3.New(sess, &aws.Config{DisableRestProtocolURICleaning: aws.Bool(true)}),
+		bucket: bucket,
+	}
+}
+
+// Get returns the object, ErrNotFound is returned if it doesn't exist and ErrNotModified if the conditions
+// match the current version of the object.
+func (b *Bucket) Get(ctx context.Context, key string, cond Conditions) (*Object, error) {
+	obj, err := b.get(ctx, key, cond)
+	if err == errPreconditionFailed {
+		// the object has changed since the client read the first part so send all of it
+		cond.Range, cond.IfRange = "", ""
+		return b.get(ctx, key, cond)
+	}
+
+	return obj, err
+}
+
+// Presign returns a URL which can be used to read the object until the ttl expires
+func (b *Bucket) Presign(key string, ttl time.Duration) (string, error) {
+	req, _ := b.s3svc.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+
+	return req.Presign(ttl)
+}
+
+// Head returns the attributes of the object without its content, ErrNotFound is returned if it doesn't exist.
+func (b *Bucket) Head(ctx context.Context, key string) (*Object, error) {
+	res, err := b.s3svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return &Object{
+		Key:           key,
+		ContentType:   aws.StringValue(res.ContentType),
+		ETag:          aws.StringValue(res.ETag),
+		LastModified:  aws.TimeValue(res.LastModified),
+		ContentLength: aws.Int64Value(res.ContentLength),
+		Size:          aws.Int64Value(res.ContentLength),
+	}, nil
+}
+
+func (b *Bucket) get(ctx context.Context, key string, cond Conditions) (*Object, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	}
+
+	// if-none-match takes precedence over if-modified-since
+	if cond.IfNoneMatch != "" {
+		input.IfNoneMatch = aws.String(cond.IfNoneMatch)
+	} else if !cond.IfModifiedSince.IsZero() {
+		input.IfModifiedSince = aws.Time(cond.IfModifiedSince)
+	}
+
+	if cond.Range != "" {
+		input.Range = aws.String(cond.Range)
+
+		// s3 doesn't support if-range so it is mapped to a precondition, when this fails the
+		// request is retried without the range
+		if strings.HasPrefix(cond.IfRange, `"`) {
+			input.IfMatch = aws.String(cond.IfRange)
+		} else if t, err := http.ParseTime(cond.IfRange); err == nil {
+			input.IfUnmodifiedSince = aws.Time(t)
+		}
+	}
+
+	res, err := b.s3svc.GetObjectWithContext(ctx, input)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	obj := &Object{
+		Key:           key,
+		ContentType:   aws.StringValue(res.ContentType),
+		ETag:          aws.StringValue(res.ETag),
+		LastModified:  aws.TimeValue(res.LastModified),
+		ContentLength: aws.Int64Value(res.ContentLength),
+		ContentRange:  aws.StringValue(res.ContentRange),
+		Body:          res.Body,
+	}
+
+	obj.Size = rangeSize(obj.ContentRange, obj.ContentLength)
+
+	return obj, nil
+}
+
+// rangeSize returns the size of the whole object from a content range such as "bytes 0-99/1234"
+func rangeSize(contentRange string, contentLength int64) int64 {
+	if contentRange == "" {
+		return contentLength
+	}
+
+	i := strings.LastIndex(contentRange, "/")
+	if i < 0 {
+		return contentLength
+	}
+
+	size, err := strconv.ParseInt(contentRange[i+1:], 10, 64)
+	if err != nil {
+		return contentLength
+	}
+
+	return size
+}
+
+func convertError(err error) error {
+	if rerr, ok := err.(awserr.RequestFailure); ok {
+		switch rerr.StatusCode() {
+		case http.StatusNotModified:
+			return ErrNotModified
+		case http.StatusPreconditionFailed:
+			return errPreconditionFailed
+		case http.StatusRequestedRangeNotSatisfiable:
+			return ErrRangeNotSatisfiable
+		}
+	}
+
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound":
+			return ErrNotFound
+		}
+	}
+
+	return err
+}
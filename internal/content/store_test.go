@@ -0,0 +1,148 @@
+package content
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeS3 struct {
+	s3iface.S3API
+	input *s3.GetObjectInput
+	err   error
+}
+
+func (f *fakeS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	f.input = input
+
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	return &s3.GetObjectOutput{
+		ContentType:   aws.String("text/html"),
+		ETag:          aws.String(`"abc"`),
+		LastModified:  aws.Time(lastModified),
+		ContentLength: aws.Int64(5),
+		Body:          io.NopCloser(strings.NewReader("hello")),
+	}, nil
+}
+
+func (f *fakeS3) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	return &s3.HeadObjectOutput{
+		ContentType:   aws.String("video/mp4"),
+		ETag:          aws.String(`"abc"`),
+		LastModified:  aws.Time(lastModified),
+		ContentLength: aws.Int64(1234),
+	}, nil
+}
+
+func TestBucket_Get(t *testing.T) {
+	assert := require.New(t)
+
+	fake := &fakeS3{}
+	b := &Bucket{s3svc: fake, bucket: "website"}
+
+	obj, err := b.Get(context.TODO(), "index.html", Conditions{IfNoneMatch: `"xyz"`, IfModifiedSince: time.Now()})
+	assert.NoError(err)
+	assert.Equal(`"abc"`, obj.ETag)
+	assert.Equal(lastModified, obj.LastModified)
+	assert.Equal(`"xyz"`, aws.StringValue(fake.input.IfNoneMatch))
+	assert.Nil(fake.input.IfModifiedSince)
+
+	fake.err = awserr.NewRequestFailure(awserr.New("NotModified", "not modified", nil), http.StatusNotModified, "req")
+
+	_, err = b.Get(context.TODO(), "index.html", Conditions{IfNoneMatch: `"abc"`})
+	assert.Equal(ErrNotModified, err)
+
+	fake.err = awserr.New(s3.ErrCodeNoSuchKey, "missing", nil)
+
+	_, err = b.Get(context.TODO(), "missing.html", Conditions{})
+	assert.Equal(ErrNotFound, err)
+
+	fake.err = errors.New("boom")
+
+	_, err = b.Get(context.TODO(), "index.html", Conditions{})
+	assert.EqualError(err, "boom")
+}
+
+func TestBucket_GetRange(t *testing.T) {
+	assert := require.New(t)
+
+	fake := &fakeS3{}
+	b := &Bucket{s3svc: fake, bucket: "website"}
+
+	_, err := b.Get(context.TODO(), "video.mp4", Conditions{Range: "bytes=0-99", IfRange: `"abc"`})
+	assert.NoError(err)
+	assert.Equal("bytes=0-99", aws.StringValue(fake.input.Range))
+	assert.Equal(`"abc"`, aws.StringValue(fake.input.IfMatch))
+
+	_, err = b.Get(context.TODO(), "video.mp4", Conditions{Range: "bytes=0-99", IfRange: "Wed, 01 Mar 2023 10:00:00 GMT"})
+	assert.NoError(err)
+	assert.Equal(lastModified, aws.TimeValue(fake.input.IfUnmodifiedSince))
+
+	fake.err = awserr.NewRequestFailure(awserr.New("InvalidRange", "invalid range", nil), http.StatusRequestedRangeNotSatisfiable, "req")
+
+	_, err = b.Get(context.TODO(), "video.mp4", Conditions{Range: "bytes=1000-"})
+	assert.Equal(ErrRangeNotSatisfiable, err)
+}
+
+func TestBucket_Head(t *testing.T) {
+	assert := require.New(t)
+
+	fake := &fakeS3{}
+	b := &Bucket{s3svc: fake, bucket: "website"}
+
+	obj, err := b.Head(context.TODO(), "video.mp4")
+	assert.NoError(err)
+	assert.Equal(int64(1234), obj.Size)
+	assert.Equal(`"abc"`, obj.ETag)
+	assert.Nil(obj.Body)
+
+	fake.err = awserr.NewRequestFailure(awserr.New("NotFound", "not found", nil), http.StatusNotFound, "req")
+
+	_, err = b.Head(context.TODO(), "missing.mp4")
+	assert.Equal(ErrNotFound, err)
+}
+
+func TestBucket_Presign(t *testing.T) {
+	assert := require.New(t)
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	}))
+
+	b := &Bucket{s3svc: s3.New(sess), bucket: "website"}
+
+	u, err := b.Presign("video.mp4", time.Minute)
+	assert.NoError(err)
+	assert.Contains(u, "website")
+	assert.Contains(u, "video.mp4")
+	assert.Contains(u, "X-Amz-Expires=60")
+}
+
+func TestRangeSize(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal(int64(1234), rangeSize("bytes 0-99/1234", 100))
+	assert.Equal(int64(100), rangeSize("", 100))
+	assert.Equal(int64(100), rangeSize("bytes 0-99/*", 100))
+}
@@ -2,39 +2,671 @@ package flags
 
 import (
 	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/alecthomas/kong"
+	"github.com/wolfeidau/website-openid-proxy/internal/pathmatch"
+	"github.com/wolfeidau/website-openid-proxy/internal/ratelimit"
+	"github.com/wolfeidau/website-openid-proxy/internal/rules"
 )
 
 // API api related flags passing in env variables
 type API struct {
 	Version          kong.VersionFlag
-	AppName          string `help:"Stage the name of the service." env:"APP_NAME"`
-	Stage            string `help:"Stage the software is deployed." env:"STAGE"`
-	Branch           string `help:"Branch used to build software." env:"BRANCH"`
-	ClientID         string `help:"The client identifier for the openid client." env:"CLIENT_ID"`
-	ClientSecret     string `help:"The client secret for the openid client" env:"CLIENT_SECRET"`
-	Issuer           string `help:"The openid issuer." env:"ISSUER"`
-	RedirectURL      string `help:"The redirect URL used for callbacks." env:"REDIRECT_URL"`
-	SessionSecretArn string `help:"The ARN of the secret used to sign sessions." env:"SESSION_SECRET_ARN"`
-	WebsiteBucket    string `help:"The name of the website S3 bucket holding content to be served." env:"WEBSITE_BUCKET"`
+	ConfigFile       kong.ConfigFlag `name:"config" help:"Load configuration from a YAML or JSON file." env:"CONFIG_FILE"`
+	AppName          string          `help:"Stage the name of the service." env:"APP_NAME"`
+	Stage            string          `help:"Stage the software is deployed." env:"STAGE"`
+	Branch           string          `help:"Branch used to build software." env:"BRANCH"`
+	ClientID         string          `help:"The client identifier for the openid client." env:"CLIENT_ID"`
+	ClientSecret     string          `help:"The client secret for the openid client" env:"CLIENT_SECRET" secret:""`
+	Issuer           string          `help:"The openid issuer." env:"ISSUER"`
+	RedirectURL      string          `help:"The redirect URL used for callbacks." env:"REDIRECT_URL"`
+	AllowedHosts     []string        `help:"Hosts permitted to derive the callback URL from the request, wildcards such as *.example.com are supported." env:"ALLOWED_HOSTS"`
+	AuthPrefix       string          `help:"The path prefix for the authentication routes." env:"AUTH_PREFIX" default:"/auth"`
+	SessionSecretArn string          `help:"The ARN of the secret used to sign sessions." env:"SESSION_SECRET_ARN"`
+	CentralAuthURL   string          `help:"The URL of the auth routes on the central auth host, when set logins are delegated to it." env:"CENTRAL_AUTH_URL"`
+	SSOClientHosts   []string        `help:"Hosts permitted to receive single sign on tickets from this central auth host." env:"SSO_CLIENT_HOSTS"`
+	TicketSecretArn  string          `help:"The ARN of the secret shared by all sites used to sign single sign on tickets." env:"TICKET_SECRET_ARN"`
+	TicketTTL        time.Duration   `help:"How long single sign on tickets are valid." env:"TICKET_TTL" default:"1m"`
+	CLIClientID      string          `help:"The public openid client used by proxy-cli, its id tokens are accepted as bearer tokens." env:"CLI_CLIENT_ID"`
+	WebsiteBucket    string          `help:"The name of the website S3 bucket holding content to be served." env:"WEBSITE_BUCKET"`
+	DirectoryListing bool            `help:"List the contents of directories without an index rather than serving a single page application." env:"DIRECTORY_LISTING"`
+	RedirectsKey     string          `help:"The key of a _redirects or JSON file in the website bucket with redirect and rewrite rules." env:"REDIRECTS_KEY"`
+
+	Scopes               []string      `help:"The scopes requested from the openid provider." env:"SCOPES" default:"openid,email"`
+	Claims               []string      `help:"Additional claims copied from the openid provider into the session, such as name, picture and groups." env:"CLAIMS"`
+	SessionIdleTimeout   time.Duration `help:"How long a session can be idle before it expires, zero disables the idle timeout." env:"SESSION_IDLE_TIMEOUT"`
+	PublicPaths          []string      `help:"Path patterns served without login such as /favicon.ico or /assets/**." env:"PUBLIC_PATHS"`
+	IdentityAwarePaths   []string      `help:"Path patterns served without login which have the user attached when they are logged in." env:"IDENTITY_AWARE_PATHS"`
+	RateLimitAuthIP      string        `help:"Rate limit for the auth routes per client IP in the form requests/period[:burst], e.g. 20/1m." env:"RATE_LIMIT_AUTH_IP"`
+	RateLimitAuthUser    string        `help:"Rate limit for the auth routes per logged in user in the form requests/period[:burst]." env:"RATE_LIMIT_AUTH_USER"`
+	RateLimitContentIP   string        `help:"Rate limit for content per client IP in the form requests/period[:burst]." env:"RATE_LIMIT_CONTENT_IP"`
+	RateLimitContentUser string        `help:"Rate limit for content per logged in user in the form requests/period[:burst]." env:"RATE_LIMIT_CONTENT_USER"`
+	RateLimitStore       string        `help:"Where rate limit buckets are stored, dynamodb shares limits between instances." env:"RATE_LIMIT_STORE" enum:"memory,dynamodb" default:"memory"`
+	RateLimitTable       string        `help:"The DynamoDB table used to store rate limit buckets." env:"RATE_LIMIT_TABLE"`
+	TokenStore           string        `help:"Where personal access tokens are stored, tokens are disabled when this is off." env:"TOKEN_STORE" enum:"off,memory,dynamodb" default:"off"`
+	TokenTable           string        `help:"The DynamoDB table used to store personal access tokens." env:"TOKEN_TABLE"`
+	TokenMaxTTL          time.Duration `help:"The longest a personal access token is valid, revoke the tokens of users who leave as they remain valid until then." env:"TOKEN_MAX_TTL" default:"2160h"`
+	TokenClaimsTTL       time.Duration `help:"How long the claims copied into a personal access token are trusted, they are copied again when the user logs in." env:"TOKEN_CLAIMS_TTL" default:"24h"`
+	AdminClaim           string        `help:"The claim listing the roles of a user, this must be one of the copied claims." env:"ADMIN_CLAIM" default:"groups"`
+	AdminRole            string        `help:"The role which grants access to the admin routes, such as listing sessions and all personal access tokens." env:"ADMIN_ROLE"`
+	SessionStore         string        `help:"Where the registry of active sessions is kept so admins can list and revoke them, the registry is disabled when this is off." env:"SESSION_STORE" enum:"off,memory,dynamodb" default:"off"`
+	SessionTable         string        `help:"The DynamoDB table used to store the registry of active sessions." env:"SESSION_TABLE"`
+	AuditHistory         int           `help:"The number of recent audit events kept in memory for the admin routes." env:"AUDIT_HISTORY" default:"100"`
+
+	ProviderRefreshInterval time.Duration `help:"How often the openid provider configuration is refreshed." env:"PROVIDER_REFRESH_INTERVAL" default:"1h"`
+	ProviderRetryAttempts   int           `help:"The number of attempts made to discover the openid provider configuration." env:"PROVIDER_RETRY_ATTEMPTS" default:"3"`
+
+	ObjectCacheSize      int64         `help:"The memory in bytes used to cache small objects, the cache is disabled when zero." env:"OBJECT_CACHE_SIZE" default:"0"`
+	ObjectCacheMaxObject int64         `help:"The size in bytes of the largest object which is cached." env:"OBJECT_CACHE_MAX_OBJECT" default:"1048576"`
+	ObjectCacheTTL       time.Duration `help:"How long cached objects are used before they are revalidated with the bucket." env:"OBJECT_CACHE_TTL" default:"1m"`
+	ObjectCacheExclude   []string      `help:"Request path patterns which are never cached." env:"OBJECT_CACHE_EXCLUDE"`
+	LargeObjectSize      int64         `help:"Objects larger than this size in bytes are redirected to a presigned S3 URL, zero disables the redirect." env:"LARGE_OBJECT_SIZE" default:"4194304"`
+	PresignTTL           time.Duration `help:"How long presigned S3 URLs are valid." env:"PRESIGN_TTL" default:"1m"`
+	ShareTTL             time.Duration `help:"The longest a shared link is valid, zero disables the share route." env:"SHARE_TTL" default:"15m"`
+	Compression          bool          `help:"Compress text responses with brotli or gzip." env:"COMPRESSION" default:"true" negatable:""`
+	CompressMinSize      int           `help:"Responses smaller than this size in bytes aren't compressed." env:"COMPRESS_MIN_SIZE" default:"1024"`
+	Precompressed        bool          `help:"Serve the .br and .gz variants stored alongside objects to clients which accept the encoding." env:"PRECOMPRESSED"`
+
+	// nested settings which can only be supplied via the configuration file
+
+	Policies []Policy `kong:"-" yaml:"policies"`
+	Cookies  Cookies  `kong:"-" yaml:"cookies"`
+
+	CachePolicies []CachePolicy `kong:"-" yaml:"cache_policies"`
+	Sites         []Site        `kong:"-" yaml:"sites"`
+	Redirects     []rules.Rule  `kong:"-" yaml:"redirects"`
+
+	SecurityHeaders SecurityHeaders `kong:"-" yaml:"security_headers"`
+	Inject          Inject          `kong:"-" yaml:"inject"`
+}
+
+// Cookies the policies for each of the cookies used by the proxy
+type Cookies struct {
+	Auth  CookiePolicy `yaml:"auth"`
+	Login CookiePolicy `yaml:"login"`
+}
+
+// CookiePolicy controls the attributes of a cookie, unset values use the defaults for that cookie.
+type CookiePolicy struct {
+	NamePrefix string        `yaml:"name_prefix,omitempty"`
+	Domain     string        `yaml:"domain,omitempty"`
+	Path       string        `yaml:"path,omitempty"`
+	SameSite   string        `yaml:"same_site,omitempty"`
+	Secure     *bool         `yaml:"secure,omitempty"`
+	MaxAge     time.Duration `yaml:"max_age,omitempty"`
+}
+
+// Valid validate the cookie policy returning all the problems found
+func (cp CookiePolicy) Valid(name string) []error {
+	var errs []error
+
+	secure := cp.Secure == nil || *cp.Secure
+
+	switch cp.NamePrefix {
+	case "":
+	case "__Host-":
+		if cp.Domain != "" || (cp.Path != "" && cp.Path != "/") || !secure {
+			errs = append(errs, fmt.Errorf("invalid cookies.%s __Host- prefix requires secure, path / and no domain", name))
+		}
+	case "__Secure-":
+		if !secure {
+			errs = append(errs, fmt.Errorf("invalid cookies.%s __Secure- prefix requires secure", name))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid cookies.%s.name_prefix %q must be __Host- or __Secure-", name, cp.NamePrefix))
+	}
+
+	switch strings.ToLower(cp.SameSite) {
+	case "", "lax", "strict":
+	case "none":
+		if !secure {
+			errs = append(errs, fmt.Errorf("invalid cookies.%s same_site none requires secure", name))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid cookies.%s.same_site %q must be lax, strict or none", name, cp.SameSite))
+	}
+
+	if cp.Path != "" && !strings.HasPrefix(cp.Path, "/") {
+		errs = append(errs, fmt.Errorf("invalid cookies.%s.path %q must start with /", name, cp.Path))
+	}
+
+	if cp.MaxAge < 0 {
+		errs = append(errs, fmt.Errorf("invalid cookies.%s.max_age must not be negative", name))
+	}
+
+	return errs
+}
+
+// Site routes requests matching the hosts and path prefix to a bucket, requests are routed to the first
+// matching site and a site without hosts or a path prefix matches every request.
+type Site struct {
+	Name       string   `yaml:"name"`
+	Hosts      []string `yaml:"hosts,omitempty"`
+	PathPrefix string   `yaml:"path_prefix,omitempty"`
+
+	Bucket           string `yaml:"bucket"`
+	KeyPrefix        string `yaml:"key_prefix,omitempty"`
+	Index            string `yaml:"index,omitempty"`
+	SPA              bool   `yaml:"spa,omitempty"`
+	DirectoryListing bool   `yaml:"directory_listing,omitempty"`
+
+	// SPAPaths limits the single page application fallback to paths matching these patterns, and
+	// SPAExtensionless skips it for paths with a file extension so missing assets aren't answered with the index.
+	SPAPaths         []string `yaml:"spa_paths,omitempty"`
+	SPAExtensionless bool     `yaml:"spa_extensionless,omitempty"`
+
+	// NotFound the key of the document served with a 404 status when nothing else matches, relative to the key prefix.
+	NotFound string `yaml:"not_found,omitempty"`
+
+	// TrailingSlash redirects paths to add or remove the trailing slash, and CleanURLs serves page.html for /page
+	// and redirects requests for .html documents to the path without the extension.
+	TrailingSlash string `yaml:"trailing_slash,omitempty"`
+	CleanURLs     bool   `yaml:"clean_urls,omitempty"`
+
+	// Redirects and the rules in the RedirectsKey file of the bucket are matched against paths relative to the
+	// path prefix.
+	Redirects    []rules.Rule `yaml:"redirects,omitempty"`
+	RedirectsKey string       `yaml:"redirects_key,omitempty"`
+
+	// Preview serves preview builds from folders of the key prefix, selected by the first label of a wildcard
+	// host when set to "host" or the first folder of the path when set to "path".
+	Preview string `yaml:"preview,omitempty"`
+
+	Policies           []Policy `yaml:"policies,omitempty"`
+	PublicPaths        []string `yaml:"public_paths,omitempty"`
+	IdentityAwarePaths []string `yaml:"identity_aware_paths,omitempty"`
+}
+
+const (
+	// TrailingSlashAdd redirects paths without a file extension to the path with a trailing slash
+	TrailingSlashAdd = "add"
+	// TrailingSlashRemove redirects paths with a trailing slash to the path without it
+	TrailingSlashRemove = "remove"
+)
+
+// Valid returns the problems with the site configuration
+func (s Site) Valid(name string) []error {
+	var errs []error
+
+	if s.Name == "" {
+		errs = append(errs, fmt.Errorf("empty %s.name", name))
+	}
+	if s.Bucket == "" {
+		errs = append(errs, fmt.Errorf("empty %s.bucket", name))
+	}
+
+	if s.PathPrefix != "" && (!strings.HasPrefix(s.PathPrefix, "/") || strings.HasSuffix(s.PathPrefix, "/")) {
+		errs = append(errs, fmt.Errorf("invalid %s.path_prefix %q must start and not end with /", name, s.PathPrefix))
+	}
+
+	if strings.HasPrefix(s.KeyPrefix, "/") {
+		errs = append(errs, fmt.Errorf("invalid %s.key_prefix %q must not start with /", name, s.KeyPrefix))
+	}
+
+	if s.SPA && s.DirectoryListing {
+		errs = append(errs, fmt.Errorf("invalid %s spa and directory_listing can't both be enabled", name))
+	}
+
+	if !s.SPA && (len(s.SPAPaths) > 0 || s.SPAExtensionless) {
+		errs = append(errs, fmt.Errorf("invalid %s spa_paths and spa_extensionless require spa", name))
+	}
+
+	for _, p := range s.SPAPaths {
+		if !pathmatch.Valid(p) {
+			errs = append(errs, fmt.Errorf("invalid %s spa path %q", name, p))
+		}
+	}
+
+	if strings.HasPrefix(s.NotFound, "/") || strings.HasSuffix(s.NotFound, "/") {
+		errs = append(errs, fmt.Errorf("invalid %s.not_found %q must be a key relative to the key_prefix", name, s.NotFound))
+	}
+
+	switch s.TrailingSlash {
+	case "", TrailingSlashAdd:
+	case TrailingSlashRemove:
+		// listings are only shown for paths ending in a slash
+		if s.DirectoryListing {
+			errs = append(errs, fmt.Errorf("invalid %s trailing_slash remove can't be used with directory_listing", name))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid %s.trailing_slash %q must be add or remove", name, s.TrailingSlash))
+	}
+
+	wildcard := false
+
+	for _, h := range s.Hosts {
+		if strings.TrimPrefix(h, "*.") == "" || strings.ContainsAny(h, "/:") {
+			errs = append(errs, fmt.Errorf("invalid %s.hosts %q", name, h))
+		}
+		if strings.HasPrefix(h, "*.") {
+			wildcard = true
+		}
+	}
+
+	switch s.Preview {
+	case "", "path":
+	case "host":
+		if !wildcard {
+			errs = append(errs, fmt.Errorf("invalid %s host previews require a wildcard host", name))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid %s.preview %q must be host or path", name, s.Preview))
+	}
+
+	for i, r := range s.Redirects {
+		if err := r.Valid(); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s.redirects[%d] %w", name, i, err))
+		}
+	}
+
+	if strings.HasPrefix(s.RedirectsKey, "/") {
+		errs = append(errs, fmt.Errorf("invalid %s.redirects_key %q must not start with /", name, s.RedirectsKey))
+	}
+
+	for i, p := range s.Policies {
+		if !pathmatch.Valid(p.Path) {
+			errs = append(errs, fmt.Errorf("invalid %s.policies[%d].path %q", name, i, p.Path))
+		}
+	}
+
+	for _, p := range append(append([]string{}, s.PublicPaths...), s.IdentityAwarePaths...) {
+		if !pathmatch.Valid(p) {
+			errs = append(errs, fmt.Errorf("invalid %s public path %q", name, p))
+		}
+	}
+
+	return errs
+}
+
+// SiteConfigs returns the configured sites, or a single site serving the website bucket when none are configured.
+func (c *API) SiteConfigs() []Site {
+	if len(c.Sites) > 0 {
+		return c.Sites
+	}
+
+	return []Site{{
+		Name:               "default",
+		Bucket:             c.WebsiteBucket,
+		Index:              "index.html",
+		SPA:                !c.DirectoryListing,
+		DirectoryListing:   c.DirectoryListing,
+		Redirects:          c.Redirects,
+		RedirectsKey:       c.RedirectsKey,
+		Policies:           c.Policies,
+		PublicPaths:        c.PublicPaths,
+		IdentityAwarePaths: c.IdentityAwarePaths,
+	}}
+}
+
+// HeaderOff disables a security header which is otherwise set by default
+const HeaderOff = "off"
+
+// HeaderPolicy the security headers added to responses, empty values use the default and "off" removes the header.
+//
+// The content security policy can include {nonce} which is replaced with a value generated for each request, this
+// is added to the script and style tags of HTML documents.
+type HeaderPolicy struct {
+	HSTS                  string `yaml:"hsts,omitempty"`
+	ContentSecurityPolicy string `yaml:"content_security_policy,omitempty"`
+	ContentTypeOptions    string `yaml:"content_type_options,omitempty"`
+	ReferrerPolicy        string `yaml:"referrer_policy,omitempty"`
+	PermissionsPolicy     string `yaml:"permissions_policy,omitempty"`
+	FrameOptions          string `yaml:"frame_options,omitempty"`
+}
+
+// Merge returns the policy with the values set in the override replacing its own
+func (hp HeaderPolicy) Merge(override HeaderPolicy) HeaderPolicy {
+	pick := func(value, override string) string {
+		if override != "" {
+			return override
+		}
+		return value
+	}
+
+	return HeaderPolicy{
+		HSTS:                  pick(hp.HSTS, override.HSTS),
+		ContentSecurityPolicy: pick(hp.ContentSecurityPolicy, override.ContentSecurityPolicy),
+		ContentTypeOptions:    pick(hp.ContentTypeOptions, override.ContentTypeOptions),
+		ReferrerPolicy:        pick(hp.ReferrerPolicy, override.ReferrerPolicy),
+		PermissionsPolicy:     pick(hp.PermissionsPolicy, override.PermissionsPolicy),
+		FrameOptions:          pick(hp.FrameOptions, override.FrameOptions),
+	}
+}
+
+// SecurityHeaders the security headers added to every response, the first override matching the path
+// replaces the values it sets.
+type SecurityHeaders struct {
+	HeaderPolicy `yaml:",inline"`
+
+	Overrides []HeaderOverride `yaml:"overrides,omitempty"`
+}
+
+// HeaderOverride changes the security headers for paths matching the pattern
+type HeaderOverride struct {
+	Path         string `yaml:"path"`
+	HeaderPolicy `yaml:",inline"`
+}
+
+// DefaultInjectVariable the global variable the injected config is assigned to
+const DefaultInjectVariable = "__PROXY_CONFIG__"
+
+// Inject the config and user claims added to HTML documents as a script, this saves the page a request to the
+// userinfo route when it loads.
+type Inject struct {
+	// Variable the name of the global variable assigned the config, defaults to DefaultInjectVariable.
+	Variable string `yaml:"variable,omitempty"`
+	// Config values passed to the page as is, these are visible to anyone who can load the page.
+	Config map[string]interface{} `yaml:"config,omitempty"`
+	// Claims of the logged in user exposed to the page, sub, email or any of the claims copied into the session.
+	Claims []string `yaml:"claims,omitempty"`
+}
+
+// Enabled returns true if anything is injected into HTML documents
+func (in Inject) Enabled() bool {
+	return len(in.Config) > 0 || len(in.Claims) > 0
+}
+
+var variablePattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// CachePolicy sets the Cache-Control header for content matching a path pattern, responses are always private
+// as the content is only available to logged in users.
+type CachePolicy struct {
+	Path         string `yaml:"path"`
+	CacheControl string `yaml:"cache_control"`
+}
+
+// Policy restricts access to paths matching a pattern to the listed users, an empty policy allows any logged in user.
+type Policy struct {
+	Path         string   `yaml:"path"`
+	Emails       []string `yaml:"emails,omitempty"`
+	EmailDomains []string `yaml:"email_domains,omitempty"`
+	Subjects     []string `yaml:"subjects,omitempty"`
+	Groups       []string `yaml:"groups,omitempty"`
+}
+
+// TokensEnabled returns true if users can create personal access tokens
+func (c *API) TokensEnabled() bool {
+	return c.TokenStore != "" && c.TokenStore != "off"
+}
+
+// SessionRegistryEnabled returns true if active sessions are recorded so they can be revoked
+func (c *API) SessionRegistryEnabled() bool {
+	return c.SessionStore != "" && c.SessionStore != "off"
+}
+
+// SSOEnabled returns true if this site is either a central auth host or a client of one
+func (c *API) SSOEnabled() bool {
+	return c.CentralAuthURL != "" || len(c.SSOClientHosts) > 0
+}
+
+// ValidationError contains all the problems found while validating the configuration
+type ValidationError []error
+
+func (ve ValidationError) Error() string {
+	msgs := make([]string, len(ve))
+	for i, err := range ve {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, ", ")
 }
 
 // Valid validate our flags
 func (c *API) Valid() error {
-	if c.Issuer == "" {
-		return errors.New("empty Issuer")
+	var errs ValidationError
+
+	// sites using a central auth host never talk to the openid provider
+	if c.CentralAuthURL == "" {
+		if c.Issuer == "" {
+			errs = append(errs, errors.New("empty Issuer"))
+		}
+		if c.ClientID == "" {
+			errs = append(errs, errors.New("empty ClientID"))
+		}
+		if c.ClientSecret == "" {
+			errs = append(errs, errors.New("empty ClientSecret"))
+		}
+	} else if u, err := url.Parse(c.CentralAuthURL); err != nil || !u.IsAbs() || u.Host == "" {
+		errs = append(errs, fmt.Errorf("invalid CentralAuthURL %q must be an absolute URL", c.CentralAuthURL))
 	}
-	if c.ClientID == "" {
-		return errors.New("empty ClientID")
+
+	// id tokens from the cli are verified using the openid provider, even when logins are delegated
+	if c.CLIClientID != "" && c.CentralAuthURL != "" && c.Issuer == "" {
+		errs = append(errs, errors.New("empty Issuer required for CLIClientID"))
 	}
-	if c.ClientSecret == "" {
-		return errors.New("empty ClientSecret")
+
+	if c.SSOEnabled() && c.TicketSecretArn == "" {
+		errs = append(errs, errors.New("empty TicketSecretArn required for single sign on"))
 	}
 
 	if c.RedirectURL == "" {
-		return errors.New("empty RedirectURL")
+		// the redirect URL is only optional when it can be derived from the request
+		if len(c.AllowedHosts) == 0 {
+			errs = append(errs, errors.New("empty RedirectURL"))
+		}
+	} else if u, err := url.Parse(c.RedirectURL); err != nil || !u.IsAbs() || u.Host == "" {
+		errs = append(errs, fmt.Errorf("invalid RedirectURL %q must be an absolute URL", c.RedirectURL))
+	}
+
+	for _, host := range c.AllowedHosts {
+		if host == "" || strings.ContainsAny(host, "/ ") {
+			errs = append(errs, fmt.Errorf("invalid AllowedHosts entry %q", host))
+		}
+	}
+
+	if !strings.HasPrefix(c.AuthPrefix, "/") || strings.HasSuffix(c.AuthPrefix, "/") {
+		errs = append(errs, fmt.Errorf("invalid AuthPrefix %q must start with and not end with /", c.AuthPrefix))
+	}
+
+	if c.SessionIdleTimeout < 0 {
+		errs = append(errs, errors.New("invalid SessionIdleTimeout must not be negative"))
+	}
+
+	if c.SessionSecretArn == "" {
+		errs = append(errs, errors.New("empty SessionSecretArn"))
+	}
+	if c.WebsiteBucket == "" && len(c.Sites) == 0 {
+		errs = append(errs, errors.New("empty WebsiteBucket"))
+	}
+
+	// settings of the default site aren't used by the configured sites, ignoring them could make a site public
+	if len(c.Sites) > 0 {
+		for _, s := range []struct {
+			name string
+			set  bool
+		}{
+			{name: "policies", set: len(c.Policies) > 0},
+			{name: "public_paths", set: len(c.PublicPaths) > 0},
+			{name: "identity_aware_paths", set: len(c.IdentityAwarePaths) > 0},
+			{name: "redirects", set: len(c.Redirects) > 0},
+			{name: "redirects_key", set: c.RedirectsKey != ""},
+		} {
+			if s.set {
+				errs = append(errs, fmt.Errorf("invalid %s must be set on each site when sites are configured", s.name))
+			}
+		}
+	}
+
+	names := map[string]bool{}
+
+	for i, site := range c.Sites {
+		errs = append(errs, site.Valid(fmt.Sprintf("sites[%d]", i))...)
+
+		if names[site.Name] {
+			errs = append(errs, fmt.Errorf("duplicate sites[%d].name %q", i, site.Name))
+		}
+		names[site.Name] = true
+	}
+
+	for _, p := range append(append([]string{}, c.PublicPaths...), c.IdentityAwarePaths...) {
+		if !pathmatch.Valid(p) {
+			errs = append(errs, fmt.Errorf("invalid public path %q", p))
+		}
+	}
+
+	for i, p := range c.Policies {
+		if !pathmatch.Valid(p.Path) {
+			errs = append(errs, fmt.Errorf("invalid policies[%d].path %q", i, p.Path))
+		}
+	}
+
+	for i, r := range c.Redirects {
+		if err := r.Valid(); err != nil {
+			errs = append(errs, fmt.Errorf("invalid redirects[%d] %w", i, err))
+		}
+	}
+
+	if c.ObjectCacheSize < 0 || c.ObjectCacheMaxObject < 0 || c.ObjectCacheTTL < 0 {
+		errs = append(errs, errors.New("invalid ObjectCacheSize, ObjectCacheMaxObject and ObjectCacheTTL must not be negative"))
+	}
+
+	if c.LargeObjectSize < 0 {
+		errs = append(errs, errors.New("invalid LargeObjectSize must not be negative"))
+	}
+
+	// presigned urls can't outlive the credentials of the lambda
+	if c.PresignTTL < 0 || c.PresignTTL > time.Hour {
+		errs = append(errs, errors.New("invalid PresignTTL must be between 0 and 1h"))
+	}
+	if c.ShareTTL < 0 || c.ShareTTL > time.Hour {
+		errs = append(errs, errors.New("invalid ShareTTL must be between 0 and 1h"))
+	}
+	if c.CompressMinSize < 0 {
+		errs = append(errs, errors.New("invalid CompressMinSize must not be negative"))
+	}
+
+	for _, p := range c.ObjectCacheExclude {
+		if !pathmatch.Valid(p) {
+			errs = append(errs, fmt.Errorf("invalid object cache exclude path %q", p))
+		}
+	}
+
+	for i, p := range c.CachePolicies {
+		if !pathmatch.Valid(p.Path) {
+			errs = append(errs, fmt.Errorf("invalid cache_policies[%d].path %q", i, p.Path))
+		}
+		if strings.TrimSpace(p.CacheControl) == "" {
+			errs = append(errs, fmt.Errorf("empty cache_policies[%d].cache_control", i))
+		}
+		if strings.Contains(strings.ToLower(p.CacheControl), "public") {
+			errs = append(errs, fmt.Errorf("invalid cache_policies[%d].cache_control content must not be cached publicly", i))
+		}
+	}
+
+	policies := []HeaderPolicy{c.SecurityHeaders.HeaderPolicy}
+
+	for i, o := range c.SecurityHeaders.Overrides {
+		if !pathmatch.Valid(o.Path) {
+			errs = append(errs, fmt.Errorf("invalid security_headers.overrides[%d].path %q", i, o.Path))
+		}
+		policies = append(policies, o.HeaderPolicy)
+	}
+
+	for _, hp := range policies {
+		switch strings.ToUpper(hp.FrameOptions) {
+		case "", "DENY", "SAMEORIGIN", "OFF":
+		default:
+			errs = append(errs, fmt.Errorf("invalid security_headers frame_options %q must be DENY, SAMEORIGIN or off", hp.FrameOptions))
+		}
+	}
+
+	if c.Inject.Variable != "" && !variablePattern.MatchString(c.Inject.Variable) {
+		errs = append(errs, fmt.Errorf("invalid inject.variable %q must be a javascript identifier", c.Inject.Variable))
+	}
+
+	for i, claim := range c.Inject.Claims {
+		// only the claims copied into the session are available
+		if claim != "sub" && claim != "email" && !contains(c.Claims, claim) {
+			errs = append(errs, fmt.Errorf("invalid inject.claims[%d] %q must be sub, email or listed in Claims", i, claim))
+		}
+	}
+
+	errs = append(errs, c.Cookies.Auth.Valid("auth")...)
+	errs = append(errs, c.Cookies.Login.Valid("login")...)
+
+	// the auth cookie must be sent when the openid provider redirects back to the callback
+	if strings.EqualFold(c.Cookies.Auth.SameSite, "strict") {
+		errs = append(errs, errors.New("invalid cookies.auth.same_site strict prevents the callback from the openid provider"))
+	}
+
+	for _, limit := range []struct{ name, value string }{
+		{name: "RateLimitAuthIP", value: c.RateLimitAuthIP},
+		{name: "RateLimitAuthUser", value: c.RateLimitAuthUser},
+		{name: "RateLimitContentIP", value: c.RateLimitContentIP},
+		{name: "RateLimitContentUser", value: c.RateLimitContentUser},
+	} {
+		if limit.value == "" {
+			continue
+		}
+		if _, err := ratelimit.ParseLimit(limit.value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %w", limit.name, err))
+		}
+	}
+
+	if c.RateLimitStore == "dynamodb" && c.RateLimitTable == "" {
+		errs = append(errs, errors.New("empty RateLimitTable required for the dynamodb rate limit store"))
+	}
+
+	if c.TokenStore == "dynamodb" && c.TokenTable == "" {
+		errs = append(errs, errors.New("empty TokenTable required for the dynamodb token store"))
+	}
+
+	if c.TokensEnabled() && c.TokenMaxTTL <= 0 {
+		errs = append(errs, fmt.Errorf("invalid TokenMaxTTL %s must be greater than zero", c.TokenMaxTTL))
+	}
+
+	if c.TokensEnabled() && c.TokenClaimsTTL <= 0 {
+		errs = append(errs, fmt.Errorf("invalid TokenClaimsTTL %s must be greater than zero", c.TokenClaimsTTL))
+	}
+
+	if c.SessionStore == "dynamodb" && c.SessionTable == "" {
+		errs = append(errs, errors.New("empty SessionTable required for the dynamodb session store"))
+	}
+
+	if c.AuditHistory < 0 {
+		errs = append(errs, fmt.Errorf("invalid AuditHistory %d must not be negative", c.AuditHistory))
+	}
+
+	// roles are read from the claims copied into the session
+	if c.AdminRole != "" && !contains(c.Claims, c.AdminClaim) {
+		errs = append(errs, fmt.Errorf("invalid AdminClaim %q must be listed in Claims", c.AdminClaim))
+	}
+
+	// as are groups, without the claim policies using them would never allow access
+	if !contains(c.Claims, "groups") {
+		for i, p := range c.Policies {
+			if len(p.Groups) > 0 {
+				errs = append(errs, fmt.Errorf("invalid policies[%d].groups claim %q must be listed in Claims", i, "groups"))
+			}
+		}
+
+		for i, site := range c.Sites {
+			for j, p := range site.Policies {
+				if len(p.Groups) > 0 {
+					errs = append(errs, fmt.Errorf("invalid sites[%d].policies[%d].groups claim %q must be listed in Claims", i, j, "groups"))
+				}
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
 	}
 
 	return nil
 }
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1 +1,278 @@
 package flags
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/website-openid-proxy/internal/rules"
+)
+
+func TestValid(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := &API{
+		Issuer:           "https://idp.example.com",
+		ClientID:         "abc123",
+		ClientSecret:     "cde456",
+		RedirectURL:      "https://site.example.com/auth/callback",
+		AuthPrefix:       "/auth",
+		SessionSecretArn: "arn:aws:secretsmanager:ap-southeast-2:123456789012:secret:session",
+		WebsiteBucket:    "website",
+	}
+
+	assert.NoError(cfg.Valid())
+}
+
+func TestValid_AllowedHosts(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := &API{
+		Issuer:           "https://idp.example.com",
+		ClientID:         "abc123",
+		ClientSecret:     "cde456",
+		AllowedHosts:     []string{"site.example.com", "*.docs.example.com"},
+		AuthPrefix:       "/_auth",
+		SessionSecretArn: "arn:aws:secretsmanager:ap-southeast-2:123456789012:secret:session",
+		WebsiteBucket:    "website",
+	}
+
+	assert.NoError(cfg.Valid())
+}
+
+func TestValid_AllErrors(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := &API{
+		RedirectURL: "/auth/callback",
+		Policies:    []Policy{{Path: "admin"}},
+	}
+
+	err := cfg.Valid()
+	assert.Error(err)
+
+	verr, ok := err.(ValidationError)
+	assert.True(ok)
+	assert.Len(verr, 8)
+	assert.Contains(err.Error(), `invalid RedirectURL "/auth/callback"`)
+	assert.Contains(err.Error(), `invalid policies[0].path "admin"`)
+}
+
+func TestValid_CachePolicies(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := &API{
+		CachePolicies: []CachePolicy{
+			{Path: "/assets/**", CacheControl: "max-age=31536000, immutable"},
+			{Path: "/index.html", CacheControl: "public, max-age=60"},
+			{Path: "docs"},
+		},
+	}
+
+	err := cfg.Valid()
+	assert.Error(err)
+	assert.Contains(err.Error(), "invalid cache_policies[1].cache_control content must not be cached publicly")
+	assert.Contains(err.Error(), `invalid cache_policies[2].path "docs"`)
+	assert.Contains(err.Error(), "empty cache_policies[2].cache_control")
+	assert.NotContains(err.Error(), "cache_policies[0]")
+}
+
+func TestValid_Sites(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := &API{
+		Sites: []Site{
+			{Name: "docs", Hosts: []string{"docs.example.com"}, PathPrefix: "/docs", Bucket: "docs-bucket", KeyPrefix: "site/"},
+			{Name: "docs", PathPrefix: "/blog/", Bucket: "blog-bucket", SPA: true, DirectoryListing: true},
+			{Hosts: []string{"https://example.com"}, KeyPrefix: "/site"},
+			{Name: "preview", Hosts: []string{"preview.example.com"}, Bucket: "website", Preview: "host"},
+			{Name: "branch", Bucket: "website", Preview: "branch"},
+			{Name: "docs-v2", Bucket: "website", SPAPaths: []string{"/app/**"}, NotFound: "/404.html", TrailingSlash: "strip"},
+			{Name: "listing", Bucket: "website", DirectoryListing: true, TrailingSlash: TrailingSlashRemove},
+		},
+	}
+
+	err := cfg.Valid()
+	assert.Error(err)
+	assert.NotContains(err.Error(), "sites[0]")
+	assert.NotContains(err.Error(), "empty WebsiteBucket")
+	assert.Contains(err.Error(), `duplicate sites[1].name "docs"`)
+	assert.Contains(err.Error(), `invalid sites[1].path_prefix "/blog/" must start and not end with /`)
+	assert.Contains(err.Error(), "invalid sites[1] spa and directory_listing can't both be enabled")
+	assert.Contains(err.Error(), "empty sites[2].name")
+	assert.Contains(err.Error(), "empty sites[2].bucket")
+	assert.Contains(err.Error(), `invalid sites[2].hosts "https://example.com"`)
+	assert.Contains(err.Error(), `invalid sites[2].key_prefix "/site" must not start with /`)
+	assert.Contains(err.Error(), "invalid sites[3] host previews require a wildcard host")
+	assert.Contains(err.Error(), `invalid sites[4].preview "branch" must be host or path`)
+	assert.Contains(err.Error(), "invalid sites[5] spa_paths and spa_extensionless require spa")
+	assert.Contains(err.Error(), `invalid sites[5].not_found "/404.html" must be a key relative to the key_prefix`)
+	assert.Contains(err.Error(), `invalid sites[5].trailing_slash "strip" must be add or remove`)
+	assert.Contains(err.Error(), "invalid sites[6] trailing_slash remove can't be used with directory_listing")
+}
+
+func TestValid_SecurityHeaders(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := &API{
+		SecurityHeaders: SecurityHeaders{
+			HeaderPolicy: HeaderPolicy{FrameOptions: "ALLOW-FROM https://example.com"},
+			Overrides: []HeaderOverride{
+				{Path: "/embed/**", HeaderPolicy: HeaderPolicy{FrameOptions: "off"}},
+				{Path: "embed", HeaderPolicy: HeaderPolicy{FrameOptions: "deny"}},
+			},
+		},
+	}
+
+	err := cfg.Valid()
+	assert.Error(err)
+	assert.NotContains(err.Error(), "overrides[0]")
+	assert.Contains(err.Error(), `invalid security_headers.overrides[1].path "embed"`)
+	assert.Contains(err.Error(), `invalid security_headers frame_options "ALLOW-FROM https://example.com"`)
+	assert.NotContains(err.Error(), `frame_options "deny"`)
+}
+
+func TestValid_Redirects(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := &API{
+		Redirects: []rules.Rule{{From: "/old", To: "/new"}, {From: "old", To: "/new"}},
+		Sites: []Site{
+			{Name: "docs", Bucket: "website", RedirectsKey: "/_redirects", Redirects: []rules.Rule{{From: "/app/*", To: "https://example.com", Status: 200}}},
+		},
+	}
+
+	err := cfg.Valid()
+	assert.Error(err)
+	assert.NotContains(err.Error(), "redirects[0] from")
+	assert.Contains(err.Error(), `invalid redirects[1] from "old" must start with /`)
+	assert.Contains(err.Error(), `invalid sites[0].redirects[0] rewrite to "https://example.com" must be a path`)
+	assert.Contains(err.Error(), `invalid sites[0].redirects_key "/_redirects" must not start with /`)
+	assert.Contains(err.Error(), "invalid redirects must be set on each site when sites are configured")
+}
+
+func TestValid_SitesDefaultSettings(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := &API{
+		Policies:           []Policy{{Path: "/admin/**", Emails: []string{"admin@example.com"}}},
+		PublicPaths:        []string{"/favicon.ico"},
+		IdentityAwarePaths: []string{"/index.html"},
+		Sites: []Site{
+			{Name: "docs", Bucket: "website", IdentityAwarePaths: []string{"index.html"}},
+		},
+	}
+
+	err := cfg.Valid()
+	assert.Error(err)
+	assert.Contains(err.Error(), "invalid policies must be set on each site when sites are configured")
+	assert.Contains(err.Error(), "invalid public_paths must be set on each site when sites are configured")
+	assert.Contains(err.Error(), "invalid identity_aware_paths must be set on each site when sites are configured")
+	assert.NotContains(err.Error(), "invalid redirects must")
+	assert.Contains(err.Error(), `invalid sites[0] public path "index.html"`)
+
+	// the default site uses the top level settings
+	cfg.Sites = nil
+	assert.Equal([]string{"/index.html"}, cfg.SiteConfigs()[0].IdentityAwarePaths)
+}
+
+func TestValid_Inject(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := &API{
+		Claims: []string{"name"},
+		Inject: Inject{Variable: "window.config", Claims: []string{"sub", "name", "groups"}},
+	}
+
+	err := cfg.Valid()
+	assert.Error(err)
+	assert.Contains(err.Error(), `invalid inject.variable "window.config" must be a javascript identifier`)
+	assert.Contains(err.Error(), `invalid inject.claims[2] "groups" must be sub, email or listed in Claims`)
+	assert.NotContains(err.Error(), "inject.claims[0]")
+	assert.NotContains(err.Error(), "inject.claims[1]")
+}
+
+func TestValid_Stores(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := &API{
+		TokenStore:   "dynamodb",
+		SessionStore: "dynamodb",
+		AuditHistory: -1,
+		AdminClaim:   "roles",
+		AdminRole:    "proxy-admin",
+		Claims:       []string{"groups"},
+	}
+
+	err := cfg.Valid()
+	assert.Error(err)
+	assert.Contains(err.Error(), "empty TokenTable required for the dynamodb token store")
+	assert.Contains(err.Error(), "invalid TokenMaxTTL 0s must be greater than zero")
+	assert.Contains(err.Error(), "invalid TokenClaimsTTL 0s must be greater than zero")
+	assert.Contains(err.Error(), "empty SessionTable required for the dynamodb session store")
+	assert.Contains(err.Error(), "invalid AuditHistory -1 must not be negative")
+	assert.Contains(err.Error(), `invalid AdminClaim "roles" must be listed in Claims`)
+}
+
+func TestValid_PolicyGroups(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := &API{
+		Policies: []Policy{{Path: "/ops/**", Groups: []string{"ops"}}},
+		Sites: []Site{
+			{Name: "docs", Bucket: "website", Policies: []Policy{{Path: "/**", Emails: []string{"mark@wolfe.id.au"}}, {Path: "/ops/**", Groups: []string{"ops"}}}},
+		},
+	}
+
+	err := cfg.Valid()
+	assert.Error(err)
+	assert.Contains(err.Error(), `invalid policies[0].groups claim "groups" must be listed in Claims`)
+	assert.Contains(err.Error(), `invalid sites[0].policies[1].groups claim "groups" must be listed in Claims`)
+	assert.NotContains(err.Error(), "sites[0].policies[0]")
+
+	cfg.Claims = []string{"name", "groups"}
+
+	err = cfg.Valid()
+	assert.Error(err)
+	assert.NotContains(err.Error(), "groups claim")
+}
+
+func TestHeaderPolicy_Merge(t *testing.T) {
+	assert := require.New(t)
+
+	hp := HeaderPolicy{HSTS: "max-age=60", FrameOptions: "DENY"}
+
+	assert.Equal(HeaderPolicy{HSTS: "max-age=60", FrameOptions: HeaderOff, ReferrerPolicy: "no-referrer"},
+		hp.Merge(HeaderPolicy{FrameOptions: HeaderOff, ReferrerPolicy: "no-referrer"}))
+}
+
+func TestSiteConfigs(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := &API{WebsiteBucket: "website", PublicPaths: []string{"/favicon.ico"}}
+
+	assert.Equal([]Site{{Name: "default", Bucket: "website", Index: "index.html", SPA: true, PublicPaths: []string{"/favicon.ico"}}}, cfg.SiteConfigs())
+}
+
+func TestCookiePolicy_Valid(t *testing.T) {
+	insecure := false
+
+	tests := []struct {
+		name   string
+		policy CookiePolicy
+		errs   int
+	}{
+		{name: "defaults", policy: CookiePolicy{}, errs: 0},
+		{name: "host prefix", policy: CookiePolicy{NamePrefix: "__Host-", SameSite: "Strict"}, errs: 0},
+		{name: "host prefix with domain", policy: CookiePolicy{NamePrefix: "__Host-", Domain: "example.com"}, errs: 1},
+		{name: "secure prefix insecure", policy: CookiePolicy{NamePrefix: "__Secure-", Secure: &insecure}, errs: 1},
+		{name: "unknown prefix", policy: CookiePolicy{NamePrefix: "__Other-"}, errs: 1},
+		{name: "same site none insecure", policy: CookiePolicy{SameSite: "none", Secure: &insecure}, errs: 1},
+		{name: "invalid same site", policy: CookiePolicy{SameSite: "sometimes", Path: "auth"}, errs: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Len(t, tt.policy.Valid("login"), tt.errs)
+		})
+	}
+}
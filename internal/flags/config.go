@@ -0,0 +1,175 @@
+package flags
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/wolfeidau/website-openid-proxy/internal/rules"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	redacted = "REDACTED"
+
+	configFileEnv = "CONFIG_FILE"
+)
+
+// YAML returns a kong resolver which retrieves flag values from a YAML or JSON source.
+//
+// Flag names are used as keys, using either snake_case or camelCase variants, see kong.JSON.
+func YAML(r io.Reader) (kong.Resolver, error) {
+	values := map[string]interface{}{}
+
+	err := yaml.NewDecoder(r).Decode(&values)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	// yaml is a superset of json so convert it and reuse the existing kong resolver
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver, err := kong.JSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// environment variables take precedence over the configuration file
+	var f kong.ResolverFunc = func(ctx *kong.Context, parent *kong.Path, flag *kong.Flag) (interface{}, error) {
+		if flag.Tag.Env != "" {
+			if _, ok := os.LookupEnv(flag.Tag.Env); ok {
+				return nil, nil
+			}
+		}
+
+		return resolver.Resolve(ctx, parent, flag)
+	}
+
+	return f, nil
+}
+
+// Configuration returns the kong option which loads the configuration file.
+//
+// kong only loads a config flag supplied on the command line, so the file named by CONFIG_FILE is added up
+// front, the flag is resolved after it so a file passed with --config still takes precedence.
+func Configuration() kong.Option {
+	var paths []string
+
+	if path := os.Getenv(configFileEnv); path != "" {
+		paths = append(paths, path)
+	}
+
+	return kong.Configuration(YAML, paths...)
+}
+
+// LoadConfigFile load the nested settings which can't be expressed as flags from the configuration file.
+func (c *API) LoadConfigFile() error {
+	if c.ConfigFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(kong.ExpandPath(string(c.ConfigFile)))
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	nested := struct {
+		Policies []Policy `yaml:"policies"`
+		Cookies  Cookies  `yaml:"cookies"`
+
+		CachePolicies []CachePolicy `yaml:"cache_policies"`
+		Sites         []Site        `yaml:"sites"`
+		Redirects     []rules.Rule  `yaml:"redirects"`
+
+		SecurityHeaders SecurityHeaders `yaml:"security_headers"`
+		Inject          Inject          `yaml:"inject"`
+	}{}
+
+	err = yaml.Unmarshal(data, &nested)
+	if err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	c.Policies = nested.Policies
+	c.Cookies = nested.Cookies
+	c.CachePolicies = nested.CachePolicies
+	c.Sites = nested.Sites
+	c.Redirects = nested.Redirects
+	c.SecurityHeaders = nested.SecurityHeaders
+	c.Inject = nested.Inject
+
+	return nil
+}
+
+// Dump write the effective configuration as YAML with any secret values redacted.
+//
+// The output uses the same keys as the configuration file so it can be used as a starting point for one.
+func (c *API) Dump(ctx *kong.Context, w io.Writer) error {
+	values := map[string]interface{}{}
+
+	for _, flag := range ctx.Flags() {
+		switch flag.Name {
+		case "help", "version", "config":
+			continue
+		}
+
+		val := ctx.FlagValue(flag)
+
+		switch v := val.(type) {
+		case time.Duration:
+			val = v.String()
+		case string:
+			if flag.Tag.Has("secret") && v != "" {
+				val = redacted
+			}
+		}
+
+		values[strings.ReplaceAll(flag.Name, "-", "_")] = val
+	}
+
+	if len(c.Policies) > 0 {
+		values["policies"] = c.Policies
+	}
+
+	if len(c.CachePolicies) > 0 {
+		values["cache_policies"] = c.CachePolicies
+	}
+
+	if len(c.Sites) > 0 {
+		values["sites"] = c.Sites
+	}
+
+	if len(c.Redirects) > 0 {
+		values["redirects"] = c.Redirects
+	}
+
+	if c.SecurityHeaders.HeaderPolicy != (HeaderPolicy{}) || len(c.SecurityHeaders.Overrides) > 0 {
+		values["security_headers"] = c.SecurityHeaders
+	}
+
+	if c.Inject.Enabled() || c.Inject.Variable != "" {
+		values["inject"] = c.Inject
+	}
+
+	if c.Cookies != (Cookies{}) {
+		values["cookies"] = c.Cookies
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+
+	err := enc.Encode(values)
+	if err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
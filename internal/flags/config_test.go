@@ -0,0 +1,104 @@
+package flags
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+issuer: https://idp.example.com
+client_id: abc123
+client_secret: cde456
+policies:
+  - path: /admin/**
+    emails:
+      - admin@example.com
+cache_policies:
+  - path: /assets/**
+    cache_control: max-age=31536000, immutable
+inject:
+  config:
+    api_url: https://api.example.com
+    features:
+      search: true
+  claims:
+    - email
+`
+
+func TestConfigFile(t *testing.T) {
+	assert := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(os.WriteFile(path, []byte(testConfig), 0o600))
+
+	cfg := new(API)
+
+	parser, err := kong.New(cfg, Configuration())
+	assert.NoError(err)
+
+	ctx, err := parser.Parse([]string{"--config", path})
+	assert.NoError(err)
+
+	assert.NoError(cfg.LoadConfigFile())
+
+	assert.Equal("https://idp.example.com", cfg.Issuer)
+	assert.Equal("abc123", cfg.ClientID)
+	assert.Equal([]Policy{{Path: "/admin/**", Emails: []string{"admin@example.com"}}}, cfg.Policies)
+	assert.Equal([]CachePolicy{{Path: "/assets/**", CacheControl: "max-age=31536000, immutable"}}, cfg.CachePolicies)
+	assert.Equal(Inject{
+		Config: map[string]interface{}{"api_url": "https://api.example.com", "features": map[string]interface{}{"search": true}},
+		Claims: []string{"email"},
+	}, cfg.Inject)
+
+	buf := new(bytes.Buffer)
+	assert.NoError(cfg.Dump(ctx, buf))
+	assert.Contains(buf.String(), "client_secret: REDACTED")
+	assert.NotContains(buf.String(), "cde456")
+}
+
+func TestConfigFile_EnvOverride(t *testing.T) {
+	assert := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(os.WriteFile(path, []byte(testConfig), 0o600))
+
+	t.Setenv("CLIENT_ID", "env123")
+
+	cfg := new(API)
+
+	parser, err := kong.New(cfg, Configuration())
+	assert.NoError(err)
+
+	_, err = parser.Parse([]string{"--config", path})
+	assert.NoError(err)
+
+	assert.Equal("env123", cfg.ClientID)
+}
+
+func TestConfigFile_Env(t *testing.T) {
+	assert := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(os.WriteFile(path, []byte(testConfig), 0o600))
+
+	t.Setenv("CONFIG_FILE", path)
+
+	cfg := new(API)
+
+	parser, err := kong.New(cfg, Configuration())
+	assert.NoError(err)
+
+	_, err = parser.Parse([]string{})
+	assert.NoError(err)
+
+	assert.NoError(cfg.LoadConfigFile())
+
+	assert.Equal("https://idp.example.com", cfg.Issuer)
+	assert.Equal("abc123", cfg.ClientID)
+	assert.Equal([]Policy{{Path: "/admin/**", Emails: []string{"admin@example.com"}}}, cfg.Policies)
+}
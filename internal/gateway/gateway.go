@@ -0,0 +1,61 @@
+// Package gateway adapts the http handler to API Gateway events, responses with a content encoding are always
+// base64 encoded as the body is binary whatever the content type.
+package gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	"github.com/apex/gateway/v2"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Gateway wrap a http handler to enable use as a lambda.Handler
+type Gateway struct {
+	h http.Handler
+}
+
+// NewGateway creates a gateway using the provided http.Handler
+func NewGateway(h http.Handler) *Gateway {
+	return &Gateway{h: h}
+}
+
+// Invoke Handler implementation
+func (gw *Gateway) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	var evt events.APIGatewayV2HTTPRequest
+
+	if err := json.Unmarshal(payload, &evt); err != nil {
+		return []byte{}, err
+	}
+
+	r, err := gateway.NewRequest(ctx, evt)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	w := gateway.NewResponse()
+	gw.h.ServeHTTP(w, r)
+
+	resp := w.End()
+
+	encode(&resp)
+
+	return json.Marshal(&resp)
+}
+
+// encode the body of compressed responses as base64, the upstream gateway only does this for gzip
+func encode(resp *events.APIGatewayV2HTTPResponse) {
+	if resp.IsBase64Encoded {
+		return
+	}
+
+	switch resp.Headers["Content-Encoding"] {
+	case "", "identity":
+		return
+	}
+
+	resp.Body = base64.StdEncoding.EncodeToString([]byte(resp.Body))
+	resp.IsBase64Encoded = true
+}
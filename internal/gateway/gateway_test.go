@@ -0,0 +1,52 @@
+package gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGateway_Invoke(t *testing.T) {
+	assert := require.New(t)
+
+	body := []byte{0x8b, 0x00, 0xff, 0xfe}
+
+	gw := NewGateway(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/javascript")
+		if r.URL.Path == "/app.js" {
+			w.Header().Set("Content-Encoding", "br")
+			_, _ = w.Write(body)
+			return
+		}
+		_, _ = w.Write([]byte("console.log('app')"))
+	}))
+
+	invoke := func(path string) events.APIGatewayV2HTTPResponse {
+		payload, err := json.Marshal(events.APIGatewayV2HTTPRequest{
+			RawPath:        path,
+			RequestContext: events.APIGatewayV2HTTPRequestContext{HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{Method: http.MethodGet}},
+		})
+		assert.NoError(err)
+
+		out, err := gw.Invoke(context.Background(), payload)
+		assert.NoError(err)
+
+		var resp events.APIGatewayV2HTTPResponse
+		assert.NoError(json.Unmarshal(out, &resp))
+
+		return resp
+	}
+
+	resp := invoke("/app.js")
+	assert.True(resp.IsBase64Encoded)
+	assert.Equal(base64.StdEncoding.EncodeToString(body), resp.Body)
+
+	resp = invoke("/plain.js")
+	assert.False(resp.IsBase64Encoded)
+	assert.Equal("console.log('app')", resp.Body)
+}
@@ -0,0 +1,63 @@
+package pathmatch
+
+import (
+	"path"
+	"strings"
+)
+
+// Match reports whether the request path matches the pattern.
+//
+// Patterns ending in "/" or "/**" match everything under that prefix, patterns containing glob
+// characters are matched using path.Match, anything else must match the path exactly.
+func Match(pattern, p string) bool {
+	switch {
+	case pattern == "":
+		return false
+	case strings.HasSuffix(pattern, "/**"):
+		return strings.HasPrefix(p, strings.TrimSuffix(pattern, "**"))
+	case strings.HasSuffix(pattern, "/"):
+		return strings.HasPrefix(p, pattern)
+	case strings.ContainsAny(pattern, "*?["):
+		ok, err := path.Match(pattern, p)
+		return err == nil && ok
+	}
+
+	return pattern == p
+}
+
+// MatchAny reports whether the request path matches any of the patterns.
+func MatchAny(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if Match(pattern, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsClean reports whether the request path is absolute and free of dot and empty segments, other paths
+// must be rejected before matching as S3 resolves them to a different key than the one matched.
+func IsClean(p string) bool {
+	if !strings.HasPrefix(p, "/") {
+		return false
+	}
+
+	clean := path.Clean(p)
+	if clean != "/" && strings.HasSuffix(p, "/") {
+		clean += "/"
+	}
+
+	return clean == p
+}
+
+// Valid reports whether the pattern is well formed.
+func Valid(pattern string) bool {
+	if pattern == "" || !strings.HasPrefix(pattern, "/") {
+		return false
+	}
+
+	_, err := path.Match(pattern, "")
+
+	return err == nil
+}
@@ -0,0 +1,61 @@
+package pathmatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{pattern: "/favicon.ico", path: "/favicon.ico", want: true},
+		{pattern: "/favicon.ico", path: "/favicon.ico.bak", want: false},
+		{pattern: "/public/", path: "/public/css/site.css", want: true},
+		{pattern: "/public/**", path: "/public/css/site.css", want: true},
+		{pattern: "/public/**", path: "/publications", want: false},
+		{pattern: "/*.css", path: "/site.css", want: true},
+		{pattern: "/*.css", path: "/css/site.css", want: false},
+		{pattern: "", path: "/", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			require.Equal(t, tt.want, Match(tt.pattern, tt.path))
+		})
+	}
+}
+
+func TestValid(t *testing.T) {
+	assert := require.New(t)
+
+	assert.True(Valid("/assets/**"))
+	assert.False(Valid("assets/"))
+	assert.False(Valid("/[abc"))
+}
+
+func TestIsClean(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "/", want: true},
+		{path: "/docs/", want: true},
+		{path: "/docs/guide.html", want: true},
+		{path: "", want: false},
+		{path: "docs/guide.html", want: false},
+		{path: "/public/../admin/secret.html", want: false},
+		{path: "/public/./site.css", want: false},
+		{path: "/public/..", want: false},
+		{path: "/public//site.css", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			require.Equal(t, tt.want, IsClean(tt.path))
+		})
+	}
+}
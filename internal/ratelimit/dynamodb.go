@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+const maxConflictRetries = 3
+
+// DynamoDBStore keeps token buckets in a DynamoDB table so limits are shared by all instances of the service.
+//
+// The table requires a string partition key named "key", the "expires" attribute can be used as the TTL attribute
+// to remove idle buckets.
+type DynamoDBStore struct {
+	dynamosvc dynamodbiface.DynamoDBAPI
+	table     string
+}
+
+// NewDynamoDBStore create a new store using the table
+func NewDynamoDBStore(awscfg *aws.Config, table string) *DynamoDBStore {
+	sess := session.Must(session.NewSession(awscfg))
+
+	return &DynamoDBStore{
+		dynamosvc: dynamodb.New(sess),
+		table:     table,
+	}
+}
+
+// Take removes a token from the bucket for the key, updates are conditional on the bucket not having changed
+// since it was read and retried if another request has modified it.
+func (ds *DynamoDBStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	for attempt := 0; attempt < maxConflictRetries; attempt++ {
+		allowed, wait, err := ds.take(ctx, key, limit, now)
+		if isConditionalCheckFailed(err) {
+			continue
+		}
+
+		return allowed, wait, err
+	}
+
+	// under heavy contention err on the side of limiting the request
+	return false, time.Second, nil
+}
+
+func (ds *DynamoDBStore) take(ctx context.Context, key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	res, err := ds.dynamosvc.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(ds.table),
+		Key:            map[string]*dynamodb.AttributeValue{"key": {S: aws.String(key)}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return false, 0, err
+	}
+
+	tokens := float64(limit.Burst)
+	updated := now
+
+	prev, found := res.Item["updated"]
+	if found {
+		tokens, err = strconv.ParseFloat(aws.StringValue(res.Item["tokens"].N), 64)
+		if err != nil {
+			return false, 0, err
+		}
+
+		ms, err := strconv.ParseInt(aws.StringValue(prev.N), 10, 64)
+		if err != nil {
+			return false, 0, err
+		}
+
+		updated = time.UnixMilli(ms)
+	}
+
+	tokens, allowed, wait := limit.take(limit.refill(tokens, now.Sub(updated)))
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(ds.table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"key":     {S: aws.String(key)},
+			"tokens":  {N: aws.String(strconv.FormatFloat(tokens, 'f', -1, 64))},
+			"updated": {N: aws.String(strconv.FormatInt(now.UnixMilli(), 10))},
+			"expires": {N: aws.String(strconv.FormatInt(now.Add(limit.full()).Unix()+1, 10))},
+		},
+	}
+
+	if found {
+		input.ConditionExpression = aws.String("updated = :prev")
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{":prev": prev}
+	} else {
+		input.ConditionExpression = aws.String("attribute_not_exists(#k)")
+		input.ExpressionAttributeNames = map[string]*string{"#k": aws.String("key")}
+	}
+
+	_, err = ds.dynamosvc.PutItemWithContext(ctx, input)
+	if err != nil {
+		return false, 0, err
+	}
+
+	return allowed, wait, nil
+}
+
+func isConditionalCheckFailed(err error) bool {
+	var aerr awserr.Error
+
+	return errors.As(err, &aerr) && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	items     map[string]map[string]*dynamodb.AttributeValue
+	conflicts int
+}
+
+func (f *fakeDynamoDB) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: f.items[aws.StringValue(input.Key["key"].S)]}, nil
+}
+
+func (f *fakeDynamoDB) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	if f.conflicts > 0 {
+		f.conflicts--
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "conflict", nil)
+	}
+
+	f.items[aws.StringValue(input.Item["key"].S)] = input.Item
+
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func TestDynamoDBStore(t *testing.T) {
+	assert := require.New(t)
+
+	fake := &fakeDynamoDB{items: map[string]map[string]*dynamodb.AttributeValue{}, conflicts: 1}
+	store := &DynamoDBStore{dynamosvc: fake, table: "limits"}
+
+	limit := Limit{Rate: 1, Burst: 1}
+	now := time.UnixMilli(time.Now().UnixMilli()) // stored with millisecond precision
+
+	allowed, _, err := store.Take(context.TODO(), "ip:127.0.0.1", limit, now)
+	assert.NoError(err)
+	assert.True(allowed)
+
+	allowed, wait, err := store.Take(context.TODO(), "ip:127.0.0.1", limit, now)
+	assert.NoError(err)
+	assert.False(allowed)
+	assert.Equal(time.Second, wait)
+
+	allowed, _, err = store.Take(context.TODO(), "ip:127.0.0.1", limit, now.Add(time.Second))
+	assert.NoError(err)
+	assert.True(allowed)
+}
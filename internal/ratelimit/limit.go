@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit the rate tokens are added to a bucket and the maximum number of tokens it can hold
+type Limit struct {
+	// Rate number of tokens added per second
+	Rate float64
+	// Burst the size of the bucket
+	Burst int
+}
+
+// Store keeps track of the token buckets
+type Store interface {
+	// Take removes a token from the bucket for the key, if the bucket is empty the time until a token
+	// is available is returned.
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (bool, time.Duration, error)
+}
+
+// ParseLimit parse a limit in the form of requests/period with an optional burst, for example 10/1m or 10/1m:20,
+// the burst defaults to the number of requests.
+func ParseLimit(s string) (Limit, error) {
+	spec, burst, hasBurst := strings.Cut(s, ":")
+
+	n, period, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q must be in the form requests/period", s)
+	}
+
+	requests, err := strconv.Atoi(n)
+	if err != nil || requests <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q requests must be a positive number", s)
+	}
+
+	// allow a bare unit such as 10/m
+	if period != "" && !strings.ContainsAny(period[:1], "0123456789") {
+		period = "1" + period
+	}
+
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q period must be a positive duration", s)
+	}
+
+	limit := Limit{Rate: float64(requests) / d.Seconds(), Burst: requests}
+
+	if hasBurst {
+		limit.Burst, err = strconv.Atoi(burst)
+		if err != nil || limit.Burst <= 0 {
+			return Limit{}, fmt.Errorf("invalid limit %q burst must be a positive number", s)
+		}
+	}
+
+	return limit, nil
+}
+
+// refill calculates the tokens in the bucket after the elapsed time
+func (l Limit) refill(tokens float64, elapsed time.Duration) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	return math.Min(float64(l.Burst), tokens+elapsed.Seconds()*l.Rate)
+}
+
+// take removes a token returning the remaining tokens, or the time until a token is available
+func (l Limit) take(tokens float64) (float64, bool, time.Duration) {
+	if tokens >= 1 {
+		return tokens - 1, true, 0
+	}
+
+	wait := time.Duration((1 - tokens) / l.Rate * float64(time.Second))
+
+	return tokens, false, wait
+}
+
+// full returns the time taken for an empty bucket to be refilled
+func (l Limit) full() time.Duration {
+	return time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Limit
+		wantErr bool
+	}{
+		{spec: "10/1s", want: Limit{Rate: 10, Burst: 10}},
+		{spec: "60/m", want: Limit{Rate: 1, Burst: 60}},
+		{spec: "30/1m:5", want: Limit{Rate: 0.5, Burst: 5}},
+		{spec: "10", wantErr: true},
+		{spec: "0/1m", wantErr: true},
+		{spec: "10/forever", wantErr: true},
+		{spec: "10/1m:0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseLimit(tt.spec)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	assert := require.New(t)
+
+	store := NewMemoryStore()
+	limit := Limit{Rate: 1, Burst: 2}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		allowed, _, err := store.Take(context.TODO(), "ip:127.0.0.1", limit, now)
+		assert.NoError(err)
+		assert.True(allowed)
+	}
+
+	allowed, wait, err := store.Take(context.TODO(), "ip:127.0.0.1", limit, now)
+	assert.NoError(err)
+	assert.False(allowed)
+	assert.Equal(time.Second, wait)
+
+	// other keys have their own bucket
+	allowed, _, err = store.Take(context.TODO(), "ip:127.0.0.2", limit, now)
+	assert.NoError(err)
+	assert.True(allowed)
+
+	// tokens are added over time
+	allowed, _, err = store.Take(context.TODO(), "ip:127.0.0.1", limit, now.Add(time.Second))
+	assert.NoError(err)
+	assert.True(allowed)
+
+	// idle buckets are removed
+	_, _, err = store.Take(context.TODO(), "ip:127.0.0.3", limit, now.Add(5*time.Minute))
+	assert.NoError(err)
+	assert.Len(store.buckets, 1)
+}
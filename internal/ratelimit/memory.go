@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Duration
+}
+
+// MemoryStore keeps token buckets in memory, this is only shared by requests served by the same process.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// NewMemoryStore create a new in memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+// Take removes a token from the bucket for the key
+func (ms *MemoryStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.sweep(now)
+
+	b, ok := ms.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now, full: limit.full()}
+		ms.buckets[key] = b
+	}
+
+	tokens, allowed, wait := limit.take(limit.refill(b.tokens, now.Sub(b.updated)))
+
+	b.tokens = tokens
+	b.updated = now
+
+	return allowed, wait, nil
+}
+
+// sweep removes buckets which have been idle long enough to be full again
+func (ms *MemoryStore) sweep(now time.Time) {
+	if now.Sub(ms.swept) < sweepInterval {
+		return
+	}
+
+	for key, b := range ms.buckets {
+		if now.Sub(b.updated) > b.full {
+			delete(ms.buckets, key)
+		}
+	}
+
+	ms.swept = now
+}
@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/rs/zerolog/log"
+)
+
+type (
+	// Config defines the config for the rate limit middleware.
+	Config struct {
+		// Store the token buckets.
+		// Required.
+		Store Store
+
+		// Rules applied to each request, every rule which applies must allow the request.
+		Rules []Rule
+
+		// Now returns the current time, defaults to time.Now.
+		Now func() time.Time
+	}
+
+	// Rule a limit applied to a group of requests
+	Rule struct {
+		// Name used to separate the buckets of each rule.
+		Name string
+
+		// Skipper defines a function to skip the rule.
+		Skipper middleware.Skipper
+
+		// Limit applied to each key.
+		Limit Limit
+
+		// Key returns the bucket the request is counted against, the rule is skipped if it is empty.
+		Key func(c echo.Context) string
+	}
+)
+
+// IPKey use the client IP address as the key, set the IPExtractor of the echo instance to SourceIP so the
+// X-Forwarded-For header supplied by the client isn't trusted.
+func IPKey(c echo.Context) string {
+	return c.RealIP()
+}
+
+// SourceIP extracts the IP address of the client from the remote address of the request, behind API Gateway
+// this is the source IP of the connection it received so, unlike X-Forwarded-For, it can't be set by the client.
+func SourceIP(req *http.Request) string {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		// the gateway sets the remote address without a port
+		return req.RemoteAddr
+	}
+
+	return ip
+}
+
+// MiddlewareWithConfig returns a rate limit middleware which responds with 429 Too Many Requests
+// and a Retry-After header when a limit is exceeded.
+func MiddlewareWithConfig(config Config) echo.MiddlewareFunc {
+	if config.Store == nil {
+		panic("echo: rate limit middleware requires store")
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	for i := range config.Rules {
+		if config.Rules[i].Skipper == nil {
+			config.Rules[i].Skipper = middleware.DefaultSkipper
+		}
+		if config.Rules[i].Key == nil {
+			config.Rules[i].Key = IPKey
+		}
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+
+			for _, rule := range config.Rules {
+				if rule.Skipper(c) {
+					continue
+				}
+
+				key := rule.Key(c)
+				if key == "" {
+					continue
+				}
+
+				allowed, wait, err := config.Store.Take(ctx, rule.Name+":"+key, rule.Limit, config.Now())
+				if err != nil {
+					// fail open, an unavailable store shouldn't take the site down
+					log.Ctx(ctx).Error().Err(err).Str("rule", rule.Name).Msg("failed to check rate limit")
+					continue
+				}
+
+				if !allowed {
+					log.Ctx(ctx).Warn().Str("rule", rule.Name).Str("key", key).Msg("rate limit exceeded")
+
+					c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+
+					return c.String(http.StatusTooManyRequests, "too many requests")
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareWithConfig(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Now()
+
+	e := echo.New()
+	e.Use(MiddlewareWithConfig(Config{
+		Store: NewMemoryStore(),
+		Rules: []Rule{
+			{Name: "ip", Limit: Limit{Rate: 0.1, Burst: 1}},
+			{Name: "user", Limit: Limit{Rate: 1, Burst: 1}, Key: func(c echo.Context) string { return "" }},
+		},
+		Now: func() time.Time { return now },
+	}))
+	e.GET("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderXForwardedFor, "10.0.0.1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(http.StatusTooManyRequests, rec.Code)
+	assert.Equal("10", rec.Header().Get("Retry-After"))
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderXForwardedFor, "10.0.0.2")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(http.StatusOK, rec.Code)
+}
+
+func TestSourceIP(t *testing.T) {
+	assert := require.New(t)
+
+	e := echo.New()
+	e.IPExtractor = SourceIP
+	e.Use(MiddlewareWithConfig(Config{
+		Store: NewMemoryStore(),
+		Rules: []Rule{{Name: "ip", Limit: Limit{Rate: 0.1, Burst: 1}}},
+	}))
+	e.GET("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1"
+	req.Header.Set(echo.HeaderXForwardedFor, "10.0.0.2")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(http.StatusOK, rec.Code)
+
+	// a different forwarded address doesn't get a new bucket
+	req.Header.Set(echo.HeaderXForwardedFor, "10.0.0.3")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(http.StatusTooManyRequests, rec.Code)
+
+	req.RemoteAddr = "10.0.0.4:1234"
+	assert.Equal("10.0.0.4", SourceIP(req))
+}
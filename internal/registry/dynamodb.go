@@ -0,0 +1,174 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// DynamoDBStore keeps sessions in a DynamoDB table so they are shared by all instances of the service.
+//
+// The table requires a string partition key named "id", the "expires" attribute can be used as the TTL attribute
+// to remove expired sessions. Listing sessions scans the table, which is fine as it is only used by the admin
+// routes.
+type DynamoDBStore struct {
+	dynamosvc dynamodbiface.DynamoDBAPI
+	table     string
+}
+
+// NewDynamoDBStore create a new store using the table
+func NewDynamoDBStore(awscfg *aws.Config, table string) *DynamoDBStore {
+	sess := session.Must(session.NewSession(awscfg))
+
+	return &DynamoDBStore{
+		dynamosvc: dynamodb.New(sess),
+		table:     table,
+	}
+}
+
+// Put stores the session
+func (ds *DynamoDBStore) Put(ctx context.Context, s *Session) error {
+	input, err := ds.putInput(s)
+	if err != nil {
+		return err
+	}
+
+	_, err = ds.dynamosvc.PutItemWithContext(ctx, input)
+
+	return err
+}
+
+// Touch updates the session if it is still stored, the put is conditional on the item existing so a session
+// which was deleted isn't stored again.
+func (ds *DynamoDBStore) Touch(ctx context.Context, s *Session) error {
+	input, err := ds.putInput(s)
+	if err != nil {
+		return err
+	}
+
+	input.ConditionExpression = aws.String("attribute_exists(id)")
+
+	_, err = ds.dynamosvc.PutItemWithContext(ctx, input)
+	if isConditionalCheckFailed(err) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// Get returns the session with the id
+func (ds *DynamoDBStore) Get(ctx context.Context, id string) (*Session, error) {
+	res, err := ds.dynamosvc.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(ds.table),
+		Key:            map[string]*dynamodb.AttributeValue{"id": {S: aws.String(id)}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Item == nil {
+		return nil, ErrNotFound
+	}
+
+	return decodeItem(res.Item)
+}
+
+// List returns the sessions of the subject, or all sessions when the subject is empty, most recently seen first
+func (ds *DynamoDBStore) List(ctx context.Context, subject string) ([]*Session, error) {
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(ds.table),
+	}
+
+	if subject != "" {
+		input.FilterExpression = aws.String("#s = :sub")
+		input.ExpressionAttributeNames = map[string]*string{"#s": aws.String("sub")}
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{":sub": {S: aws.String(subject)}}
+	}
+
+	var (
+		list    []*Session
+		itemErr error
+	)
+
+	err := ds.dynamosvc.ScanPagesWithContext(ctx, input, func(page *dynamodb.ScanOutput, last bool) bool {
+		for _, item := range page.Items {
+			s, err := decodeItem(item)
+			if err != nil {
+				itemErr = err
+				return false
+			}
+
+			list = append(list, s)
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if itemErr != nil {
+		return nil, itemErr
+	}
+
+	sortSessions(list)
+
+	return list, nil
+}
+
+// Delete removes the session
+func (ds *DynamoDBStore) Delete(ctx context.Context, id string) error {
+	_, err := ds.dynamosvc.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(ds.table),
+		Key:       map[string]*dynamodb.AttributeValue{"id": {S: aws.String(id)}},
+	})
+
+	return err
+}
+
+func decodeItem(item map[string]*dynamodb.AttributeValue) (*Session, error) {
+	data, ok := item["data"]
+	if !ok {
+		return nil, errors.New("session item is missing data")
+	}
+
+	s := new(Session)
+
+	err := json.Unmarshal([]byte(aws.StringValue(data.S)), s)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (ds *DynamoDBStore) putInput(s *Session) (*dynamodb.PutItemInput, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dynamodb.PutItemInput{
+		TableName: aws.String(ds.table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"id":      {S: aws.String(s.ID)},
+			"sub":     {S: aws.String(s.Subject)},
+			"data":    {S: aws.String(string(data))},
+			"expires": {N: aws.String(strconv.FormatInt(s.ExpiresAt, 10))},
+		},
+	}, nil
+}
+
+func isConditionalCheckFailed(err error) bool {
+	var aerr awserr.Error
+
+	return errors.As(err, &aerr) && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
@@ -0,0 +1,89 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func (f *fakeDynamoDB) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	if _, ok := f.items[aws.StringValue(input.Item["id"].S)]; !ok && input.ConditionExpression != nil {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "missing", nil)
+	}
+
+	f.items[aws.StringValue(input.Item["id"].S)] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: f.items[aws.StringValue(input.Key["id"].S)]}, nil
+}
+
+func (f *fakeDynamoDB) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	delete(f.items, aws.StringValue(input.Key["id"].S))
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) ScanPagesWithContext(ctx aws.Context, input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool, opts ...request.Option) error {
+	page := &dynamodb.ScanOutput{}
+
+	for _, item := range f.items {
+		if input.FilterExpression != nil && aws.StringValue(item["sub"].S) != aws.StringValue(input.ExpressionAttributeValues[":sub"].S) {
+			continue
+		}
+
+		page.Items = append(page.Items, item)
+	}
+
+	fn(page, true)
+
+	return nil
+}
+
+func TestDynamoDBStore(t *testing.T) {
+	assert := require.New(t)
+
+	ctx := context.TODO()
+	fake := &fakeDynamoDB{items: map[string]map[string]*dynamodb.AttributeValue{}}
+	store := &DynamoDBStore{dynamosvc: fake, table: "sessions"}
+
+	assert.NoError(store.Put(ctx, &Session{ID: "a", Subject: "abc123", IP: "10.0.0.1", CreatedAt: 1, LastSeen: 1, ExpiresAt: 100}))
+	assert.NoError(store.Put(ctx, &Session{ID: "b", Subject: "def456", CreatedAt: 2, LastSeen: 2, ExpiresAt: 200}))
+
+	assert.Equal("100", aws.StringValue(fake.items["a"]["expires"].N))
+
+	got, err := store.Get(ctx, "a")
+	assert.NoError(err)
+	assert.Equal(&Session{ID: "a", Subject: "abc123", IP: "10.0.0.1", CreatedAt: 1, LastSeen: 1, ExpiresAt: 100}, got)
+
+	list, err := store.List(ctx, "def456")
+	assert.NoError(err)
+	assert.Len(list, 1)
+	assert.Equal("b", list[0].ID)
+
+	list, err = store.List(ctx, "")
+	assert.NoError(err)
+	assert.Len(list, 2)
+	assert.Equal("b", list[0].ID)
+
+	assert.NoError(store.Touch(ctx, &Session{ID: "a", Subject: "abc123", LastSeen: 5}))
+	assert.NoError(store.Delete(ctx, "a"))
+
+	_, err = store.Get(ctx, "a")
+	assert.ErrorIs(err, ErrNotFound)
+
+	// deleted sessions aren't stored again
+	assert.ErrorIs(store.Touch(ctx, &Session{ID: "a", Subject: "abc123", LastSeen: 6}), ErrNotFound)
+	assert.NotContains(fake.items, "a")
+}
@@ -0,0 +1,106 @@
+package registry
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps sessions in memory, they are only known to the process which created them so this is
+// intended for development or a single instance of the service.
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// NewMemoryStore create a new in memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]*Session)}
+}
+
+// Put stores the session, removing any sessions which have expired
+func (ms *MemoryStore) Put(ctx context.Context, s *Session) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := time.Now()
+
+	for id, prev := range ms.sessions {
+		if prev.Expired(now) {
+			delete(ms.sessions, id)
+		}
+	}
+
+	cp := *s
+	ms.sessions[s.ID] = &cp
+
+	return nil
+}
+
+// Touch updates the session if it is still stored
+func (ms *MemoryStore) Touch(ctx context.Context, s *Session) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.sessions[s.ID]; !ok {
+		return ErrNotFound
+	}
+
+	cp := *s
+	ms.sessions[s.ID] = &cp
+
+	return nil
+}
+
+// Get returns the session with the id
+func (ms *MemoryStore) Get(ctx context.Context, id string) (*Session, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	s, ok := ms.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	cp := *s
+
+	return &cp, nil
+}
+
+// List returns the sessions of the subject, or all sessions when the subject is empty, most recently seen first
+func (ms *MemoryStore) List(ctx context.Context, subject string) ([]*Session, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var list []*Session
+
+	for _, s := range ms.sessions {
+		if subject != "" && s.Subject != subject {
+			continue
+		}
+
+		cp := *s
+		list = append(list, &cp)
+	}
+
+	sortSessions(list)
+
+	return list, nil
+}
+
+// Delete removes the session
+func (ms *MemoryStore) Delete(ctx context.Context, id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.sessions, id)
+
+	return nil
+}
+
+func sortSessions(list []*Session) {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LastSeen > list[j].LastSeen
+	})
+}
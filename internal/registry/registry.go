@@ -0,0 +1,42 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound returned when the store doesn't contain the session
+var ErrNotFound = errors.New("session not found")
+
+// Session an active login session, the session cookie holds the id so the session can be revoked
+type Session struct {
+	ID      string `json:"id"`
+	Subject string `json:"sub"`
+	Email   string `json:"email"`
+	Issuer  string `json:"iss,omitempty"`
+	// CreatedAt, LastSeen and ExpiresAt in seconds since the epoch
+	CreatedAt int64 `json:"created_at"`
+	LastSeen  int64 `json:"last_seen"`
+	ExpiresAt int64 `json:"expires_at"`
+	// IP and UserAgent of the client which logged in
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// Expired returns true if the session has passed its expiry
+func (s *Session) Expired(now time.Time) bool {
+	return s.ExpiresAt != 0 && now.Unix() >= s.ExpiresAt
+}
+
+// Store keeps the registry of active sessions
+type Store interface {
+	Put(ctx context.Context, s *Session) error
+	// Touch updates a session which is still in the store, returning ErrNotFound if it was deleted
+	Touch(ctx context.Context, s *Session) error
+	// Get returns ErrNotFound if the session doesn't exist
+	Get(ctx context.Context, id string) (*Session, error)
+	// List returns the sessions of the subject, or all sessions when the subject is empty
+	List(ctx context.Context, subject string) ([]*Session, error)
+	Delete(ctx context.Context, id string) error
+}
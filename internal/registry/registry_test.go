@@ -0,0 +1,48 @@
+package registry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	assert := require.New(t)
+
+	ctx := context.TODO()
+	store := NewMemoryStore()
+
+	now := time.Now()
+
+	assert.NoError(store.Put(ctx, &Session{ID: "a", Subject: "abc123", LastSeen: 1}))
+	assert.NoError(store.Put(ctx, &Session{ID: "b", Subject: "abc123", LastSeen: 2}))
+	assert.NoError(store.Put(ctx, &Session{ID: "c", Subject: "def456", LastSeen: 3, ExpiresAt: now.Add(time.Hour).Unix()}))
+
+	list, err := store.List(ctx, "abc123")
+	assert.NoError(err)
+	assert.Len(list, 2)
+	assert.Equal("b", list[0].ID)
+
+	list, err = store.List(ctx, "")
+	assert.NoError(err)
+	assert.Len(list, 3)
+
+	assert.NoError(store.Delete(ctx, "a"))
+
+	_, err = store.Get(ctx, "a")
+	assert.ErrorIs(err, ErrNotFound)
+	assert.ErrorIs(store.Touch(ctx, &Session{ID: "a", LastSeen: 4}), ErrNotFound)
+
+	// expired sessions are removed when another is stored
+	assert.NoError(store.Put(ctx, &Session{ID: "d", Subject: "def456", ExpiresAt: now.Add(-time.Minute).Unix()}))
+	assert.NoError(store.Put(ctx, &Session{ID: "e", Subject: "def456"}))
+
+	_, err = store.Get(ctx, "d")
+	assert.ErrorIs(err, ErrNotFound)
+
+	got, err := store.Get(ctx, "c")
+	assert.NoError(err)
+	assert.False(got.Expired(now))
+}
@@ -0,0 +1,220 @@
+// Package rules matches the redirect and rewrite rules from the configuration or a file in the bucket, such as
+// the _redirects file written by static site generators.
+package rules
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// StatusRewrite serves the content of the target path without redirecting
+const StatusRewrite = http.StatusOK
+
+var placeholderPattern = regexp.MustCompile(`:[A-Za-z_][A-Za-z0-9_]*`)
+
+// Rule redirects or rewrites requests matching the from path.
+//
+// The from path can end in * which matches the rest of the path and is available in the target as :splat, and
+// segments such as :year match a single segment which is available in the target as :year.
+type Rule struct {
+	From string `yaml:"from" json:"from"`
+	To   string `yaml:"to" json:"to"`
+	// Status of the redirect, 200 rewrites the request to the target path. Defaults to 301.
+	Status int `yaml:"status,omitempty" json:"status,omitempty"`
+	// Force applies the rule even when the path exists, this is written as a ! after the status in a _redirects
+	// file. Existing objects aren't checked so rewrites must be forced.
+	Force bool `yaml:"force,omitempty" json:"force,omitempty"`
+}
+
+// Valid returns an error describing the problem with the rule
+func (r Rule) Valid() error {
+	if !strings.HasPrefix(r.From, "/") {
+		return fmt.Errorf("from %q must start with /", r.From)
+	}
+
+	if i := strings.Index(r.From, "*"); i >= 0 && (i != len(r.From)-1 || !strings.HasSuffix(r.From, "/*")) {
+		return fmt.Errorf("from %q can only end in /*", r.From)
+	}
+
+	switch r.Status {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		if r.To == "" {
+			return fmt.Errorf("empty to for %q", r.From)
+		}
+	case StatusRewrite:
+		// rewrites are served by the proxy so can't go to another host
+		if !strings.HasPrefix(r.To, "/") || strings.HasPrefix(r.To, "//") {
+			return fmt.Errorf("rewrite to %q must be a path", r.To)
+		}
+		// a rewrite which only applies to missing objects can't be told apart from one which hides them
+		if !r.Force {
+			return fmt.Errorf("rewrite of %q must be forced with ! as it applies even when the path exists", r.From)
+		}
+	default:
+		return fmt.Errorf("invalid status %d for %q must be 200, 301, 302, 303, 307 or 308", r.Status, r.From)
+	}
+
+	return nil
+}
+
+// Match returns the target of the rule for the path, or false if the rule doesn't match
+func (r Rule) Match(p string) (string, bool) {
+	from := strings.Split(trimSlash(r.From), "/")
+	segments := strings.Split(trimSlash(p), "/")
+
+	values := make(map[string]string)
+
+	for i, f := range from {
+		if f == "*" && i == len(from)-1 {
+			values["splat"] = strings.Join(segments[i:], "/")
+			break
+		}
+
+		if i >= len(segments) {
+			return "", false
+		}
+
+		switch {
+		case strings.HasPrefix(f, ":"):
+			if segments[i] == "" {
+				return "", false
+			}
+			values[f[1:]] = segments[i]
+		case f != segments[i]:
+			return "", false
+		}
+
+		// the path is longer than the rule
+		if i == len(from)-1 && len(segments) > len(from) {
+			return "", false
+		}
+	}
+
+	to := placeholderPattern.ReplaceAllStringFunc(r.To, func(name string) string {
+		if v, ok := values[name[1:]]; ok {
+			return v
+		}
+		return name
+	})
+
+	return to, true
+}
+
+// Redirect returns true if the rule redirects the client rather than rewriting the request
+func (r Rule) Redirect() bool {
+	return r.Status != StatusRewrite
+}
+
+// RedirectStatus returns the status of the redirect, defaulting to 301 Moved Permanently
+func (r Rule) RedirectStatus() int {
+	if r.Status == 0 {
+		return http.StatusMovedPermanently
+	}
+
+	return r.Status
+}
+
+// Parse reads rules from a JSON file, either a list of rules or a map of paths to their redirect, or a
+// _redirects file with a rule on each line in the form "from to [status]".
+func Parse(key string, data []byte) ([]Rule, error) {
+	var rules []Rule
+
+	if strings.EqualFold(path.Ext(key), ".json") {
+		var err error
+
+		rules, err = parseJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", key, err)
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+
+		for n := 1; scanner.Scan(); n++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			rule, err := parseLine(line)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s line %d: %w", key, n, err)
+			}
+
+			rules = append(rules, rule)
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", key, err)
+		}
+	}
+
+	for i, r := range rules {
+		if err := r.Valid(); err != nil {
+			return nil, fmt.Errorf("invalid %s rule %d: %w", key, i+1, err)
+		}
+	}
+
+	return rules, nil
+}
+
+func parseLine(line string) (Rule, error) {
+	fields := strings.Fields(line)
+
+	switch len(fields) {
+	case 2:
+		return Rule{From: fields[0], To: fields[1]}, nil
+	case 3:
+		status, err := strconv.Atoi(strings.TrimSuffix(fields[2], "!"))
+		if err != nil {
+			return Rule{}, fmt.Errorf("invalid status %q", fields[2])
+		}
+
+		return Rule{From: fields[0], To: fields[1], Status: status, Force: strings.HasSuffix(fields[2], "!")}, nil
+	default:
+		return Rule{}, fmt.Errorf("expected from, to and an optional status")
+	}
+}
+
+func parseJSON(data []byte) ([]Rule, error) {
+	var rules []Rule
+
+	if err := json.Unmarshal(data, &rules); err == nil {
+		return rules, nil
+	}
+
+	redirects := make(map[string]string)
+
+	if err := json.Unmarshal(data, &redirects); err != nil {
+		return nil, err
+	}
+
+	for from, to := range redirects {
+		rules = append(rules, Rule{From: from, To: to})
+	}
+
+	// map order is random so the longest paths are matched first
+	sort.Slice(rules, func(i, j int) bool {
+		if len(rules[i].From) != len(rules[j].From) {
+			return len(rules[i].From) > len(rules[j].From)
+		}
+		return rules[i].From < rules[j].From
+	})
+
+	return rules, nil
+}
+
+func trimSlash(p string) string {
+	if p == "/" {
+		return p
+	}
+
+	return strings.TrimSuffix(p, "/")
+}
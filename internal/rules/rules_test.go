@@ -0,0 +1,84 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRule_Match(t *testing.T) {
+	tests := []struct {
+		rule Rule
+		path string
+		want string
+		ok   bool
+	}{
+		{rule: Rule{From: "/old", To: "/new"}, path: "/old", want: "/new", ok: true},
+		{rule: Rule{From: "/old", To: "/new"}, path: "/old/", want: "/new", ok: true},
+		{rule: Rule{From: "/old", To: "/new"}, path: "/old/page", ok: false},
+		{rule: Rule{From: "/news/*", To: "/blog/:splat"}, path: "/news/2023/03/post", want: "/blog/2023/03/post", ok: true},
+		{rule: Rule{From: "/news/*", To: "/blog/:splat"}, path: "/news", want: "/blog/", ok: true},
+		{rule: Rule{From: "/news/:year/:month/*", To: "/blog/:year-:month/:splat"}, path: "/news/2023/03/post", want: "/blog/2023-03/post", ok: true},
+		{rule: Rule{From: "/news/:year/:month", To: "/blog/:year"}, path: "/news/2023", ok: false},
+		{rule: Rule{From: "/docs/*", To: "https://docs.example.com/:splat"}, path: "/docs/install", want: "https://docs.example.com/install", ok: true},
+		{rule: Rule{From: "/", To: "/home"}, path: "/", want: "/home", ok: true},
+		{rule: Rule{From: "/", To: "/home"}, path: "/other", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule.From+" "+tt.path, func(t *testing.T) {
+			got, ok := tt.rule.Match(tt.path)
+			require.Equal(t, tt.ok, ok)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRule_Valid(t *testing.T) {
+	assert := require.New(t)
+
+	assert.NoError(Rule{From: "/news/*", To: "/blog/:splat", Status: 302}.Valid())
+	assert.NoError(Rule{From: "/app/*", To: "/index.html", Status: StatusRewrite, Force: true}.Valid())
+	assert.EqualError(Rule{From: "/app/*", To: "/index.html", Status: StatusRewrite}.Valid(), `rewrite of "/app/*" must be forced with ! as it applies even when the path exists`)
+	assert.EqualError(Rule{From: "news", To: "/blog"}.Valid(), `from "news" must start with /`)
+	assert.EqualError(Rule{From: "/news/*/all", To: "/blog"}.Valid(), `from "/news/*/all" can only end in /*`)
+	assert.EqualError(Rule{From: "/news", To: "https://example.com", Status: StatusRewrite}.Valid(), `rewrite to "https://example.com" must be a path`)
+	assert.EqualError(Rule{From: "/news", To: "/blog", Status: 404}.Valid(), `invalid status 404 for "/news" must be 200, 301, 302, 303, 307 or 308`)
+	assert.EqualError(Rule{From: "/news"}.Valid(), `empty to for "/news"`)
+}
+
+func TestParse(t *testing.T) {
+	assert := require.New(t)
+
+	rules, err := Parse("_redirects", []byte(`
+# netlify style
+/old        /new
+/news/*     /blog/:splat   302
+/start      /guide.html    200!
+/legacy     /new           301!
+`))
+	assert.NoError(err)
+	assert.Equal([]Rule{
+		{From: "/old", To: "/new"},
+		{From: "/news/*", To: "/blog/:splat", Status: 302},
+		{From: "/start", To: "/guide.html", Status: 200, Force: true},
+		{From: "/legacy", To: "/new", Status: 301, Force: true},
+	}, rules)
+
+	rules, err = Parse("redirects.json", []byte(`[{"from": "/old", "to": "/new", "status": 308}]`))
+	assert.NoError(err)
+	assert.Equal([]Rule{{From: "/old", To: "/new", Status: 308}}, rules)
+
+	rules, err = Parse("redirects.json", []byte(`{"/a": "/b", "/a/b": "/c"}`))
+	assert.NoError(err)
+	assert.Equal([]Rule{{From: "/a/b", To: "/c"}, {From: "/a", To: "/b"}}, rules)
+
+	_, err = Parse("_redirects", []byte("/old /new 302\n/missing"))
+	assert.EqualError(err, "failed to parse _redirects line 2: expected from, to and an optional status")
+
+	_, err = Parse("_redirects", []byte("/app/* /index.html 200"))
+	assert.EqualError(err, `invalid _redirects rule 1: rewrite of "/app/*" must be forced with ! as it applies even when the path exists`)
+
+	_, err = Parse("_redirects", []byte("/old /new 404"))
+	assert.EqualError(err, `invalid _redirects rule 1: invalid status 404 for "/old" must be 200, 301, 302, 303, 307 or 308`)
+}
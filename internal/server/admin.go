@@ -0,0 +1,268 @@
+package server
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/wolfeidau/website-openid-proxy/internal/audit"
+	"github.com/wolfeidau/website-openid-proxy/internal/registry"
+)
+
+var adminTemplate = template.Must(template.New("admin").Funcs(template.FuncMap{
+	"date": func(sec int64) string { return time.Unix(sec, 0).UTC().Format(time.RFC3339) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><title>Admin</title></head>
+<body>
+<h1>Admin</h1>
+{{if .Registry}}<h2>Sessions</h2>
+<table>
+<tr><th>Email</th><th>Subject</th><th>Issuer</th><th>Created</th><th>Last seen</th><th>IP</th><th>User agent</th><th></th></tr>
+{{range .Sessions}}<tr><td>{{.Email}}</td><td>{{.Subject}}</td><td>{{.Issuer}}</td><td>{{date .CreatedAt}}</td><td>{{date .LastSeen}}</td><td>{{.IP}}</td><td>{{.UserAgent}}</td>
+<td><form method="post" action="{{$.Action}}/sessions/revoke"><input type="hidden" name="_csrf" value="{{$.Token}}"><input type="hidden" name="id" value="{{.ID}}"><button type="submit">Revoke</button></form></td></tr>
+{{end}}</table>
+<form method="post" action="{{.Action}}/sessions/revoke">
+<input type="hidden" name="_csrf" value="{{.Token}}">
+<label>Subject <input name="sub" required></label>
+<button type="submit">Revoke all sessions and tokens</button>
+</form>
+{{end}}<h2>Recent events</h2>
+<table>
+<tr><th>Time</th><th>Action</th><th>Email</th><th>Path</th><th>Allowed</th></tr>
+{{range .Events}}<tr><td>{{.Time.UTC.Format "2006-01-02T15:04:05Z07:00"}}</td><td>{{.Action}}</td><td>{{.Email}}</td><td>{{.Path}}</td><td>{{.Allowed}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// RevokeRequest revokes a single session by id, or all the sessions of a subject
+type RevokeRequest struct {
+	ID  string `json:"id" form:"id"`
+	Sub string `json:"sub" form:"sub"`
+}
+
+// RevokeResponse the number of sessions, and personal access tokens when revoking all the sessions of a subject,
+// which were revoked
+type RevokeResponse struct {
+	Revoked int `json:"revoked"`
+	Tokens  int `json:"tokens"`
+}
+
+// RequireAdmin restricts the admin routes to logged in users with the configured admin role, the user is
+// attached to the request so it is available to the handlers using CurrentUser.
+func (l *Auth) RequireAdmin() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			info, err := l.sessionUser(c)
+			if err != nil {
+				return c.String(http.StatusUnauthorized, "failed to process request")
+			}
+
+			if !l.isAdmin(info) {
+				l.audit.Record(c.Request().Context(), audit.Event{
+					Action:  "admin",
+					Subject: info.Sub,
+					Email:   info.Email,
+					Path:    c.Request().URL.Path,
+				})
+
+				return c.String(http.StatusForbidden, "forbidden")
+			}
+
+			c.Set(userContextKey, info)
+
+			return next(c)
+		}
+	}
+}
+
+// Admin admin http handler which renders the active sessions and recent audit events
+func (l *Auth) Admin(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	list, err := l.listSessions(c, "")
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to list sessions")
+
+		// TODO: Need an error page
+		return c.String(http.StatusInternalServerError, "failed to process request")
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	c.Response().WriteHeader(http.StatusOK)
+
+	return adminTemplate.Execute(c.Response(), map[string]interface{}{
+		"Action":   l.authConfig.AuthPrefix + "/admin",
+		"Token":    csrfToken(c),
+		"Registry": l.sessions != nil,
+		"Sessions": list,
+		"Events":   l.auditEvents(),
+	})
+}
+
+// Sessions sessions http handler which lists the active sessions, optionally filtered by the sub parameter
+func (l *Auth) Sessions(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	list, err := l.listSessions(c, c.QueryParam("sub"))
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to list sessions")
+
+		// TODO: Need an error page
+		return c.String(http.StatusInternalServerError, "failed to process request")
+	}
+
+	return c.JSON(http.StatusOK, list)
+}
+
+// RevokeSessions revoke sessions http handler, this removes the session with the id, or all the sessions of
+// the subject, from the registry so they can't be used again. The personal access tokens of the subject are
+// also deleted so they can't be used to keep access.
+func (l *Auth) RevokeSessions(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	req := new(RevokeRequest)
+
+	err := c.Bind(req)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "failed to process request")
+	}
+
+	if (req.ID == "") == (req.Sub == "") {
+		return c.String(http.StatusBadRequest, "either id or sub is required")
+	}
+
+	var ids []string
+
+	if req.ID != "" {
+		_, err = l.sessions.Get(ctx, req.ID)
+		if errors.Is(err, registry.ErrNotFound) {
+			return c.String(http.StatusNotFound, "not found")
+		}
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("failed to get session")
+
+			// TODO: Need an error page
+			return c.String(http.StatusInternalServerError, "failed to process request")
+		}
+
+		ids = append(ids, req.ID)
+	} else {
+		list, err := l.sessions.List(ctx, req.Sub)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("failed to list sessions")
+
+			// TODO: Need an error page
+			return c.String(http.StatusInternalServerError, "failed to process request")
+		}
+
+		for _, sess := range list {
+			ids = append(ids, sess.ID)
+		}
+	}
+
+	for _, id := range ids {
+		err = l.sessions.Delete(ctx, id)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("failed to delete session")
+
+			// TODO: Need an error page
+			return c.String(http.StatusInternalServerError, "failed to process request")
+		}
+	}
+
+	var tokenIDs []string
+
+	if req.Sub != "" && l.tokens != nil {
+		list, err := l.tokens.List(ctx, req.Sub)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("failed to list tokens")
+
+			// TODO: Need an error page
+			return c.String(http.StatusInternalServerError, "failed to process request")
+		}
+
+		for _, t := range list {
+			tokenIDs = append(tokenIDs, t.ID)
+		}
+	}
+
+	for _, id := range tokenIDs {
+		err = l.tokens.Delete(ctx, id)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("failed to delete token")
+
+			// TODO: Need an error page
+			return c.String(http.StatusInternalServerError, "failed to process request")
+		}
+	}
+
+	info := CurrentUser(c)
+
+	evt := audit.Event{
+		Action:  "session_revoke",
+		Subject: info.Sub,
+		Email:   info.Email,
+		Allowed: true,
+		Fields:  map[string]interface{}{"revoked": len(ids), "tokens": len(tokenIDs)},
+	}
+
+	if req.ID != "" {
+		evt.Fields["session_id"] = req.ID
+	} else {
+		evt.Fields["target_sub"] = req.Sub
+	}
+
+	l.audit.Record(ctx, evt)
+
+	// browsers submitting the form are returned to the admin page
+	if c.FormValue(csrfFormField) != "" {
+		return c.Redirect(http.StatusSeeOther, l.authConfig.AuthPrefix+"/admin")
+	}
+
+	return c.JSON(http.StatusOK, &RevokeResponse{Revoked: len(ids), Tokens: len(tokenIDs)})
+}
+
+// AuditEvents audit events http handler which lists the recent audit events, most recent first
+func (l *Auth) AuditEvents(c echo.Context) error {
+	return c.JSON(http.StatusOK, l.auditEvents())
+}
+
+// listSessions returns the unexpired sessions of the subject, or of all users when the subject is empty
+func (l *Auth) listSessions(c echo.Context, subject string) ([]*registry.Session, error) {
+	list := []*registry.Session{}
+
+	if l.sessions == nil {
+		return list, nil
+	}
+
+	all, err := l.sessions.List(c.Request().Context(), subject)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	for _, sess := range all {
+		if sess.Expired(now) {
+			continue
+		}
+
+		list = append(list, sess)
+	}
+
+	return list, nil
+}
+
+func (l *Auth) auditEvents() []audit.Event {
+	if l.history == nil {
+		return []audit.Event{}
+	}
+
+	return l.history.Events()
+}
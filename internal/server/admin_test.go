@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dghubble/sessions"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/website-openid-proxy/internal/audit"
+	"github.com/wolfeidau/website-openid-proxy/internal/echosessions"
+	"github.com/wolfeidau/website-openid-proxy/internal/registry"
+	"github.com/wolfeidau/website-openid-proxy/internal/tokens"
+)
+
+func TestAdmin(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := newConfig()
+	cfg.Claims = []string{"groups"}
+	cfg.AdminClaim = "groups"
+	cfg.AdminRole = "admins"
+
+	reg := registry.NewMemoryStore()
+	history := audit.NewHistory(10)
+
+	tokenStore := tokens.NewMemoryStore()
+	assert.NoError(tokenStore.Put(context.TODO(), &tokens.Token{ID: "abc", Subject: "abc123"}))
+	assert.NoError(tokenStore.Put(context.TODO(), &tokens.Token{ID: "def", Subject: "def456"}))
+
+	auth, err := NewAuth(cfg, mockProviderFunc, WithSessionRegistry(reg), WithAuditHistory(history), WithTokenStore(tokenStore))
+	assert.NoError(err)
+
+	store := sessions.NewCookieStore[string](sessions.DefaultCookieConfig, []byte("test"), nil)
+
+	login := func(info *UserInfo) []*http.Cookie {
+		req := httptest.NewRequest(http.MethodGet, "/auth/callback", nil)
+		req.Header.Set("User-Agent", "curl/8.0")
+		req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.1")
+
+		rec := serveSSO(t, store, func(c echo.Context) error {
+			return auth.saveLogin(c, info)
+		}, req)
+
+		return rec.Result().Cookies()
+	}
+
+	user := login(&UserInfo{Sub: "abc123", Email: "mark@wolfe.id.au", Issuer: "http://localhost"})
+	admin := login(&UserInfo{Sub: "def456", Email: "admin@example.com", Claims: map[string]interface{}{"groups": []interface{}{"admins"}}})
+
+	serve := func(method, target, body string, cookies []*http.Cookie, handler echo.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		addCookies(req, cookies)
+
+		return serveSSO(t, store, auth.RequireAdmin()(handler), req)
+	}
+
+	// content is served while the session is in the registry
+	e := echo.New()
+	e.Use(echosessions.Middleware(store))
+	e.Use(CheckAuthWithConfig(Config{Registry: reg}))
+	e.GET("/*", func(c echo.Context) error {
+		return c.String(http.StatusOK, CurrentUser(c).Email)
+	})
+
+	content := func(cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/docs/index.html", nil)
+		addCookies(req, cookies)
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	assert.Equal(http.StatusOK, content(user).Code)
+
+	rec := serve(http.MethodGet, "/auth/admin/sessions", "", user, auth.Sessions)
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = serve(http.MethodGet, "/auth/admin/sessions?sub=abc123", "", admin, auth.Sessions)
+	assert.Equal(http.StatusOK, rec.Code)
+
+	var list []*registry.Session
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &list))
+	assert.Len(list, 1)
+	assert.Equal("mark@wolfe.id.au", list[0].Email)
+	assert.Equal("http://localhost", list[0].Issuer)
+	assert.Equal("curl/8.0", list[0].UserAgent)
+	assert.Equal("192.0.2.1", list[0].IP)
+
+	rec = serve(http.MethodPost, "/auth/admin/sessions/revoke", `{"id": "missing"}`, admin, auth.RevokeSessions)
+	assert.Equal(http.StatusNotFound, rec.Code)
+
+	rec = serve(http.MethodPost, "/auth/admin/sessions/revoke", `{}`, admin, auth.RevokeSessions)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = serve(http.MethodPost, "/auth/admin/sessions/revoke", `{"id": "`+list[0].ID+`"}`, admin, auth.RevokeSessions)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal(`{"revoked":1,"tokens":0}`+"\n", rec.Body.String())
+
+	// the revoked session is sent to login
+	assert.Equal(http.StatusFound, content(user).Code)
+
+	rec = serve(http.MethodPost, "/auth/admin/sessions/revoke", `{"sub": "def456"}`, admin, auth.RevokeSessions)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal(`{"revoked":1,"tokens":1}`+"\n", rec.Body.String())
+
+	// the tokens of the subject are revoked with their sessions
+	_, err = tokenStore.Get(context.TODO(), "def")
+	assert.ErrorIs(err, tokens.ErrNotFound)
+	_, err = tokenStore.Get(context.TODO(), "abc")
+	assert.NoError(err)
+
+	// admins revoking their own session are no longer admins
+	rec = serve(http.MethodGet, "/auth/admin/events", "", admin, auth.AuditEvents)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+
+	var actions []string
+	for _, evt := range history.Events() {
+		actions = append(actions, evt.Action)
+	}
+
+	assert.Equal([]string{"session_revoke", "session_revoke", "admin", "login", "login"}, actions)
+
+	admin = login(&UserInfo{Sub: "def456", Email: "admin@example.com", Claims: map[string]interface{}{"groups": []interface{}{"admins"}}})
+
+	rec = serve(http.MethodGet, "/auth/admin", "", admin, auth.Admin)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), "<td>admin@example.com</td><td>def456</td>")
+	assert.Contains(rec.Body.String(), "<td>session_revoke</td>")
+
+	rec = serve(http.MethodGet, "/auth/admin/events", "", admin, auth.AuditEvents)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), `"action":"login"`)
+}
+
+func TestLogout_Registry(t *testing.T) {
+	assert := require.New(t)
+
+	reg := registry.NewMemoryStore()
+
+	auth, err := NewAuth(newConfig(), mockProviderFunc, WithSessionRegistry(reg))
+	assert.NoError(err)
+
+	store := sessions.NewCookieStore[string](sessions.DefaultCookieConfig, []byte("test"), nil)
+
+	rec := serveSSO(t, store, func(c echo.Context) error {
+		return auth.saveLogin(c, &UserInfo{Sub: "abc123", Email: "mark@wolfe.id.au"})
+	}, httptest.NewRequest(http.MethodGet, "/auth/callback", nil))
+
+	list, err := reg.List(context.TODO(), "abc123")
+	assert.NoError(err)
+	assert.Len(list, 1)
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	addCookies(req, rec.Result().Cookies())
+
+	rec = serveSSO(t, store, auth.Logout, req)
+	assert.Equal(http.StatusOK, rec.Code)
+
+	list, err = reg.List(context.TODO(), "abc123")
+	assert.NoError(err)
+	assert.Empty(list)
+}
@@ -0,0 +1,139 @@
+/*! website-openid-proxy client v1 */
+(function (window, document) {
+  "use strict";
+
+  var VERSION = "1";
+  var SILENT_MESSAGE = "proxy-auth-silent";
+  var SILENT_TIMEOUT = 10000;
+
+  // routes are served relative to the auth prefix this script was loaded from
+  var prefix = (function () {
+    var script = document.currentScript;
+    if (script && script.src) {
+      var path = new URL(script.src, window.location.href).pathname;
+      return path.replace(/\/client\.js$/, "");
+    }
+    return "/auth";
+  })();
+
+  function getUser() {
+    return window
+      .fetch(prefix + "/userinfo", {
+        credentials: "same-origin",
+        headers: { Accept: "application/json" },
+      })
+      .then(function (res) {
+        if (res.status === 401) {
+          return null;
+        }
+        if (!res.ok) {
+          throw new Error("userinfo request failed: " + res.status);
+        }
+        return res.json();
+      });
+  }
+
+  // expiresAt returns the earliest expiry of the session in milliseconds
+  function expiresAt(user) {
+    var times = [user.session_expires_at, user.idle_expires_at].filter(function (t) {
+      return t > 0;
+    });
+    if (times.length === 0) {
+      return 0;
+    }
+    return Math.min.apply(null, times) * 1000;
+  }
+
+  function onSessionExpiring(callback, options) {
+    var before = (options && options.before) || 60000;
+    var timer = null;
+    var cancelled = false;
+
+    getUser().then(function (user) {
+      if (cancelled || !user) {
+        return;
+      }
+      var expires = expiresAt(user);
+      if (!expires) {
+        return;
+      }
+      timer = window.setTimeout(function () {
+        callback(user);
+      }, Math.max(0, expires - before - Date.now()));
+    });
+
+    return function cancel() {
+      cancelled = true;
+      if (timer) {
+        window.clearTimeout(timer);
+      }
+    };
+  }
+
+  function renew() {
+    return new Promise(function (resolve) {
+      var iframe = document.createElement("iframe");
+      var timer;
+
+      function done(ok) {
+        window.clearTimeout(timer);
+        window.removeEventListener("message", listener);
+        if (iframe.parentNode) {
+          iframe.parentNode.removeChild(iframe);
+        }
+        resolve(ok);
+      }
+
+      function listener(event) {
+        if (event.origin !== window.location.origin || event.source !== iframe.contentWindow) {
+          return;
+        }
+        if (event.data && event.data.type === SILENT_MESSAGE) {
+          done(event.data.ok === true);
+        }
+      }
+
+      window.addEventListener("message", listener);
+      timer = window.setTimeout(function () {
+        done(false);
+      }, SILENT_TIMEOUT);
+
+      iframe.style.display = "none";
+      iframe.src = prefix + "/silent";
+      document.body.appendChild(iframe);
+    });
+  }
+
+  function login(returnTo) {
+    var target = returnTo || window.location.pathname + window.location.search + window.location.hash;
+    window.location.assign(prefix + "/login?return_to=" + encodeURIComponent(target));
+  }
+
+  function logout() {
+    return getUser().then(function (user) {
+      if (!user) {
+        return;
+      }
+      return window
+        .fetch(prefix + "/logout", {
+          method: "POST",
+          credentials: "same-origin",
+          headers: { "X-CSRF-Token": user.csrf_token },
+        })
+        .then(function (res) {
+          if (!res.ok) {
+            throw new Error("logout request failed: " + res.status);
+          }
+        });
+    });
+  }
+
+  window.ProxyAuth = {
+    version: VERSION,
+    getUser: getUser,
+    onSessionExpiring: onSessionExpiring,
+    renew: renew,
+    login: login,
+    logout: logout,
+  };
+})(window, document);
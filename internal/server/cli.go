@@ -0,0 +1,81 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/coreos/go-oidc"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/wolfeidau/website-openid-proxy/internal/tokens"
+)
+
+// CLIConfig tells proxy-cli which openid provider and client to login with
+type CLIConfig struct {
+	Issuer   string   `json:"issuer"`
+	ClientID string   `json:"client_id"`
+	Scopes   []string `json:"scopes"`
+}
+
+// CLI discovery http handler, this is public so the cli can find the openid provider before it logs in.
+func (l *Auth) CLI(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-cache")
+
+	return c.JSON(http.StatusOK, &CLIConfig{
+		Issuer:   l.authConfig.Issuer,
+		ClientID: l.authConfig.CLIClientID,
+		Scopes:   l.authConfig.Scopes,
+	})
+}
+
+// VerifyBearer verifies a personal access token or an id token issued to the cli client, returning the user it
+// identifies. The session ends when the token expires.
+func (l *Auth) VerifyBearer(c echo.Context, token string) (*UserInfo, error) {
+	ctx := c.Request().Context()
+
+	if tokens.IsToken(token) {
+		if l.tokens == nil {
+			return nil, errors.New("personal access tokens aren't enabled")
+		}
+
+		return l.verifyToken(c, token)
+	}
+
+	if l.authConfig.CLIClientID == "" {
+		return nil, errors.New("cli client isn't configured")
+	}
+
+	provider, err := l.provider.Get(ctx)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to get openid provider")
+		return nil, err
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: l.authConfig.CLIClientID}).Verify(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify id token: %w", err)
+	}
+
+	claims := map[string]interface{}{}
+
+	err = idToken.Claims(&claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read id token claims: %w", err)
+	}
+
+	info := &UserInfo{
+		Sub:              idToken.Subject,
+		Issuer:           idToken.Issuer,
+		SessionExpiresAt: idToken.Expiry.Unix(),
+		Claims:           selectClaims(claims, l.authConfig.Claims),
+	}
+
+	info.Email, _ = claims["email"].(string)
+
+	if authTime, ok := claims["auth_time"].(float64); ok {
+		info.AuthTime = int64(authTime)
+	}
+
+	return info, nil
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/website-openid-proxy/internal/logger"
+)
+
+func TestCLI(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := newConfig()
+	cfg.CLIClientID = "cli123"
+
+	auth, err := NewAuth(cfg, mockProviderFunc)
+	assert.NoError(err)
+
+	e := echo.New()
+	auth.RegisterRoutes(e.Group("/auth"))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/cli", nil))
+
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.JSONEq(`{"issuer":"http://localhost","client_id":"cli123","scopes":["openid","email"]}`, rec.Body.String())
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(logger.NewLoggerWithContext(context.TODO()))
+
+	_, err = auth.VerifyBearer(e.NewContext(req, httptest.NewRecorder()), "not-a-token")
+	assert.Error(err)
+
+	// the route is only available when the cli client is configured
+	auth, err = NewAuth(newConfig(), mockProviderFunc)
+	assert.NoError(err)
+
+	e = echo.New()
+	auth.RegisterRoutes(e.Group("/auth"))
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/cli", nil))
+
+	assert.Equal(http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	csrfCookieName = "proxy_csrf"
+	csrfContextKey = "csrf"
+	csrfFormField  = "_csrf"
+)
+
+var logoutTemplate = template.Must(template.New("logout").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Logout</title></head>
+<body>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="` + csrfFormField + `" value="{{.Token}}">
+<button type="submit">Logout</button>
+</form>
+</body>
+</html>
+`))
+
+// CSRF protects the state changing auth routes, the token is stored in a cookie scoped to the auth routes
+// and must be supplied in the X-CSRF-Token header or the _csrf form field.
+func (l *Auth) CSRF() echo.MiddlewareFunc {
+	policy := l.authConfig.Cookies.Login
+
+	path := l.authConfig.AuthPrefix
+	if policy.NamePrefix == "__Host-" {
+		path = "/"
+	}
+
+	return middleware.CSRFWithConfig(middleware.CSRFConfig{
+		TokenLookup:    "header:" + echo.HeaderXCSRFToken + ",form:" + csrfFormField,
+		ContextKey:     csrfContextKey,
+		CookieName:     policy.NamePrefix + csrfCookieName,
+		CookiePath:     path,
+		CookieSecure:   policy.Secure == nil || *policy.Secure,
+		CookieHTTPOnly: true,
+		CookieSameSite: http.SameSiteStrictMode,
+	})
+}
+
+// LogoutForm renders a form which submits the logout request along with the CSRF token
+func (l *Auth) LogoutForm(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+	c.Response().WriteHeader(http.StatusOK)
+
+	return logoutTemplate.Execute(c.Response(), map[string]string{
+		"Action": l.authConfig.AuthPrefix + "/logout",
+		"Token":  csrfToken(c),
+	})
+}
+
+func csrfToken(c echo.Context) string {
+	token, _ := c.Get(csrfContextKey).(string)
+	return token
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dghubble/sessions"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/website-openid-proxy/internal/echosessions"
+	"github.com/wolfeidau/website-openid-proxy/internal/logger"
+)
+
+func TestLogout_CSRF(t *testing.T) {
+	assert := require.New(t)
+
+	auth, err := NewAuth(newConfig(), mockProviderFunc)
+	assert.NoError(err)
+
+	e := echo.New()
+	e.Use(echosessions.Middleware(sessions.NewCookieStore[string](sessions.DefaultCookieConfig, []byte("test"), nil)))
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.SetRequest(c.Request().WithContext(logger.NewLoggerWithContext(context.TODO())))
+			return next(c)
+		}
+	})
+
+	auth.RegisterRoutes(e.Group("/auth"))
+
+	// the form includes the token
+	req := httptest.NewRequest(http.MethodGet, "/auth/logout", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(http.StatusOK, rec.Code)
+
+	var csrfCookie *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == csrfCookieName {
+			csrfCookie = cookie
+		}
+	}
+	assert.NotNil(csrfCookie)
+	assert.Contains(rec.Body.String(), `value="`+csrfCookie.Value+`"`)
+
+	// posting without the token is rejected
+	req = httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.AddCookie(csrfCookie)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/auth/logout", strings.NewReader(url.Values{csrfFormField: {"wrong"}}.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.AddCookie(csrfCookie)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/auth/logout", strings.NewReader(url.Values{csrfFormField: {csrfCookie.Value}}.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.AddCookie(csrfCookie)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(http.StatusSeeOther, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.Header.Set(echo.HeaderXCSRFToken, csrfCookie.Value)
+	req.AddCookie(csrfCookie)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(http.StatusOK, rec.Code)
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const headerXForwardedHost = "X-Forwarded-Host"
+
+// ErrHostNotAllowed returned when the request host isn't in the list of allowed hosts
+var ErrHostNotAllowed = errors.New("request host not allowed")
+
+// RequestHost returns the host the client used to make the request, preferring the X-Forwarded-Host
+// header set by proxies such as API Gateway and CloudFront.
+func RequestHost(c echo.Context) string {
+	if fwd := c.Request().Header.Get(headerXForwardedHost); fwd != "" {
+		// only the first entry is used as each proxy appends to the list
+		return strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+
+	return c.Request().Host
+}
+
+// HostAllowed checks the host against the allowed list, entries prefixed with "*." match any sub domain.
+func HostAllowed(allowed []string, host string) bool {
+	host = strings.ToLower(host)
+
+	for _, a := range allowed {
+		a = strings.ToLower(a)
+
+		if strings.HasPrefix(a, "*.") {
+			if strings.HasSuffix(host, a[1:]) && len(host) > len(a)-1 {
+				return true
+			}
+			continue
+		}
+
+		if a == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RequestURL builds an absolute URL for the path using the scheme and host of the current request,
+// the host must be in the allowed list.
+func RequestURL(c echo.Context, allowed []string, path string) (string, error) {
+	host := RequestHost(c)
+
+	if !HostAllowed(allowed, host) {
+		return "", ErrHostNotAllowed
+	}
+
+	u := &url.URL{Scheme: c.Scheme(), Host: host, Path: path}
+
+	return u.String(), nil
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostAllowed(t *testing.T) {
+	allowed := []string{"site.example.com", "*.docs.example.com"}
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{host: "site.example.com", want: true},
+		{host: "SITE.example.com", want: true},
+		{host: "api.docs.example.com", want: true},
+		{host: "docs.example.com", want: false},
+		{host: "evildocs.example.com", want: false},
+		{host: "example.com", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			require.Equal(t, tt.want, HostAllowed(allowed, tt.host))
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+
+	"github.com/labstack/echo/v4"
+	"github.com/wolfeidau/website-openid-proxy/internal/content"
+	"github.com/wolfeidau/website-openid-proxy/internal/flags"
+)
+
+var headClosePattern = regexp.MustCompile(`(?i)</head\s*>`)
+
+// injected the value assigned to the global variable in HTML documents
+type injected struct {
+	Config map[string]interface{} `json:"config"`
+	User   map[string]interface{} `json:"user"`
+}
+
+// InjectRewriter returns a rewriter which adds a script assigning the config and the claims of the current user to
+// a global variable, the user is null when nobody is logged in. The script is added before the end of the head, it
+// must run before NonceRewriter so the script is given the nonce required by the content security policy.
+func InjectRewriter(cfg flags.Inject) content.Rewriter {
+	if cfg.Variable == "" {
+		cfg.Variable = flags.DefaultInjectVariable
+	}
+
+	return func(c echo.Context, body []byte) ([]byte, error) {
+		value := injected{Config: cfg.Config}
+
+		if info := CurrentUser(c); info != nil {
+			value.User = userClaims(info, cfg.Claims)
+		}
+
+		// the json encoder escapes <, > and & so the value can't close the script tag
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+
+		script := []byte("<script>window." + cfg.Variable + " = " + string(data) + ";</script>")
+
+		loc := headClosePattern.FindIndex(body)
+		if loc == nil {
+			// documents without a head still run the script before their own
+			return append(script, body...), nil
+		}
+
+		buf := bytes.NewBuffer(make([]byte, 0, len(body)+len(script)))
+		buf.Write(body[:loc[0]])
+		buf.Write(script)
+		buf.Write(body[loc[0]:])
+
+		return buf.Bytes(), nil
+	}
+}
+
+// userClaims returns the listed claims of the user which are set
+func userClaims(info *UserInfo, claims []string) map[string]interface{} {
+	values := make(map[string]interface{})
+
+	for _, claim := range claims {
+		switch claim {
+		case "sub":
+			values[claim] = info.Sub
+		case "email":
+			values[claim] = info.Email
+		default:
+			if v, ok := info.Claims[claim]; ok {
+				values[claim] = v
+			}
+		}
+	}
+
+	return values
+}
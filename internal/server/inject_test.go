@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/website-openid-proxy/internal/flags"
+)
+
+func TestInjectRewriter(t *testing.T) {
+	assert := require.New(t)
+
+	rw := InjectRewriter(flags.Inject{
+		Config: map[string]interface{}{"api_url": "https://api.example.com", "banner": "</script><script>alert(1)</script>"},
+		Claims: []string{"email", "name", "picture"},
+	})
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+	body, err := rw(c, []byte("<html><head><title>app</title></HEAD><body></body></html>"))
+	assert.NoError(err)
+	assert.Equal(`<html><head><title>app</title><script>window.__PROXY_CONFIG__ = {"config":{"api_url":"https://api.example.com","banner":"\u003c/script\u003e\u003cscript\u003ealert(1)\u003c/script\u003e"},"user":null};</script></HEAD><body></body></html>`, string(body))
+
+	c.Set(userContextKey, &UserInfo{Sub: "abc123", Email: "user@example.com", CSRFToken: "token", Claims: map[string]interface{}{"name": "User", "groups": []string{"ops"}}})
+
+	body, err = rw(c, []byte("<p>no head</p>"))
+	assert.NoError(err)
+	assert.Equal(`<script>window.__PROXY_CONFIG__ = {"config":{"api_url":"https://api.example.com","banner":"\u003c/script\u003e\u003cscript\u003ealert(1)\u003c/script\u003e"},"user":{"email":"user@example.com","name":"User"}};</script><p>no head</p>`, string(body))
+}
+
+func TestInjectRewriter_Nonce(t *testing.T) {
+	assert := require.New(t)
+
+	rw := InjectRewriter(flags.Inject{Variable: "appConfig", Config: map[string]interface{}{"stage": "dev"}})
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	c.Set(nonceContextKey, "abc")
+
+	body, err := rw(c, []byte("<head></head>"))
+	assert.NoError(err)
+
+	body, err = NonceRewriter(c, body)
+	assert.NoError(err)
+	assert.Equal(`<head><script nonce="abc">window.appConfig = {"config":{"stage":"dev"},"user":null};</script></head>`, string(body))
+}
@@ -1,26 +1,30 @@
 package server
 
 import (
-	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/coreos/go-oidc"
-	"github.com/dghubble/sessions"
 	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog/log"
+	"github.com/wolfeidau/website-openid-proxy/internal/audit"
 	"github.com/wolfeidau/website-openid-proxy/internal/echosessions"
 	"github.com/wolfeidau/website-openid-proxy/internal/flags"
 	"github.com/wolfeidau/website-openid-proxy/internal/pkce"
+	"github.com/wolfeidau/website-openid-proxy/internal/registry"
+	"github.com/wolfeidau/website-openid-proxy/internal/session"
+	"github.com/wolfeidau/website-openid-proxy/internal/ticket"
+	"github.com/wolfeidau/website-openid-proxy/internal/tokens"
 	"golang.org/x/oauth2"
 )
 
 const (
-	authCookieName   = "proxy_auth_session"
-	authCookieExpiry = 5 * 60 // 5 minutes
-
-	loggedInCookieName   = "proxy_login_session"
-	loggedInCookieExpiry = 8 * 60 * 60 // 8 hours
+	authCookieName     = session.AuthCookieName
+	loggedInCookieName = session.LoginCookieName
 
 	stateLength    = 32
 	verifierLength = 32
@@ -30,56 +34,118 @@ const (
 type Callback struct {
 	Code  string `query:"code"`
 	State string `query:"state"`
+	Error string `query:"error"`
 }
 
-// UserInfo user info returned by user info route
-type UserInfo struct {
-	Sub   string `json:"sub,omitempty"`
-	Email string `json:"email,omitempty"`
+// Auth authentication related handlers
+type Auth struct {
+	authConfig *flags.API
+	provider   *Provider
+	tickets    *ticket.Codec
+	sites      *SiteRouter
+	audit      audit.Logger
+	tokens     tokens.Store
+	sessions   registry.Store
+	history    *audit.History
 }
 
-func userInfoFromSession(val *sessions.Session[string]) (*UserInfo, error) {
-	sub, ok := val.GetOk("sub")
-	if !ok {
-		return nil, errors.New("failed to read sub")
+// AuthOption configures optional authentication behaviour
+type AuthOption func(*Auth)
+
+// WithTicketCodec enables single sign on using tickets signed by the codec
+func WithTicketCodec(codec *ticket.Codec) AuthOption {
+	return func(l *Auth) {
+		l.tickets = codec
 	}
-	email, ok := val.GetOk("email")
-	if !ok {
-		return nil, errors.New("failed to read email")
+}
+
+// WithSites enables the share route which issues presigned links to content of the sites
+func WithSites(router *SiteRouter) AuthOption {
+	return func(l *Auth) {
+		l.sites = router
 	}
+}
 
-	return &UserInfo{
-		Sub:   sub,
-		Email: email,
-	}, nil
+// WithAuditLogger records audit events using the logger rather than the request logger
+func WithAuditLogger(logger audit.Logger) AuthOption {
+	return func(l *Auth) {
+		l.audit = logger
+	}
 }
 
-// Auth authentication related handlers
-type Auth struct {
-	authConfig *flags.API
-	provider   *oidc.Provider
+// WithTokenStore enables the routes which manage personal access tokens kept in the store
+func WithTokenStore(store tokens.Store) AuthOption {
+	return func(l *Auth) {
+		l.tokens = store
+	}
+}
+
+// WithSessionRegistry records login sessions in the store so admins can list and revoke them
+func WithSessionRegistry(store registry.Store) AuthOption {
+	return func(l *Auth) {
+		l.sessions = store
+	}
+}
+
+// WithAuditHistory keeps recent audit events in the history so admins can view them
+func WithAuditHistory(history *audit.History) AuthOption {
+	return func(l *Auth) {
+		l.history = history
+	}
 }
 
 // NewAuth new auth server http handlers
-func NewAuth(ac *flags.API, providerFunc ProviderFunc) (*Auth, error) {
+func NewAuth(ac *flags.API, providerFunc ProviderFunc, opts ...AuthOption) (*Auth, error) {
 
 	if providerFunc == nil {
 		return nil, errors.New("missing provider func")
 	}
 
-	provider, err := providerFunc(context.Background(), ac.Issuer)
-	if err != nil {
-		return nil, err
+	// discovery is deferred until the first login so a slow or unavailable provider doesn't block startup
+	provider := NewProvider(ac.Issuer, providerFunc, ac.ProviderRefreshInterval, ac.ProviderRetryAttempts)
+
+	l := &Auth{authConfig: ac, provider: provider, audit: audit.NewLogger()}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	if l.history != nil {
+		l.audit = audit.Multi(l.audit, l.history)
+	}
+
+	if ac.SSOEnabled() && l.tickets == nil {
+		return nil, errors.New("missing ticket codec required for single sign on")
 	}
 
-	return &Auth{authConfig: ac, provider: provider}, nil
+	return l, nil
 }
 
 // Login login http handler
 func (l *Auth) Login(c echo.Context) error {
 
+	// logins are delegated when this site is a client of a central auth host
+	if l.authConfig.CentralAuthURL != "" {
+		return l.loginCentral(c)
+	}
+
+	return l.startLogin(c, false)
+}
+
+// startLogin redirects the user to the openid provider, silent logins use prompt=none so the provider
+// returns immediately rather than showing a login page.
+func (l *Auth) startLogin(c echo.Context, silent bool) error {
+
 	ctx := c.Request().Context()
 
+	provider, err := l.provider.Get(ctx)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to discover provider")
+
+		// TODO: Need an error page
+		return c.String(http.StatusServiceUnavailable, "failed to process request")
+	}
+
 	state := MustRandomState(stateLength)
 	verifier := pkce.MustNewVerifier(verifierLength)
 
@@ -93,12 +159,11 @@ func (l *Auth) Login(c echo.Context) error {
 
 	authSess.Set("state", state)
 	authSess.Set("verifier", verifier)
+	authSess.Set("return_to", safeReturnTo(c.QueryParam("return_to")))
 
-	// override the default cookie settings
-	// authSess.Config.MaxAge = authCookieExpiry
-	// authSess.Config.Secure = true
-	// authSess.Values["state"] = state
-	// authSess.Values["verifier"] = verifier
+	if silent {
+		authSess.Set("silent", "true")
+	}
 
 	err = authSess.Save(c.Response())
 	if err != nil {
@@ -108,11 +173,25 @@ func (l *Auth) Login(c echo.Context) error {
 		return c.String(http.StatusInternalServerError, "failed to process request")
 	}
 
-	redirectURL := l.oauthConfig().AuthCodeURL(state,
+	callbackURL, err := l.callbackURL(c)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("host", RequestHost(c)).Msg("failed to build callback url")
+
+		// TODO: Need an error page
+		return c.String(http.StatusBadRequest, "failed to process request")
+	}
+
+	opts := []oauth2.AuthCodeOption{
 		oauth2.AccessTypeOffline,
 		oauth2.SetAuthURLParam("code_challenge", pkce.MustCodeChallengeS256(verifier)),
 		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
-	)
+	}
+
+	if silent {
+		opts = append(opts, oauth2.SetAuthURLParam("prompt", "none"))
+	}
+
+	redirectURL := l.oauthConfig(provider, callbackURL).AuthCodeURL(state, opts...)
 
 	// send the caller off to their login server
 	return c.Redirect(http.StatusFound, redirectURL)
@@ -159,46 +238,60 @@ func (l *Auth) Callback(c echo.Context) error {
 	// clean up the completed auth session
 	defer authSess.Destroy(c.Response())
 
-	if cb.State == "" && state != cb.State {
+	if cb.State == "" || state != cb.State {
 		log.Ctx(ctx).Error().Err(err).Msg("failed to validate state")
 
 		// TODO: Need an error page
 		return c.String(http.StatusBadRequest, "failed to process request")
 	}
 
-	tokens, err := l.oauthConfig().Exchange(ctx, cb.Code, oauth2.SetAuthURLParam("code_verifier", verifier))
+	silent := authSess.Get("silent") == "true"
+
+	if cb.Error != "" {
+		log.Ctx(ctx).Warn().Str("error", cb.Error).Bool("silent", silent).Msg("openid provider returned an error")
+
+		// silent logins report back to the page which started them
+		if silent {
+			return silentResult(c, false)
+		}
+
+		// TODO: Need an error page
+		return c.String(http.StatusBadRequest, "failed to process request")
+	}
+
+	provider, err := l.provider.Get(ctx)
 	if err != nil {
-		log.Ctx(ctx).Error().Err(err).Msg("failed to exchange tokens")
+		log.Ctx(ctx).Error().Err(err).Msg("failed to discover provider")
 
 		// TODO: Need an error page
-		return c.String(http.StatusInternalServerError, "failed to process request")
+		return c.String(http.StatusServiceUnavailable, "failed to process request")
 	}
 
-	userInfo, err := l.provider.UserInfo(ctx, oauth2.StaticTokenSource(tokens))
+	callbackURL, err := l.callbackURL(c)
 	if err != nil {
-		log.Ctx(ctx).Error().Err(err).Msg("failed to get userinfo")
+		log.Ctx(ctx).Error().Err(err).Str("host", RequestHost(c)).Msg("failed to build callback url")
 
 		// TODO: Need an error page
-		return c.String(http.StatusInternalServerError, "failed to process request")
+		return c.String(http.StatusBadRequest, "failed to process request")
 	}
 
-	loginSess, err := echosessions.New(loggedInCookieName, c)
+	tokens, err := l.oauthConfig(provider, callbackURL).Exchange(ctx, cb.Code, oauth2.SetAuthURLParam("code_verifier", verifier))
 	if err != nil {
-		log.Ctx(ctx).Error().Err(err).Msg("failed to get new session")
+		log.Ctx(ctx).Error().Err(err).Msg("failed to exchange tokens")
 
 		// TODO: Need an error page
 		return c.String(http.StatusInternalServerError, "failed to process request")
 	}
 
-	// override the default cookie settings
-	// loginSess.Config.Secure = true
-	// loginSess.Config.MaxAge = loggedInCookieExpiry
-	// loginSess.Values["email"] = userInfo.Email
-	// loginSess.Values["sub"] = userInfo.Subject
-	loginSess.Set("email", userInfo.Email)
-	loginSess.Set("sub", userInfo.Subject)
+	info, err := l.userInfoFromProvider(ctx, provider, tokens)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to get userinfo")
 
-	err = loginSess.Save(c.Response())
+		// TODO: Need an error page
+		return c.String(http.StatusInternalServerError, "failed to process request")
+	}
+
+	err = l.saveLogin(c, info)
 	if err != nil {
 		log.Ctx(ctx).Error().Err(err).Msg("failed to save session")
 
@@ -206,7 +299,11 @@ func (l *Auth) Callback(c echo.Context) error {
 		return c.String(http.StatusInternalServerError, "failed to process request")
 	}
 
-	return c.Redirect(http.StatusFound, "/")
+	if silent {
+		return silentResult(c, true)
+	}
+
+	return c.Redirect(http.StatusFound, safeReturnTo(authSess.Get("return_to")))
 }
 
 // UserInfo user info http handler
@@ -214,7 +311,7 @@ func (l *Auth) UserInfo(c echo.Context) error {
 
 	ctx := c.Request().Context()
 
-	session, err := echosessions.Get(loggedInCookieName, c)
+	sess, err := echosessions.Get(loggedInCookieName, c)
 	if err != nil {
 		log.Ctx(ctx).Error().Err(err).Msg("failed to get session")
 
@@ -222,7 +319,7 @@ func (l *Auth) UserInfo(c echo.Context) error {
 		return c.String(http.StatusUnauthorized, "failed to process request")
 	}
 
-	info, err := userInfoFromSession(session)
+	info, err := userInfoFromSession(sess)
 	if err != nil {
 		log.Ctx(ctx).Error().Err(err).Msg("failed to read user info from session")
 
@@ -230,6 +327,24 @@ func (l *Auth) UserInfo(c echo.Context) error {
 		return c.String(http.StatusInternalServerError, "failed to process request")
 	}
 
+	if info.Expired(time.Now(), l.authConfig.SessionIdleTimeout) {
+		return c.String(http.StatusUnauthorized, "session expired")
+	}
+
+	err = l.checkSession(ctx, info)
+	if errors.Is(err, ErrSessionRevoked) {
+		return c.String(http.StatusUnauthorized, "session expired")
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to check session registry")
+
+		// TODO: Need an error page
+		return c.String(http.StatusInternalServerError, "failed to process request")
+	}
+
+	info.IdleExpiresAt = info.idleExpiry(l.authConfig.SessionIdleTimeout)
+	info.CSRFToken = csrfToken(c)
+
 	return c.JSON(http.StatusOK, info)
 }
 
@@ -238,6 +353,20 @@ func (l *Auth) Logout(c echo.Context) error {
 
 	ctx := c.Request().Context()
 
+	evt := audit.Event{Action: "logout", Allowed: true}
+
+	if sess, err := echosessions.Get(loggedInCookieName, c); err == nil {
+		evt.Subject, evt.Email = sess.Get("sub"), sess.Get("email")
+
+		// the session can't be used again once it is removed from the registry
+		if sid := sess.Get("sid"); l.sessions != nil && sid != "" {
+			err = l.sessions.Delete(ctx, sid)
+			if err != nil {
+				log.Ctx(ctx).Error().Err(err).Msg("failed to remove session from registry")
+			}
+		}
+	}
+
 	err := echosessions.Destroy(loggedInCookieName, c)
 	if err != nil {
 		log.Ctx(ctx).Error().Err(err).Msg("failed to destroy session")
@@ -246,25 +375,159 @@ func (l *Auth) Logout(c echo.Context) error {
 		return c.String(http.StatusInternalServerError, "failed to process request")
 	}
 
+	l.audit.Record(ctx, evt)
+
+	// browsers submitting the logout form are returned to the site
+	if c.FormValue(csrfFormField) != "" {
+		return c.Redirect(http.StatusSeeOther, "/")
+	}
+
 	return c.NoContent(http.StatusOK)
 }
 
 // RegisterRoutes register the login related auth routes
 func (l *Auth) RegisterRoutes(r interface {
 	GET(string, echo.HandlerFunc, ...echo.MiddlewareFunc) *echo.Route
+	POST(string, echo.HandlerFunc, ...echo.MiddlewareFunc) *echo.Route
 }) {
+	csrf := l.CSRF()
+
 	r.GET("/login", l.Login)
+	r.GET("/silent", l.Silent)
 	r.GET("/callback", l.Callback)
-	r.GET("/userinfo", l.UserInfo)
-	r.GET("/logout", l.Logout)
+	r.GET("/client.js", l.ClientJS)
+	r.GET("/userinfo", l.UserInfo, csrf)
+	r.GET("/logout", l.LogoutForm, csrf)
+	r.POST("/logout", l.Logout, csrf)
+
+	if len(l.authConfig.SSOClientHosts) > 0 {
+		r.GET("/sso", l.SSO)
+	}
+
+	if l.authConfig.CentralAuthURL != "" {
+		r.GET("/ticket", l.Ticket)
+	}
+
+	if l.sites != nil && l.authConfig.ShareTTL > 0 {
+		r.POST("/share", l.Share, csrf)
+	}
+
+	if l.authConfig.CLIClientID != "" {
+		r.GET("/cli", l.CLI)
+	}
+
+	if l.authConfig.AdminRole != "" {
+		admin := l.RequireAdmin()
+
+		r.GET("/admin", l.Admin, csrf, admin)
+		r.GET("/admin/events", l.AuditEvents, admin)
+
+		if l.sessions != nil {
+			r.GET("/admin/sessions", l.Sessions, admin)
+			r.POST("/admin/sessions/revoke", l.RevokeSessions, csrf, admin)
+		}
+	}
+
+	if l.tokens != nil {
+		r.GET("/tokens", l.Tokens, csrf)
+		r.POST("/tokens", l.CreateToken, csrf)
+		r.POST("/tokens/:id/revoke", l.RevokeToken, csrf)
+	}
+}
+
+// saveLogin create the login session for the user
+func (l *Auth) saveLogin(c echo.Context, info *UserInfo) error {
+	loginSess, err := echosessions.New(loggedInCookieName, c)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	if info.AuthTime == 0 {
+		info.AuthTime = now.Unix()
+	}
+
+	info.SessionExpiresAt = now.Add(session.LoginMaxAge(l.authConfig.Cookies.Login)).Unix()
+
+	if l.sessions != nil {
+		err = registerSession(c, l.sessions, info, now)
+		if err != nil {
+			return fmt.Errorf("failed to register session: %w", err)
+		}
+	}
+
+	if l.tokens != nil {
+		err = l.refreshTokens(c.Request().Context(), info, now)
+		if err != nil {
+			return fmt.Errorf("failed to refresh token claims: %w", err)
+		}
+	}
+
+	err = info.save(loginSess, now)
+	if err != nil {
+		return err
+	}
+
+	err = loginSess.Save(c.Response())
+	if err != nil {
+		return err
+	}
+
+	l.audit.Record(c.Request().Context(), audit.Event{
+		Action:  "login",
+		Subject: info.Sub,
+		Email:   info.Email,
+		Allowed: true,
+		Fields:  map[string]interface{}{"issuer": info.Issuer},
+	})
+
+	return nil
 }
 
-func (l *Auth) oauthConfig() *oauth2.Config {
+// callbackURL derives the callback URL from the request host when it is in the allowed list,
+// otherwise the configured redirect URL is used.
+func (l *Auth) callbackURL(c echo.Context) (string, error) {
+	return l.routeURL(c, "/callback")
+}
+
+// routeURL builds an absolute URL for an auth route, derived from the request host when it is in
+// the allowed list, otherwise using the scheme and host of the configured redirect URL.
+func (l *Auth) routeURL(c echo.Context, route string) (string, error) {
+	if len(l.authConfig.AllowedHosts) > 0 {
+		routeURL, err := RequestURL(c, l.authConfig.AllowedHosts, l.authConfig.AuthPrefix+route)
+		if err != ErrHostNotAllowed || l.authConfig.RedirectURL == "" {
+			return routeURL, err
+		}
+	}
+
+	if route == "/callback" {
+		return l.authConfig.RedirectURL, nil
+	}
+
+	u, err := url.Parse(l.authConfig.RedirectURL)
+	if err != nil {
+		return "", err
+	}
+
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: l.authConfig.AuthPrefix + route}).String(), nil
+}
+
+func (l *Auth) oauthConfig(provider *oidc.Provider, redirectURL string) *oauth2.Config {
 	return &oauth2.Config{
 		ClientID:     l.authConfig.ClientID,
 		ClientSecret: l.authConfig.ClientSecret,
-		Endpoint:     l.provider.Endpoint(),
-		RedirectURL:  l.authConfig.RedirectURL,
-		Scopes:       []string{"email", "openid"},
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       l.authConfig.Scopes,
 	}
 }
+
+// safeReturnTo only permits relative paths on this site to avoid open redirects
+func safeReturnTo(returnTo string) string {
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		return "/"
+	}
+
+	return returnTo
+}
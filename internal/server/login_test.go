@@ -2,9 +2,11 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/coreos/go-oidc"
 	"github.com/dghubble/sessions"
@@ -53,6 +55,60 @@ func TestLogin(t *testing.T) {
 	assert.Contains(rec.Result().Header.Get(echo.HeaderLocation), "redirect_uri=http%3A%2F%2Flocalhost%2Fcallback&response_type=code")
 }
 
+func TestLogin_AllowedHost(t *testing.T) {
+
+	assert := require.New(t)
+
+	cfg := newConfig()
+	cfg.AllowedHosts = []string{"*.docs.example.com"}
+
+	auth, err := NewAuth(cfg, mockProviderFunc)
+	assert.NoError(err)
+
+	e := echo.New()
+
+	sessionMiddleware := echosessions.MiddlewareWithConfig(echosessions.Config{
+		Store: sessions.NewCookieStore[string](sessions.DefaultCookieConfig, []byte("test"), nil),
+	})
+
+	h := sessionMiddleware(func(c echo.Context) error {
+		return auth.Login(c)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/login", nil)
+	req = req.WithContext(logger.NewLoggerWithContext(context.TODO()))
+	req.Header.Set("X-Forwarded-Host", "api.docs.example.com")
+	req.Header.Set(echo.HeaderXForwardedProto, "https")
+
+	rec := httptest.NewRecorder()
+
+	err = h(e.NewContext(req, rec))
+	assert.NoError(err)
+	assert.Equal(http.StatusFound, rec.Result().StatusCode)
+	assert.Contains(rec.Result().Header.Get(echo.HeaderLocation), "redirect_uri=https%3A%2F%2Fapi.docs.example.com%2Fauth%2Fcallback")
+
+	// hosts which aren't allowed fall back to the configured redirect url
+	req = httptest.NewRequest(http.MethodGet, "/auth/login", nil)
+	req = req.WithContext(logger.NewLoggerWithContext(context.TODO()))
+	req.Host = "evil.example.com"
+
+	rec = httptest.NewRecorder()
+
+	err = h(e.NewContext(req, rec))
+	assert.NoError(err)
+	assert.Equal(http.StatusFound, rec.Result().StatusCode)
+	assert.Contains(rec.Result().Header.Get(echo.HeaderLocation), "redirect_uri=http%3A%2F%2Flocalhost%2Fcallback")
+
+	// without a fallback the request is rejected
+	cfg.RedirectURL = ""
+
+	rec = httptest.NewRecorder()
+
+	err = h(e.NewContext(req, rec))
+	assert.NoError(err)
+	assert.Equal(http.StatusBadRequest, rec.Result().StatusCode)
+}
+
 func TestUserInfo(t *testing.T) {
 	assert := require.New(t)
 
@@ -96,6 +152,81 @@ func TestUserInfo(t *testing.T) {
 	assert.JSONEq(`{"sub":"abc123","email":"mark@wolfe.id.au"}`, rec.Body.String())
 }
 
+func TestUserInfo_Claims(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := newConfig()
+	cfg.SessionIdleTimeout = 30 * time.Minute
+
+	auth, err := NewAuth(cfg, mockProviderFunc)
+	assert.NoError(err)
+
+	e := echo.New()
+
+	store := sessions.NewCookieStore[string](sessions.DefaultCookieConfig, []byte("test"), nil)
+
+	now := time.Now()
+
+	info := &UserInfo{
+		Sub:              "abc123",
+		Email:            "mark@wolfe.id.au",
+		Issuer:           "http://localhost",
+		AuthTime:         now.Add(-time.Hour).Unix(),
+		SessionExpiresAt: now.Add(time.Hour).Unix(),
+		Claims:           map[string]interface{}{"name": "Mark", "groups": []interface{}{"admins"}},
+	}
+
+	sessRec := httptest.NewRecorder()
+	sess := store.New(loggedInCookieName)
+	assert.NoError(info.save(sess, now))
+	assert.NoError(sess.Save(sessRec))
+
+	req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	req = req.WithContext(logger.NewLoggerWithContext(context.TODO()))
+	req.AddCookie(sessRec.Result().Cookies()[0])
+
+	rec := httptest.NewRecorder()
+
+	h := echosessions.Middleware(store)(auth.UserInfo)
+
+	err = h(e.NewContext(req, rec))
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, rec.Result().StatusCode)
+
+	got := new(UserInfo)
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), got))
+	assert.Equal("http://localhost", got.Issuer)
+	assert.Equal(info.AuthTime, got.AuthTime)
+	assert.Equal(info.SessionExpiresAt, got.SessionExpiresAt)
+	assert.Equal(now.Add(30*time.Minute).Unix(), got.IdleExpiresAt)
+	assert.Equal(info.Claims, got.Claims)
+	assert.Equal([]string{"admins"}, got.Groups())
+}
+
+func TestUserInfo_Expired(t *testing.T) {
+	assert := require.New(t)
+
+	auth, err := NewAuth(newConfig(), mockProviderFunc)
+	assert.NoError(err)
+
+	store := sessions.NewCookieStore[string](sessions.DefaultCookieConfig, []byte("test"), nil)
+
+	sessRec := httptest.NewRecorder()
+	sess := store.New(loggedInCookieName)
+	assert.NoError((&UserInfo{Sub: "abc123", Email: "mark@wolfe.id.au", SessionExpiresAt: time.Now().Add(-time.Minute).Unix()}).save(sess, time.Now()))
+	assert.NoError(sess.Save(sessRec))
+
+	req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	req = req.WithContext(logger.NewLoggerWithContext(context.TODO()))
+	req.AddCookie(sessRec.Result().Cookies()[0])
+
+	rec := httptest.NewRecorder()
+
+	err = echosessions.Middleware(store)(auth.UserInfo)(echo.New().NewContext(req, rec))
+	assert.NoError(err)
+	assert.Equal(http.StatusUnauthorized, rec.Result().StatusCode)
+}
+
 func TestUserInfo_StatusUnauthorized(t *testing.T) {
 	assert := require.New(t)
 
@@ -132,5 +263,7 @@ func newConfig() *flags.API {
 		ClientID:     "abc123",
 		ClientSecret: "cde456",
 		RedirectURL:  "http://localhost/callback",
+		AuthPrefix:   "/auth",
+		Scopes:       []string{"openid", "email"},
 	}
 }
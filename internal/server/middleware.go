@@ -1,31 +1,247 @@
 package server
 
 import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/rs/zerolog/log"
 	"github.com/wolfeidau/website-openid-proxy/internal/echosessions"
+	"github.com/wolfeidau/website-openid-proxy/internal/flags"
+	"github.com/wolfeidau/website-openid-proxy/internal/pathmatch"
+	"github.com/wolfeidau/website-openid-proxy/internal/registry"
 )
 
+const userContextKey = "_user"
+
 type Config struct {
-	Skipper middleware.Skipper
+	Skipper  middleware.Skipper
+	Policies []flags.Policy
+	// LoginURL the path users are redirected to when they aren't logged in, defaults to /auth/login
+	LoginURL string
+	// PublicPaths path patterns which don't require login
+	PublicPaths []string
+	// IdentityAwarePaths path patterns which don't require login, but have the user attached if they are logged in
+	IdentityAwarePaths []string
+	// IdleTimeout how long a session can be idle before it expires, zero disables the idle timeout
+	IdleTimeout time.Duration
+	// Registry of active sessions, when set sessions which aren't in the registry are rejected so they can be revoked
+	Registry registry.Store
+	// Bearer verifies the token of requests with an Authorization bearer header, such as those made by proxy-cli,
+	// these requests don't use the session. Bearer tokens are rejected when this isn't set.
+	Bearer func(c echo.Context, token string) (*UserInfo, error)
+}
+
+// lastSeenInterval limits how often the session is saved to record activity
+const lastSeenInterval = time.Minute
+
+// AuthError returned to API requests which aren't logged in or are denied access
+type AuthError struct {
+	Error    string `json:"error"`
+	LoginURL string `json:"login_url,omitempty"`
+}
+
+// CurrentUser returns the logged in user attached to the request by CheckAuthWithConfig, or nil if there isn't one
+func CurrentUser(c echo.Context) *UserInfo {
+	info, _ := c.Get(userContextKey).(*UserInfo)
+	return info
 }
 
 func CheckAuthWithConfig(cfg Config) echo.MiddlewareFunc {
+	if cfg.Skipper == nil {
+		cfg.Skipper = middleware.DefaultSkipper
+	}
+	if cfg.LoginURL == "" {
+		cfg.LoginURL = "/auth/login"
+	}
+
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			if cfg.Skipper(c) {
 				return next(c)
 			}
 
+			path := c.Request().URL.Path
+
+			// dot segments are resolved by S3 after the path has been matched, so paths such as
+			// /public/%2e%2e/admin/ are rejected rather than matched against the patterns
+			if !pathmatch.IsClean(path) {
+				return c.String(http.StatusBadRequest, "invalid path")
+			}
+
+			// sites have their own policies and public paths
+			policies, publicPaths, identityAwarePaths := cfg.Policies, cfg.PublicPaths, cfg.IdentityAwarePaths
+			if site := CurrentSite(c); site != nil {
+				policies, publicPaths, identityAwarePaths = site.Policies, site.PublicPaths, site.IdentityAwarePaths
+			}
+
+			if pathmatch.MatchAny(publicPaths, path) {
+				return next(c)
+			}
+
+			if token, ok := bearerToken(c); ok {
+				return checkBearer(c, cfg, token, policies, next)
+			}
+
+			optional := pathmatch.MatchAny(identityAwarePaths, path)
+
 			sess, err := echosessions.Get(loggedInCookieName, c)
 			if err != nil {
-				return c.Redirect(302, "/auth/login")
+				if optional {
+					return next(c)
+				}
+				return unauthorized(c, cfg.LoginURL)
 			}
 
 			log.Ctx(c.Request().Context()).Info().Str("email", sess.Get("email")).Msg("user request")
 
+			info, err := userInfoFromSession(sess)
+			if err != nil {
+				if optional {
+					return next(c)
+				}
+				return unauthorized(c, cfg.LoginURL)
+			}
+
+			now := time.Now()
+
+			if info.Expired(now, cfg.IdleTimeout) {
+				if optional {
+					return next(c)
+				}
+				return unauthorized(c, cfg.LoginURL)
+			}
+
+			if cfg.Registry != nil {
+				err = activeSession(c.Request().Context(), cfg.Registry, info, now)
+				if errors.Is(err, ErrSessionRevoked) {
+					if optional {
+						return next(c)
+					}
+					return unauthorized(c, cfg.LoginURL)
+				}
+				if err != nil {
+					log.Ctx(c.Request().Context()).Error().Err(err).Msg("failed to check session registry")
+					return c.String(http.StatusInternalServerError, "failed to process request")
+				}
+			}
+
+			// record activity so the idle timeout is extended
+			if cfg.IdleTimeout > 0 && now.Unix()-info.lastSeen >= int64(lastSeenInterval.Seconds()) {
+				err = info.save(sess, now)
+				if err == nil {
+					err = sess.Save(c.Response())
+				}
+				if err != nil {
+					log.Ctx(c.Request().Context()).Error().Err(err).Msg("failed to update session activity")
+				}
+			}
+
+			c.Set(userContextKey, info)
+
+			if optional {
+				return next(c)
+			}
+
+			if !Authorize(policies, path, info) {
+				return denied(c, info)
+			}
+
 			return next(c)
 		}
 	}
 }
+
+// checkBearer authorises a request using the user identified by its bearer token
+func checkBearer(c echo.Context, cfg Config, token string, policies []flags.Policy, next echo.HandlerFunc) error {
+	if cfg.Bearer == nil {
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_request"`)
+		return c.JSON(http.StatusUnauthorized, &AuthError{Error: "bearer tokens aren't accepted"})
+	}
+
+	info, err := cfg.Bearer(c, token)
+	if err != nil {
+		log.Ctx(c.Request().Context()).Warn().Err(err).Msg("invalid bearer token")
+
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+		return c.JSON(http.StatusUnauthorized, &AuthError{Error: "invalid_token"})
+	}
+
+	log.Ctx(c.Request().Context()).Info().Str("email", info.Email).Msg("user request")
+
+	c.Set(userContextKey, info)
+
+	if !Authorize(policies, c.Request().URL.Path, info) {
+		return denied(c, info)
+	}
+
+	return next(c)
+}
+
+// denied responds to a user who isn't permitted to access the path by the policies
+func denied(c echo.Context, info *UserInfo) error {
+	log.Ctx(c.Request().Context()).Warn().Str("email", info.Email).Str("path", c.Request().URL.Path).Msg("access denied by policy")
+
+	if IsAPIRequest(c) || c.Request().Header.Get(echo.HeaderAuthorization) != "" {
+		return c.JSON(http.StatusForbidden, &AuthError{Error: "forbidden"})
+	}
+
+	return c.String(http.StatusForbidden, "access denied")
+}
+
+// bearerToken returns the token of the Authorization header if it uses the bearer scheme
+func bearerToken(c echo.Context) (string, bool) {
+	scheme, token, ok := strings.Cut(c.Request().Header.Get(echo.HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+
+	return strings.TrimSpace(token), true
+}
+
+// IsAPIRequest returns true if the request was made by a script rather than a browser navigation, this uses
+// the Accept and X-Requested-With headers along with the method.
+func IsAPIRequest(c echo.Context) bool {
+	req := c.Request()
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return true
+	}
+
+	if req.Header.Get(echo.HeaderXRequestedWith) != "" {
+		return true
+	}
+
+	accept := req.Header.Get(echo.HeaderAccept)
+
+	return strings.Contains(accept, echo.MIMEApplicationJSON) && !strings.Contains(accept, echo.MIMETextHTML)
+}
+
+// unauthorized sends browsers to login, returning them to the page they requested, while API requests
+// receive a 401 with the login URL so the calling page can decide what to do.
+func unauthorized(c echo.Context, loginURL string) error {
+	if IsAPIRequest(c) {
+		// after login return to the page which made the request rather than the API
+		if returnTo := refererPath(c); returnTo != "" {
+			loginURL += "?" + url.Values{"return_to": {returnTo}}.Encode()
+		}
+
+		return c.JSON(http.StatusUnauthorized, &AuthError{Error: "unauthorized", LoginURL: loginURL})
+	}
+
+	return c.Redirect(http.StatusFound, loginURL+"?"+url.Values{"return_to": {c.Request().URL.RequestURI()}}.Encode())
+}
+
+// refererPath returns the path of the referring page if it is on this site
+func refererPath(c echo.Context) string {
+	ref, err := url.Parse(c.Request().Referer())
+	if err != nil || !strings.EqualFold(ref.Host, RequestHost(c)) {
+		return ""
+	}
+
+	return ref.RequestURI()
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dghubble/sessions"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/website-openid-proxy/internal/echosessions"
+	"github.com/wolfeidau/website-openid-proxy/internal/flags"
+)
+
+func TestCheckAuthWithConfig(t *testing.T) {
+	store := sessions.NewCookieStore[string](sessions.DefaultCookieConfig, []byte("test"), nil)
+
+	rec := httptest.NewRecorder()
+	sess := store.New(loggedInCookieName)
+	sess.Set("sub", "abc123")
+	sess.Set("email", "mark@wolfe.id.au")
+	require.NoError(t, sess.Save(rec))
+
+	loginCookie := rec.Result().Cookies()[0]
+
+	e := echo.New()
+	e.Use(echosessions.Middleware(store))
+	e.Use(CheckAuthWithConfig(Config{
+		Policies:           []flags.Policy{{Path: "/admin/**", Emails: []string{"admin@example.com"}}},
+		PublicPaths:        []string{"/favicon.ico", "/public/**"},
+		IdentityAwarePaths: []string{"/index.html"},
+	}))
+	e.Any("/*", func(c echo.Context) error {
+		if user := CurrentUser(c); user != nil {
+			return c.String(http.StatusOK, user.Email)
+		}
+		return c.String(http.StatusOK, "anonymous")
+	})
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		headers  map[string]string
+		loggedIn bool
+		code     int
+		body     string
+		location string
+	}{
+		{name: "public", path: "/favicon.ico", code: http.StatusOK, body: "anonymous"},
+		{name: "public prefix", path: "/public/site.css", code: http.StatusOK, body: "anonymous"},
+		{name: "public dot segments", path: "/public/%2e%2e/admin/secret.html", code: http.StatusBadRequest},
+		{name: "public empty segment", path: "/public//site.css", loggedIn: true, code: http.StatusBadRequest},
+		{name: "identity aware anonymous", path: "/index.html", code: http.StatusOK, body: "anonymous"},
+		{name: "identity aware logged in", path: "/index.html", loggedIn: true, code: http.StatusOK, body: "mark@wolfe.id.au"},
+		{name: "protected", path: "/docs/guide.html?page=2", code: http.StatusFound, location: "/auth/login?return_to=%2Fdocs%2Fguide.html%3Fpage%3D2"},
+		{name: "protected logged in", path: "/docs/guide.html", loggedIn: true, code: http.StatusOK, body: "mark@wolfe.id.au"},
+		{name: "denied by policy", path: "/admin/index.html", loggedIn: true, code: http.StatusForbidden},
+		{name: "browser navigation", path: "/docs/", headers: map[string]string{echo.HeaderAccept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"}, code: http.StatusFound},
+		{name: "api accept", path: "/api/data.json", headers: map[string]string{echo.HeaderAccept: "application/json"}, code: http.StatusUnauthorized, body: `{"error":"unauthorized","login_url":"/auth/login"}` + "\n"},
+		{name: "api referer", path: "/api/data.json", headers: map[string]string{echo.HeaderXRequestedWith: "XMLHttpRequest", "Referer": "http://example.com/docs/?q=1"}, code: http.StatusUnauthorized, body: `{"error":"unauthorized","login_url":"/auth/login?return_to=%2Fdocs%2F%3Fq%3D1"}` + "\n"},
+		{name: "api post", method: http.MethodPost, path: "/api/data.json", code: http.StatusUnauthorized},
+		{name: "api denied by policy", path: "/admin/data.json", headers: map[string]string{echo.HeaderAccept: "application/json"}, loggedIn: true, code: http.StatusForbidden, body: `{"error":"forbidden"}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := require.New(t)
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			req := httptest.NewRequest(method, tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if tt.loggedIn {
+				req.AddCookie(loginCookie)
+			}
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(tt.code, rec.Code)
+			if tt.body != "" {
+				assert.Equal(tt.body, rec.Body.String())
+			}
+			if tt.location != "" {
+				assert.Equal(tt.location, rec.Header().Get(echo.HeaderLocation))
+			}
+		})
+	}
+}
+
+func TestCheckAuthWithConfig_Bearer(t *testing.T) {
+	bearer := func(c echo.Context, token string) (*UserInfo, error) {
+		switch token {
+		case "staff":
+			return &UserInfo{Sub: "def456", Email: "staff@example.com"}, nil
+		case "admin":
+			return &UserInfo{Sub: "abc123", Email: "admin@example.com"}, nil
+		}
+		return nil, errors.New("invalid token")
+	}
+
+	newServer := func(bearer func(c echo.Context, token string) (*UserInfo, error)) *echo.Echo {
+		e := echo.New()
+		e.Use(CheckAuthWithConfig(Config{
+			Policies: []flags.Policy{{Path: "/admin/**", Emails: []string{"admin@example.com"}}},
+			Bearer:   bearer,
+		}))
+		e.Any("/*", func(c echo.Context) error {
+			return c.String(http.StatusOK, CurrentUser(c).Email)
+		})
+		return e
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		code   int
+		body   string
+	}{
+		{name: "valid", path: "/docs/guide.html", header: "Bearer staff", code: http.StatusOK, body: "staff@example.com"},
+		{name: "scheme case", path: "/docs/guide.html", header: "bearer staff", code: http.StatusOK, body: "staff@example.com"},
+		{name: "invalid", path: "/docs/guide.html", header: "Bearer expired", code: http.StatusUnauthorized, body: `{"error":"invalid_token"}` + "\n"},
+		{name: "denied by policy", path: "/admin/index.html", header: "Bearer staff", code: http.StatusForbidden, body: `{"error":"forbidden"}` + "\n"},
+		{name: "allowed by policy", path: "/admin/index.html", header: "Bearer admin", code: http.StatusOK, body: "admin@example.com"},
+		{name: "basic auth", path: "/docs/guide.html", header: "Basic YWRtaW46YWRtaW4=", code: http.StatusFound},
+	}
+
+	e := newServer(bearer)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := require.New(t)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set(echo.HeaderAuthorization, tt.header)
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(tt.code, rec.Code)
+			if tt.body != "" {
+				assert.Equal(tt.body, rec.Body.String())
+			}
+		})
+	}
+
+	// without a verifier bearer tokens are rejected rather than falling back to the session
+	req := httptest.NewRequest(http.MethodGet, "/docs/guide.html", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer staff")
+
+	rec := httptest.NewRecorder()
+	newServer(nil).ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Equal(t, `Bearer error="invalid_request"`, rec.Header().Get(echo.HeaderWWWAuthenticate))
+}
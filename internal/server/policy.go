@@ -0,0 +1,101 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/wolfeidau/website-openid-proxy/internal/flags"
+	"github.com/wolfeidau/website-openid-proxy/internal/pathmatch"
+)
+
+// Authorize checks the user is permitted to access the path using the first policy matching it,
+// paths which don't match any policy are available to all logged in users.
+//
+// Users authenticated by a personal access token are also limited to the paths of the token. Paths with dot
+// segments are refused as they would be resolved to another path after they are matched.
+func Authorize(policies []flags.Policy, path string, info *UserInfo) bool {
+	if !pathmatch.IsClean(path) {
+		return false
+	}
+
+	if len(info.paths) > 0 && !pathmatch.MatchAny(info.paths, path) {
+		return false
+	}
+
+	for _, p := range policies {
+		if !pathmatch.Match(p.Path, path) {
+			continue
+		}
+
+		return allowed(p, info)
+	}
+
+	return true
+}
+
+// AuthorizeFilter returns a filter which hides paths the current user isn't permitted to access
+func AuthorizeFilter(policies []flags.Policy) func(c echo.Context, p string) bool {
+	return func(c echo.Context, p string) bool {
+		info := CurrentUser(c)
+		if info == nil {
+			// identity aware paths may not have a user
+			info = &UserInfo{}
+		}
+
+		return Authorize(policies, p, info)
+	}
+}
+
+// RewriteFilter returns a filter which reports whether a request can be rewritten to the path, paths which aren't
+// public require a logged in user permitted by the policies.
+func RewriteFilter(policies []flags.Policy, publicPaths []string) func(c echo.Context, p string) bool {
+	return func(c echo.Context, p string) bool {
+		if pathmatch.MatchAny(publicPaths, p) {
+			return true
+		}
+
+		// public request paths don't identify the user
+		info := CurrentUser(c)
+		if info == nil {
+			return false
+		}
+
+		return Authorize(policies, p, info)
+	}
+}
+
+func allowed(p flags.Policy, info *UserInfo) bool {
+	if len(p.Emails) == 0 && len(p.EmailDomains) == 0 && len(p.Subjects) == 0 && len(p.Groups) == 0 {
+		return true
+	}
+
+	for _, email := range p.Emails {
+		if strings.EqualFold(email, info.Email) {
+			return true
+		}
+	}
+
+	for _, domain := range p.EmailDomains {
+		if strings.HasSuffix(strings.ToLower(info.Email), "@"+strings.ToLower(domain)) {
+			return true
+		}
+	}
+
+	for _, sub := range p.Subjects {
+		if sub == info.Sub {
+			return true
+		}
+	}
+
+	groups := info.Groups()
+
+	for _, group := range p.Groups {
+		for _, g := range groups {
+			if group == g {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/website-openid-proxy/internal/flags"
+)
+
+func TestAuthorize(t *testing.T) {
+	policies := []flags.Policy{
+		{Path: "/admin/**", Emails: []string{"admin@example.com"}},
+		{Path: "/staff/", EmailDomains: []string{"example.com"}, Subjects: []string{"abc123"}},
+		{Path: "/ops/**", Groups: []string{"ops"}},
+		{Path: "/docs/**"},
+	}
+
+	tests := []struct {
+		name string
+		path string
+		info *UserInfo
+		want bool
+	}{
+		{name: "admin allowed", path: "/admin/index.html", info: &UserInfo{Email: "Admin@example.com"}, want: true},
+		{name: "admin denied", path: "/admin/index.html", info: &UserInfo{Email: "staff@example.com"}, want: false},
+		{name: "staff domain", path: "/staff/index.html", info: &UserInfo{Email: "staff@example.com"}, want: true},
+		{name: "staff subject", path: "/staff/index.html", info: &UserInfo{Sub: "abc123", Email: "other@other.com"}, want: true},
+		{name: "staff denied", path: "/staff/index.html", info: &UserInfo{Sub: "def456", Email: "other@other.com"}, want: false},
+		{name: "group allowed", path: "/ops/index.html", info: &UserInfo{Claims: map[string]interface{}{"groups": []interface{}{"dev", "ops"}}}, want: true},
+		{name: "group denied", path: "/ops/index.html", info: &UserInfo{Claims: map[string]interface{}{"groups": []interface{}{"dev"}}}, want: false},
+		{name: "empty policy", path: "/docs/index.html", info: &UserInfo{Email: "other@other.com"}, want: true},
+		{name: "no policy", path: "/index.html", info: &UserInfo{Email: "other@other.com"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, Authorize(policies, tt.path, tt.info))
+		})
+	}
+}
+
+func TestAuthorizeFilter(t *testing.T) {
+	assert := require.New(t)
+
+	filter := AuthorizeFilter([]flags.Policy{{Path: "/admin/**", Emails: []string{"admin@example.com"}}})
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+	assert.False(filter(c, "/admin/"))
+	assert.True(filter(c, "/docs/"))
+
+	c.Set(userContextKey, &UserInfo{Email: "admin@example.com"})
+
+	assert.True(filter(c, "/admin/"))
+}
+
+func TestRewriteFilter(t *testing.T) {
+	assert := require.New(t)
+
+	filter := RewriteFilter([]flags.Policy{{Path: "/admin/**", Emails: []string{"admin@example.com"}}}, []string{"/public/**"})
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+	assert.True(filter(c, "/public/index.html"))
+	assert.False(filter(c, "/docs/index.html"))
+
+	c.Set(userContextKey, &UserInfo{Email: "staff@example.com"})
+
+	assert.True(filter(c, "/docs/index.html"))
+	assert.False(filter(c, "/admin/index.html"))
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+var previewNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// PreviewPrefix selects the preview build for the request using the host or path, the returned prefixes are used
+// to read the objects of the build. Requests which don't select a preview return false.
+func (s *Site) PreviewPrefix(c echo.Context) (pathPrefix, keyPrefix string, ok bool) {
+	return s.previewPrefix(c, c.Request().URL.Path)
+}
+
+// previewPrefix selects the preview build for the path, the host is still read from the request
+func (s *Site) previewPrefix(c echo.Context, p string) (pathPrefix, keyPrefix string, ok bool) {
+	var name string
+
+	switch s.Preview {
+	case "host":
+		host := RequestHost(c)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		for _, pattern := range s.Hosts {
+			if strings.HasPrefix(pattern, "*.") && HostAllowed([]string{pattern}, host) {
+				name = host[:len(host)-len(pattern)+1]
+				break
+			}
+		}
+
+		pathPrefix = s.PathPrefix
+	case "path":
+		rest := strings.TrimPrefix(strings.TrimPrefix(p, s.PathPrefix), "/")
+		name = strings.SplitN(rest, "/", 2)[0]
+
+		pathPrefix = s.PathPrefix + "/" + name
+	}
+
+	if !previewNamePattern.MatchString(name) {
+		return "", "", false
+	}
+
+	return pathPrefix, s.KeyPrefix + name + "/", true
+}
+
+// PreviewURL returns the link to the named preview build
+func (s *Site) PreviewURL(c echo.Context, name string) string {
+	if s.Preview != "host" {
+		return s.PathPrefix + "/" + name + "/"
+	}
+
+	for _, pattern := range s.Hosts {
+		if strings.HasPrefix(pattern, "*.") {
+			u := &url.URL{Scheme: c.Scheme(), Host: name + pattern[1:], Path: s.PathPrefix + "/"}
+			return u.String()
+		}
+	}
+
+	return ""
+}
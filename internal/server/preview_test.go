@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/website-openid-proxy/internal/flags"
+)
+
+func TestSite_PreviewPrefix(t *testing.T) {
+	hostSite := &Site{Site: flags.Site{Hosts: []string{"preview.example.com", "*.preview.example.com"}, KeyPrefix: "previews/", Preview: "host"}}
+	pathSite := &Site{Site: flags.Site{PathPrefix: "/_preview", KeyPrefix: "previews/", Preview: "path"}}
+
+	tests := []struct {
+		name       string
+		site       *Site
+		host, path string
+		pathPrefix string
+		keyPrefix  string
+		ok         bool
+	}{
+		{name: "host", site: hostSite, host: "pr-123.preview.example.com", path: "/guide/", keyPrefix: "previews/pr-123/", ok: true},
+		{name: "host with port", site: hostSite, host: "pr-123.preview.example.com:8443", path: "/", keyPrefix: "previews/pr-123/", ok: true},
+		{name: "host index", site: hostSite, host: "preview.example.com", path: "/"},
+		{name: "nested host", site: hostSite, host: "a.pr-123.preview.example.com", path: "/"},
+		{name: "path", site: pathSite, host: "docs.example.com", path: "/_preview/pr-123/guide/", pathPrefix: "/_preview/pr-123", keyPrefix: "previews/pr-123/", ok: true},
+		{name: "path index", site: pathSite, host: "docs.example.com", path: "/_preview/"},
+		{name: "path traversal", site: pathSite, host: "docs.example.com", path: "/_preview/../secret/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Host = tt.host
+
+			pathPrefix, keyPrefix, ok := tt.site.PreviewPrefix(echo.New().NewContext(req, httptest.NewRecorder()))
+			require.Equal(t, tt.ok, ok)
+			require.Equal(t, tt.pathPrefix, pathPrefix)
+			require.Equal(t, tt.keyPrefix, keyPrefix)
+		})
+	}
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "https://preview.example.com/", nil), httptest.NewRecorder())
+
+	require.Equal(t, "https://pr-123.preview.example.com/", hostSite.PreviewURL(c, "pr-123"))
+	require.Equal(t, "/_preview/pr-123/", pathSite.PreviewURL(c, "pr-123"))
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultRefreshInterval = time.Hour
+	defaultRetryAttempts   = 3
+	defaultRetryBackoff    = 200 * time.Millisecond
+
+	// failedRefreshInterval how long the cached configuration is used after a refresh fails before trying again
+	failedRefreshInterval = time.Minute
+	// discoveryTimeout limits each request made to the provider, the context isn't used as go-oidc keeps it
+	// for fetching keys
+	discoveryTimeout = 10 * time.Second
+)
+
+type ProviderFunc = func(ctx context.Context, issuer string) (*oidc.Provider, error)
+
+// Provider lazily discovers the openid provider configuration on first use, retrying with backoff,
+// and refreshes it periodically so changes to the issuer metadata and keys are picked up.
+type Provider struct {
+	issuer          string
+	providerFunc    ProviderFunc
+	refreshInterval time.Duration
+	retryAttempts   int
+	retryBackoff    time.Duration
+	client          *http.Client
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+	fetched  time.Time
+	failed   time.Time
+	// refreshing is closed when the discovery in progress completes
+	refreshing chan struct{}
+	now        func() time.Time
+}
+
+// NewProvider create a new lazily discovered provider for the given issuer
+func NewProvider(issuer string, providerFunc ProviderFunc, refreshInterval time.Duration, retryAttempts int) *Provider {
+	if refreshInterval <= 0 {
+		refreshInterval = defaultRefreshInterval
+	}
+
+	if retryAttempts <= 0 {
+		retryAttempts = defaultRetryAttempts
+	}
+
+	return &Provider{
+		issuer:          issuer,
+		providerFunc:    providerFunc,
+		refreshInterval: refreshInterval,
+		retryAttempts:   retryAttempts,
+		retryBackoff:    defaultRetryBackoff,
+		client:          &http.Client{Timeout: discoveryTimeout},
+		now:             time.Now,
+	}
+}
+
+// Get return the provider, running discovery if it hasn't happened yet or the cached configuration is stale.
+//
+// If a refresh fails, or is still in progress, the previously discovered configuration is returned so logins
+// continue to work. A failed refresh isn't retried until failedRefreshInterval has passed.
+func (p *Provider) Get(ctx context.Context) (*oidc.Provider, error) {
+	for {
+		p.mu.Lock()
+
+		now := p.now()
+
+		if p.provider != nil && (now.Sub(p.fetched) < p.refreshInterval || now.Sub(p.failed) < failedRefreshInterval || p.refreshing != nil) {
+			provider := p.provider
+			p.mu.Unlock()
+
+			return provider, nil
+		}
+
+		// without a cached configuration wait for the discovery in progress
+		if p.refreshing != nil {
+			done := p.refreshing
+			p.mu.Unlock()
+
+			select {
+			case <-done:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		done := make(chan struct{})
+		p.refreshing = done
+		p.mu.Unlock()
+
+		// the lock isn't held during discovery so requests aren't blocked by the retry backoff
+		provider, err := p.discover(ctx)
+
+		p.mu.Lock()
+
+		p.refreshing = nil
+		close(done)
+
+		if err != nil {
+			p.failed = p.now()
+			cached := p.provider
+			p.mu.Unlock()
+
+			if cached != nil {
+				log.Ctx(ctx).Warn().Err(err).Str("issuer", p.issuer).Msg("failed to refresh provider, using cached configuration")
+				return cached, nil
+			}
+
+			return nil, err
+		}
+
+		p.provider = provider
+		p.fetched = p.now()
+		p.mu.Unlock()
+
+		return provider, nil
+	}
+}
+
+func (p *Provider) discover(ctx context.Context) (*oidc.Provider, error) {
+	backoff := p.retryBackoff
+
+	// the provider keeps this context to fetch keys, so it mustn't be the request context which is cancelled
+	// once the request completes
+	clientCtx := oidc.ClientContext(context.Background(), p.client)
+
+	var err error
+
+	for attempt := 1; attempt <= p.retryAttempts; attempt++ {
+		var provider *oidc.Provider
+
+		provider, err = p.providerFunc(clientCtx, p.issuer)
+		if err == nil {
+			return provider, nil
+		}
+
+		log.Ctx(ctx).Warn().Err(err).Str("issuer", p.issuer).Int("attempt", attempt).Msg("provider discovery failed")
+
+		if attempt == p.retryAttempts {
+			break
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, fmt.Errorf("provider discovery cancelled after error %v: %w", err, ctx.Err())
+		case <-t.C:
+		}
+
+		backoff *= 2
+	}
+
+	return nil, err
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/website-openid-proxy/internal/logger"
+	"golang.org/x/oauth2"
+)
+
+func TestProvider_Lazy(t *testing.T) {
+	assert := require.New(t)
+
+	calls := 0
+
+	_, err := NewAuth(newConfig(), func(ctx context.Context, issuer string) (*oidc.Provider, error) {
+		calls++
+		return &oidc.Provider{}, nil
+	})
+	assert.NoError(err)
+	assert.Equal(0, calls)
+}
+
+func TestProvider_Retry(t *testing.T) {
+	assert := require.New(t)
+
+	calls := 0
+
+	p := NewProvider("http://localhost", func(ctx context.Context, issuer string) (*oidc.Provider, error) {
+		calls++
+		if calls < 3 {
+			return nil, errors.New("unavailable")
+		}
+		return &oidc.Provider{}, nil
+	}, time.Hour, 3)
+	p.retryBackoff = time.Millisecond
+
+	provider, err := p.Get(logger.NewLoggerWithContext(context.TODO()))
+	assert.NoError(err)
+	assert.NotNil(provider)
+	assert.Equal(3, calls)
+
+	// cached until the refresh interval passes
+	_, err = p.Get(logger.NewLoggerWithContext(context.TODO()))
+	assert.NoError(err)
+	assert.Equal(3, calls)
+}
+
+func TestProvider_RetryExhausted(t *testing.T) {
+	assert := require.New(t)
+
+	p := NewProvider("http://localhost", func(ctx context.Context, issuer string) (*oidc.Provider, error) {
+		return nil, errors.New("unavailable")
+	}, time.Hour, 2)
+	p.retryBackoff = time.Millisecond
+
+	_, err := p.Get(logger.NewLoggerWithContext(context.TODO()))
+	assert.Error(err)
+}
+
+func TestProvider_RefreshFailureUsesCached(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Now()
+	calls := 0
+	cached := &oidc.Provider{}
+
+	p := NewProvider("http://localhost", func(ctx context.Context, issuer string) (*oidc.Provider, error) {
+		calls++
+		if calls > 1 {
+			return nil, errors.New("unavailable")
+		}
+		return cached, nil
+	}, time.Minute, 1)
+	p.now = func() time.Time { return now }
+
+	provider, err := p.Get(logger.NewLoggerWithContext(context.TODO()))
+	assert.NoError(err)
+	assert.Same(cached, provider)
+
+	now = now.Add(2 * time.Minute)
+
+	provider, err = p.Get(logger.NewLoggerWithContext(context.TODO()))
+	assert.NoError(err)
+	assert.Same(cached, provider)
+	assert.Equal(2, calls)
+
+	// the failed refresh isn't retried on every request
+	_, err = p.Get(logger.NewLoggerWithContext(context.TODO()))
+	assert.NoError(err)
+	assert.Equal(2, calls)
+
+	now = now.Add(failedRefreshInterval)
+
+	_, err = p.Get(logger.NewLoggerWithContext(context.TODO()))
+	assert.NoError(err)
+	assert.Equal(3, calls)
+}
+
+func TestProvider_DiscoveryContext(t *testing.T) {
+	assert := require.New(t)
+
+	var discoveryCtx context.Context
+
+	p := NewProvider("http://localhost", func(ctx context.Context, issuer string) (*oidc.Provider, error) {
+		discoveryCtx = ctx
+		return &oidc.Provider{}, nil
+	}, time.Hour, 1)
+
+	ctx, cancel := context.WithCancel(logger.NewLoggerWithContext(context.TODO()))
+
+	_, err := p.Get(ctx)
+	assert.NoError(err)
+
+	cancel()
+
+	// go-oidc keeps the context to fetch keys after the request has completed
+	assert.NoError(discoveryCtx.Err())
+	assert.NotNil(discoveryCtx.Value(oauth2.HTTPClient))
+}
+
+func TestProvider_RefreshInProgressUsesCached(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Now()
+	calls := 0
+	cached := &oidc.Provider{}
+	started, release := make(chan struct{}), make(chan struct{})
+
+	p := NewProvider("http://localhost", func(ctx context.Context, issuer string) (*oidc.Provider, error) {
+		calls++
+		if calls > 1 {
+			close(started)
+			<-release
+		}
+		return cached, nil
+	}, time.Minute, 1)
+	p.now = func() time.Time { return now }
+
+	_, err := p.Get(logger.NewLoggerWithContext(context.TODO()))
+	assert.NoError(err)
+
+	now = now.Add(2 * time.Minute)
+
+	done := make(chan error)
+	go func() {
+		_, err := p.Get(logger.NewLoggerWithContext(context.TODO()))
+		done <- err
+	}()
+
+	<-started
+
+	// other requests aren't blocked while the refresh is running
+	provider, err := p.Get(logger.NewLoggerWithContext(context.TODO()))
+	assert.NoError(err)
+	assert.Same(cached, provider)
+
+	close(release)
+	assert.NoError(<-done)
+}
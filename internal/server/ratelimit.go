@@ -0,0 +1,77 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/wolfeidau/website-openid-proxy/internal/echosessions"
+	"github.com/wolfeidau/website-openid-proxy/internal/flags"
+	"github.com/wolfeidau/website-openid-proxy/internal/ratelimit"
+)
+
+// RateLimitRules builds the configured rate limit rules, the auth routes and content have separate limits
+// keyed by client IP and logged in user. The user limit for content is returned in userRules as it is applied
+// after CheckAuthWithConfig, so requests using a bearer token are counted against the user of the token.
+func RateLimitRules(cfg *flags.API) (rules, userRules []ratelimit.Rule, err error) {
+	authRoutes := func(c echo.Context) bool {
+		return !strings.HasPrefix(c.Request().URL.Path, cfg.AuthPrefix+"/")
+	}
+	contentRoutes := func(c echo.Context) bool {
+		return strings.HasPrefix(c.Request().URL.Path, cfg.AuthPrefix+"/")
+	}
+
+	specs := []struct {
+		name    string
+		limit   string
+		skipper func(c echo.Context) bool
+		key     func(c echo.Context) string
+		user    bool
+	}{
+		{name: "auth_ip", limit: cfg.RateLimitAuthIP, skipper: authRoutes, key: ratelimit.IPKey},
+		{name: "auth_user", limit: cfg.RateLimitAuthUser, skipper: authRoutes, key: SubjectKey},
+		{name: "content_ip", limit: cfg.RateLimitContentIP, skipper: contentRoutes, key: ratelimit.IPKey},
+		{name: "content_user", limit: cfg.RateLimitContentUser, skipper: contentRoutes, key: SubjectKey, user: true},
+	}
+
+	for _, spec := range specs {
+		if spec.limit == "" {
+			continue
+		}
+
+		limit, err := ratelimit.ParseLimit(spec.limit)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		rule := ratelimit.Rule{
+			Name:    spec.name,
+			Skipper: spec.skipper,
+			Limit:   limit,
+			Key:     spec.key,
+		}
+
+		if spec.user {
+			userRules = append(userRules, rule)
+		} else {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, userRules, nil
+}
+
+// SubjectKey use the subject of the logged in user as the key, this is the user attached by CheckAuthWithConfig,
+// which includes requests using a bearer token, or the user of the login session before it has run. Requests
+// without a user aren't counted.
+func SubjectKey(c echo.Context) string {
+	if user := CurrentUser(c); user != nil {
+		return user.Sub
+	}
+
+	sess, err := echosessions.Get(loggedInCookieName, c)
+	if err != nil {
+		return ""
+	}
+
+	return sess.Get("sub")
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/website-openid-proxy/internal/flags"
+	"github.com/wolfeidau/website-openid-proxy/internal/ratelimit"
+)
+
+func TestRateLimitRules_Bearer(t *testing.T) {
+	assert := require.New(t)
+
+	rules, userRules, err := RateLimitRules(&flags.API{
+		AuthPrefix:           "/auth",
+		RateLimitContentIP:   "10/1m",
+		RateLimitContentUser: "1/1m",
+	})
+	assert.NoError(err)
+	assert.Len(rules, 1)
+	assert.Len(userRules, 1)
+
+	store := ratelimit.NewMemoryStore()
+
+	e := echo.New()
+	e.Use(ratelimit.MiddlewareWithConfig(ratelimit.Config{Store: store, Rules: rules}))
+	e.Use(CheckAuthWithConfig(Config{
+		Bearer: func(c echo.Context, token string) (*UserInfo, error) {
+			if token == "pat" || token == "cli" {
+				return &UserInfo{Sub: "abc123", Email: "mark@wolfe.id.au"}, nil
+			}
+			return nil, errors.New("invalid token")
+		},
+	}))
+	e.Use(ratelimit.MiddlewareWithConfig(ratelimit.Config{Store: store, Rules: userRules}))
+	e.Any("/*", func(c echo.Context) error {
+		return c.String(http.StatusOK, CurrentUser(c).Email)
+	})
+
+	serve := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/docs/guide.html", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	// both tokens belong to the same user so they share the user limit
+	assert.Equal(http.StatusOK, serve("pat"))
+	assert.Equal(http.StatusTooManyRequests, serve("cli"))
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/wolfeidau/website-openid-proxy/internal/ratelimit"
+	"github.com/wolfeidau/website-openid-proxy/internal/registry"
+)
+
+// ErrSessionRevoked returned when the session isn't in the registry of active sessions, either because it
+// was revoked or it was created before the registry was enabled
+var ErrSessionRevoked = errors.New("session revoked")
+
+// registerSession adds a new login session to the registry
+func registerSession(c echo.Context, store registry.Store, info *UserInfo, now time.Time) error {
+	info.sessionID = MustRandomState(32)
+
+	return store.Put(c.Request().Context(), &registry.Session{
+		ID:        info.sessionID,
+		Subject:   info.Sub,
+		Email:     info.Email,
+		Issuer:    info.Issuer,
+		CreatedAt: now.Unix(),
+		LastSeen:  now.Unix(),
+		ExpiresAt: info.SessionExpiresAt,
+		IP:        ratelimit.SourceIP(c.Request()),
+		UserAgent: c.Request().UserAgent(),
+	})
+}
+
+// activeSession checks the session of the user is in the registry, recording when it was last seen
+func activeSession(ctx context.Context, store registry.Store, info *UserInfo, now time.Time) error {
+	if info.sessionID == "" {
+		return ErrSessionRevoked
+	}
+
+	sess, err := store.Get(ctx, info.sessionID)
+	if errors.Is(err, registry.ErrNotFound) {
+		return ErrSessionRevoked
+	}
+	if err != nil {
+		return err
+	}
+
+	if now.Unix()-sess.LastSeen >= int64(lastSeenInterval.Seconds()) {
+		sess.LastSeen = now.Unix()
+
+		// a session revoked since it was read isn't stored again
+		err = store.Touch(ctx, sess)
+		if errors.Is(err, registry.ErrNotFound) {
+			return ErrSessionRevoked
+		}
+
+		// failing to record activity shouldn't fail the request
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("failed to update session last seen")
+		}
+	}
+
+	return nil
+}
+
+// checkSession checks the session of the user hasn't been revoked, when the registry is enabled
+func (l *Auth) checkSession(ctx context.Context, info *UserInfo) error {
+	if l.sessions == nil {
+		return nil
+	}
+
+	return activeSession(ctx, l.sessions, info, time.Now())
+}
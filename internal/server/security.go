@@ -0,0 +1,137 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"regexp"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/wolfeidau/website-openid-proxy/internal/flags"
+	"github.com/wolfeidau/website-openid-proxy/internal/pathmatch"
+)
+
+const (
+	nonceContextKey  = "_csp_nonce"
+	noncePlaceholder = "{nonce}"
+	nonceLength      = 16
+)
+
+// DefaultHeaderPolicy the security headers added to responses unless they are configured, frames are limited
+// to the same origin so the silent login iframe works. HSTS doesn't include subdomains as other sites on the
+// domain may not be served over https.
+var DefaultHeaderPolicy = flags.HeaderPolicy{
+	HSTS:               "max-age=31536000",
+	ContentTypeOptions: "nosniff",
+	ReferrerPolicy:     "strict-origin-when-cross-origin",
+	FrameOptions:       "SAMEORIGIN",
+}
+
+var (
+	openingTagPattern     = regexp.MustCompile(`(?i)<(?:script|style)(?:\s[^>]*)?>`)
+	nonceAttributePattern = regexp.MustCompile(`(?i)\snonce\s*=`)
+)
+
+// SecurityHeaders adds the security headers to every response including the auth routes, a nonce is generated
+// for each request when the content security policy uses one.
+func SecurityHeaders(cfg flags.SecurityHeaders) echo.MiddlewareFunc {
+	base := DefaultHeaderPolicy.Merge(cfg.HeaderPolicy)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			policy := base
+
+			for _, o := range cfg.Overrides {
+				if pathmatch.Match(o.Path, c.Request().URL.Path) {
+					policy = base.Merge(o.HeaderPolicy)
+					break
+				}
+			}
+
+			csp := policy.ContentSecurityPolicy
+			if strings.Contains(csp, noncePlaceholder) {
+				nonce := mustNonce()
+				c.Set(nonceContextKey, nonce)
+				csp = strings.ReplaceAll(csp, noncePlaceholder, nonce)
+			}
+
+			h := c.Response().Header()
+
+			for name, value := range map[string]string{
+				"Strict-Transport-Security": policy.HSTS,
+				"Content-Security-Policy":   csp,
+				"X-Content-Type-Options":    policy.ContentTypeOptions,
+				"Referrer-Policy":           policy.ReferrerPolicy,
+				"Permissions-Policy":        policy.PermissionsPolicy,
+				"X-Frame-Options":           strings.ToUpper(policy.FrameOptions),
+			} {
+				if value == "" || strings.EqualFold(value, flags.HeaderOff) {
+					continue
+				}
+				h.Set(name, value)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// CSPNonce returns the content security policy nonce for the request, or an empty string if the policy
+// doesn't use one.
+func CSPNonce(c echo.Context) string {
+	nonce, _ := c.Get(nonceContextKey).(string)
+	return nonce
+}
+
+// NonceEnabled returns true if the content security policy, or any of its overrides, uses a nonce
+func NonceEnabled(cfg flags.SecurityHeaders) bool {
+	if strings.Contains(cfg.ContentSecurityPolicy, noncePlaceholder) {
+		return true
+	}
+
+	for _, o := range cfg.Overrides {
+		if strings.Contains(o.ContentSecurityPolicy, noncePlaceholder) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NonceRewriter adds the request nonce to the script and style tags of a HTML document
+func NonceRewriter(c echo.Context, body []byte) ([]byte, error) {
+	nonce := CSPNonce(c)
+	if nonce == "" {
+		return body, nil
+	}
+
+	attr := []byte(` nonce="` + nonce + `"`)
+
+	return openingTagPattern.ReplaceAllFunc(body, func(tag []byte) []byte {
+		// browsers only use the first nonce attribute, so a tag which has one is left as is
+		if nonceAttributePattern.Match(tag) {
+			return tag
+		}
+
+		// the nonce is added after the tag name
+		n := bytes.IndexAny(tag, " \t\r\n\f>")
+
+		out := make([]byte, 0, len(tag)+len(attr))
+		out = append(out, tag[:n]...)
+		out = append(out, attr...)
+
+		return append(out, tag[n:]...)
+	}), nil
+}
+
+func mustNonce() string {
+	buf := make([]byte, nonceLength)
+
+	_, err := rand.Read(buf)
+	if err != nil {
+		panic(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(buf)
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/website-openid-proxy/internal/flags"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	assert := require.New(t)
+
+	e := echo.New()
+	e.Use(SecurityHeaders(flags.SecurityHeaders{
+		HeaderPolicy: flags.HeaderPolicy{
+			ContentSecurityPolicy: "default-src 'self'; script-src 'self' 'nonce-{nonce}'",
+			PermissionsPolicy:     "camera=()",
+		},
+		Overrides: []flags.HeaderOverride{
+			{Path: "/embed/**", HeaderPolicy: flags.HeaderPolicy{FrameOptions: flags.HeaderOff, HSTS: "max-age=60"}},
+		},
+	}))
+
+	var nonce string
+	e.GET("/*", func(c echo.Context) error {
+		nonce = CSPNonce(c)
+		body, err := NonceRewriter(c, []byte(`<html><script src="/app.js"></script><STYLE>p{}</STYLE><scripts></html>`))
+		if err != nil {
+			return err
+		}
+		return c.HTMLBlob(http.StatusOK, body)
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/index.html", nil))
+
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.NotEmpty(nonce)
+	assert.Equal("default-src 'self'; script-src 'self' 'nonce-"+nonce+"'", rec.Header().Get("Content-Security-Policy"))
+	assert.Equal(DefaultHeaderPolicy.HSTS, rec.Header().Get("Strict-Transport-Security"))
+	assert.Equal("nosniff", rec.Header().Get("X-Content-Type-Options"))
+	assert.Equal("strict-origin-when-cross-origin", rec.Header().Get("Referrer-Policy"))
+	assert.Equal("camera=()", rec.Header().Get("Permissions-Policy"))
+	assert.Equal("SAMEORIGIN", rec.Header().Get("X-Frame-Options"))
+	assert.Equal(`<html><script nonce="`+nonce+`" src="/app.js"></script><STYLE nonce="`+nonce+`">p{}</STYLE><scripts></html>`, rec.Body.String())
+
+	first := nonce
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/embed/index.html", nil))
+
+	assert.NotEqual(first, nonce)
+	assert.Empty(rec.Header().Get("X-Frame-Options"))
+	assert.Equal("max-age=60", rec.Header().Get("Strict-Transport-Security"))
+	assert.Equal("camera=()", rec.Header().Get("Permissions-Policy"))
+}
+
+func TestNonceRewriter_ExistingNonce(t *testing.T) {
+	assert := require.New(t)
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	c.Set(nonceContextKey, "abc")
+
+	body, err := NonceRewriter(c, []byte(`<script nonce="xyz">a()</script><style NONCE='xyz'></style><script data-nonce="1">b()</script>`))
+	assert.NoError(err)
+	assert.Equal(`<script nonce="xyz">a()</script><style NONCE='xyz'></style><script nonce="abc" data-nonce="1">b()</script>`, string(body))
+}
+
+func TestNonceRewriter_NoNonce(t *testing.T) {
+	assert := require.New(t)
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+	body, err := NonceRewriter(c, []byte("<script></script>"))
+	assert.NoError(err)
+	assert.Equal("<script></script>", string(body))
+}
+
+func TestNonceEnabled(t *testing.T) {
+	assert := require.New(t)
+
+	assert.False(NonceEnabled(flags.SecurityHeaders{HeaderPolicy: flags.HeaderPolicy{ContentSecurityPolicy: "default-src 'self'"}}))
+	assert.True(NonceEnabled(flags.SecurityHeaders{HeaderPolicy: flags.HeaderPolicy{ContentSecurityPolicy: "script-src 'nonce-{nonce}'"}}))
+	assert.True(NonceEnabled(flags.SecurityHeaders{Overrides: []flags.HeaderOverride{
+		{Path: "/app/**", HeaderPolicy: flags.HeaderPolicy{ContentSecurityPolicy: "script-src 'nonce-{nonce}'"}},
+	}}))
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/wolfeidau/website-openid-proxy/internal/audit"
+	"github.com/wolfeidau/website-openid-proxy/internal/echosessions"
+)
+
+// ShareRequest the path to share and how long the link is valid, the ttl defaults to the configured maximum
+type ShareRequest struct {
+	Path string `json:"path" form:"path" query:"path"`
+	TTL  string `json:"ttl" form:"ttl" query:"ttl"`
+}
+
+// ShareResponse a presigned link which can be used without a session until it expires
+type ShareResponse struct {
+	URL       string `json:"url"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// Share share http handler which issues a presigned link for a path the user is permitted to access, this
+// allows tools which can't carry the session cookie to download the file.
+func (l *Auth) Share(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	sess, err := echosessions.Get(loggedInCookieName, c)
+	if err != nil {
+		return c.String(http.StatusUnauthorized, "failed to process request")
+	}
+
+	info, err := userInfoFromSession(sess)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to read user info from session")
+
+		// TODO: Need an error page
+		return c.String(http.StatusInternalServerError, "failed to process request")
+	}
+
+	now := time.Now()
+
+	if info.Expired(now, l.authConfig.SessionIdleTimeout) {
+		return c.String(http.StatusUnauthorized, "session expired")
+	}
+
+	err = l.checkSession(ctx, info)
+	if errors.Is(err, ErrSessionRevoked) {
+		return c.String(http.StatusUnauthorized, "session expired")
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to check session registry")
+
+		// TODO: Need an error page
+		return c.String(http.StatusInternalServerError, "failed to process request")
+	}
+
+	req := new(ShareRequest)
+
+	err = c.Bind(req)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "failed to process request")
+	}
+
+	// only files can be shared, directories and relative paths are rejected
+	if !strings.HasPrefix(req.Path, "/") || strings.HasSuffix(req.Path, "/") || path.Clean(req.Path) != req.Path {
+		return c.String(http.StatusBadRequest, "invalid path")
+	}
+
+	ttl := l.authConfig.ShareTTL
+	if req.TTL != "" {
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 || ttl > l.authConfig.ShareTTL {
+			return c.String(http.StatusBadRequest, "invalid ttl")
+		}
+	}
+
+	evt := audit.Event{
+		Action:  "share",
+		Subject: info.Sub,
+		Email:   info.Email,
+		Path:    req.Path,
+		Fields:  map[string]interface{}{"ttl": ttl.String()},
+	}
+
+	site := l.sites.Match(RequestHost(c), req.Path)
+	if site == nil || site.Presigner == nil {
+		return c.String(http.StatusNotFound, "not found")
+	}
+
+	evt.Fields["site"] = site.Name
+
+	if !Authorize(site.Policies, req.Path, info) {
+		l.audit.Record(ctx, evt)
+
+		return c.String(http.StatusForbidden, "forbidden")
+	}
+
+	key, ok := site.Key(c, req.Path)
+	if !ok {
+		return c.String(http.StatusNotFound, "not found")
+	}
+
+	u, err := site.Presigner.Presign(key, ttl)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to presign share url")
+
+		// TODO: Need an error page
+		return c.String(http.StatusInternalServerError, "failed to process request")
+	}
+
+	evt.Allowed = true
+	l.audit.Record(ctx, evt)
+
+	return c.JSON(http.StatusOK, &ShareResponse{
+		URL:       u,
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+}
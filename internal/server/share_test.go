@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dghubble/sessions"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/website-openid-proxy/internal/audit"
+	"github.com/wolfeidau/website-openid-proxy/internal/content"
+	"github.com/wolfeidau/website-openid-proxy/internal/flags"
+)
+
+type fakePresigner struct{}
+
+func (fakePresigner) Presign(key string, ttl time.Duration) (string, error) {
+	return "https://website.s3.amazonaws.com/" + key + "?X-Amz-Expires=" + ttl.String(), nil
+}
+
+func (fakePresigner) Head(ctx context.Context, key string) (*content.Object, error) {
+	return nil, content.ErrNotFound
+}
+
+func TestShare(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := newConfig()
+	cfg.ShareTTL = 15 * time.Minute
+
+	sites := NewSiteRouter([]*Site{{
+		Site: flags.Site{
+			Name:     "default",
+			Bucket:   "website",
+			Policies: []flags.Policy{{Path: "/admin/**", Emails: []string{"admin@example.com"}}},
+		},
+		Presigner: fakePresigner{},
+	}})
+
+	var events []audit.Event
+
+	auth, err := NewAuth(cfg, mockProviderFunc, WithSites(sites), WithAuditLogger(audit.LoggerFunc(func(ctx context.Context, evt audit.Event) {
+		events = append(events, evt)
+	})))
+	assert.NoError(err)
+
+	store := sessions.NewCookieStore[string](sessions.DefaultCookieConfig, []byte("test"), nil)
+
+	loginRec := httptest.NewRecorder()
+	loginSess := store.New(loggedInCookieName)
+	loginSess.Set("sub", "abc123")
+	loginSess.Set("email", "mark@wolfe.id.au")
+	assert.NoError(loginSess.Save(loginRec))
+
+	share := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/share", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		addCookies(req, loginRec.Result().Cookies())
+
+		return serveSSO(t, store, auth.Share, req)
+	}
+
+	rec := share(`{"path": "/docs/report.pdf", "ttl": "5m"}`)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), `"url":"https://website.s3.amazonaws.com/docs/report.pdf?X-Amz-Expires=5m0s"`)
+
+	rec = share(`{"path": "/admin/users.csv"}`)
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = share(`{"path": "/docs/report.pdf", "ttl": "2h"}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = share(`{"path": "/docs/../admin/users.csv"}`)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	assert.Len(events, 2)
+	assert.Equal(audit.Event{Action: "share", Subject: "abc123", Email: "mark@wolfe.id.au", Path: "/docs/report.pdf", Allowed: true, Fields: map[string]interface{}{"ttl": "5m0s", "site": "default"}}, events[0])
+	assert.False(events[1].Allowed)
+
+	// users must be logged in
+	req := httptest.NewRequest(http.MethodPost, "/auth/share", strings.NewReader(`{"path": "/docs/report.pdf"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+	rec = serveSSO(t, store, auth.Share, req)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+}
+
+func TestShare_Preview(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := newConfig()
+	cfg.ShareTTL = 15 * time.Minute
+
+	sites := NewSiteRouter([]*Site{{
+		Site: flags.Site{
+			Name:       "preview",
+			Bucket:     "website",
+			PathPrefix: "/_preview",
+			KeyPrefix:  "previews/",
+			Preview:    "path",
+		},
+		Presigner: fakePresigner{},
+	}})
+
+	auth, err := NewAuth(cfg, mockProviderFunc, WithSites(sites))
+	assert.NoError(err)
+
+	store := sessions.NewCookieStore[string](sessions.DefaultCookieConfig, []byte("test"), nil)
+
+	loginRec := httptest.NewRecorder()
+	loginSess := store.New(loggedInCookieName)
+	loginSess.Set("sub", "abc123")
+	loginSess.Set("email", "mark@wolfe.id.au")
+	assert.NoError(loginSess.Save(loginRec))
+
+	share := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/share", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		addCookies(req, loginRec.Result().Cookies())
+
+		return serveSSO(t, store, auth.Share, req)
+	}
+
+	// the key is read from the preview build, the same as the content
+	rec := share(`{"path": "/_preview/pr-123/report.pdf"}`)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), `"url":"https://website.s3.amazonaws.com/previews/pr-123/report.pdf?X-Amz-Expires=15m0s"`)
+
+	rec = share(`{"path": "/_preview/report.pdf"}`)
+	assert.Equal(http.StatusNotFound, rec.Code)
+}
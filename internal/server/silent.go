@@ -0,0 +1,71 @@
+package server
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"html/template"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ClientVersion the version of the client script served by the proxy
+const ClientVersion = "1"
+
+var (
+	//go:embed assets/client.js
+	clientJS []byte
+
+	clientJSETag = func() string {
+		sum := sha256.Sum256(clientJS)
+		return `"` + hex.EncodeToString(sum[:8]) + `"`
+	}()
+
+	silentTemplate = template.Must(template.New("silent").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Silent authentication</title></head>
+<body>
+<script{{if .Nonce}} nonce="{{.Nonce}}"{{end}}>
+parent.postMessage({type: "proxy-auth-silent", ok: {{.OK}}}, window.location.origin);
+</script>
+</body>
+</html>
+`))
+)
+
+// Silent silent authentication http handler, this is loaded in a hidden iframe by the client script to renew
+// the session without leaving the page. The openid provider is asked not to prompt the user, the result is posted
+// back to the parent page.
+func (l *Auth) Silent(c echo.Context) error {
+
+	// logins delegated to a central auth host can't be renewed silently
+	if l.authConfig.CentralAuthURL != "" {
+		return silentResult(c, false)
+	}
+
+	return l.startLogin(c, true)
+}
+
+// ClientJS serves the client script which helps pages check the session, renew it and logout
+func (l *Auth) ClientJS(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-cache")
+	c.Response().Header().Set("ETag", clientJSETag)
+	c.Response().Header().Set("X-Client-Version", ClientVersion)
+
+	if c.Request().Header.Get("If-None-Match") == clientJSETag {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJavaScriptCharsetUTF8, clientJS)
+}
+
+func silentResult(c echo.Context, ok bool) error {
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	// the page is loaded in an iframe of the site so it can't be denied framing
+	c.Response().Header().Set("X-Frame-Options", "SAMEORIGIN")
+	c.Response().WriteHeader(http.StatusOK)
+
+	return silentTemplate.Execute(c.Response(), map[string]interface{}{"OK": ok, "Nonce": CSPNonce(c)})
+}
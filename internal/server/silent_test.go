@@ -0,0 +1,74 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dghubble/sessions"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/website-openid-proxy/internal/ticket"
+)
+
+func TestSilent(t *testing.T) {
+	assert := require.New(t)
+
+	auth, err := NewAuth(newConfig(), mockProviderFunc)
+	assert.NoError(err)
+
+	store := sessions.NewCookieStore[string](sessions.DefaultCookieConfig, []byte("test"), nil)
+
+	rec := serveSSO(t, store, auth.Silent, httptest.NewRequest(http.MethodGet, "/auth/silent", nil))
+	assert.Equal(http.StatusFound, rec.Code)
+
+	loginURL, err := url.Parse(rec.Header().Get(echo.HeaderLocation))
+	assert.NoError(err)
+	assert.Equal("none", loginURL.Query().Get("prompt"))
+
+	// the provider reports the user needs to login, this is posted back to the page
+	req := httptest.NewRequest(http.MethodGet, "/auth/callback?error=login_required&state="+loginURL.Query().Get("state"), nil)
+	addCookies(req, rec.Result().Cookies())
+
+	rec = serveSSO(t, store, auth.Callback, req)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), `{type: "proxy-auth-silent", ok:  false }`)
+}
+
+func TestSilent_CentralAuth(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := newConfig()
+	cfg.CentralAuthURL = "https://auth.example.com/auth"
+
+	auth, err := NewAuth(cfg, mockProviderFunc, WithTicketCodec(ticket.NewCodec([]byte("shared"), time.Minute)))
+	assert.NoError(err)
+
+	store := sessions.NewCookieStore[string](sessions.DefaultCookieConfig, []byte("test"), nil)
+
+	rec := serveSSO(t, store, auth.Silent, httptest.NewRequest(http.MethodGet, "/auth/silent", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), "ok:  false ")
+}
+
+func TestClientJS(t *testing.T) {
+	assert := require.New(t)
+
+	auth, err := NewAuth(newConfig(), mockProviderFunc)
+	assert.NoError(err)
+
+	store := sessions.NewCookieStore[string](sessions.DefaultCookieConfig, []byte("test"), nil)
+
+	rec := serveSSO(t, store, auth.ClientJS, httptest.NewRequest(http.MethodGet, "/auth/client.js", nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal(echo.MIMEApplicationJavaScriptCharsetUTF8, rec.Header().Get(echo.HeaderContentType))
+	assert.Contains(rec.Body.String(), "window.ProxyAuth")
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/client.js", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+
+	rec = serveSSO(t, store, auth.ClientJS, req)
+	assert.Equal(http.StatusNotModified, rec.Code)
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/rs/zerolog/log"
+	"github.com/wolfeidau/website-openid-proxy/internal/content"
+	"github.com/wolfeidau/website-openid-proxy/internal/flags"
+	"github.com/wolfeidau/website-openid-proxy/internal/pathmatch"
+)
+
+const siteContextKey = "_site"
+
+// Site a site served by the proxy along with the content middleware and presigner for its bucket
+type Site struct {
+	flags.Site
+
+	// Content serves the objects of the site.
+	Content echo.MiddlewareFunc
+
+	// Presigner issues share links for objects in the site bucket.
+	Presigner content.Presigner
+}
+
+// Key returns the object key for a request path within the site, sites with previews resolve the path within
+// the preview build selected by the request the same way as the content middleware. Paths which don't select a
+// preview build, or contain dot segments, return false.
+func (s *Site) Key(c echo.Context, p string) (string, bool) {
+	// dot segments would escape the key prefix
+	if !pathmatch.IsClean(p) {
+		return "", false
+	}
+
+	pathPrefix, keyPrefix := s.PathPrefix, s.KeyPrefix
+
+	if s.Preview != "" {
+		var ok bool
+
+		pathPrefix, keyPrefix, ok = s.previewPrefix(c, p)
+		if !ok {
+			return "", false
+		}
+	}
+
+	return keyPrefix + strings.TrimPrefix(strings.TrimPrefix(p, pathPrefix), "/"), true
+}
+
+// SiteRouter selects the site serving each request using the host and path prefix
+type SiteRouter struct {
+	sites []*Site
+}
+
+// NewSiteRouter create a router for the sites, these are matched in order
+func NewSiteRouter(sites []*Site) *SiteRouter {
+	return &SiteRouter{sites: sites}
+}
+
+// Match returns the first site matching the host and path, or nil if there isn't one
+func (r *SiteRouter) Match(host, p string) *Site {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	for _, s := range r.sites {
+		if len(s.Hosts) > 0 && !HostAllowed(s.Hosts, host) {
+			continue
+		}
+
+		if s.PathPrefix != "" && p != s.PathPrefix && !strings.HasPrefix(p, s.PathPrefix+"/") {
+			continue
+		}
+
+		return s
+	}
+
+	return nil
+}
+
+// CurrentSite returns the site attached to the request by the router, or nil if there isn't one
+func CurrentSite(c echo.Context) *Site {
+	site, _ := c.Get(siteContextKey).(*Site)
+	return site
+}
+
+// Middleware attaches the matching site to the request so the site policies are used to authorize it,
+// requests which don't match a site aren't found.
+func (r *SiteRouter) Middleware(skipper middleware.Skipper) echo.MiddlewareFunc {
+	if skipper == nil {
+		skipper = middleware.DefaultSkipper
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if skipper(c) {
+				return next(c)
+			}
+
+			site := r.Match(RequestHost(c), c.Request().URL.Path)
+			if site == nil {
+				log.Ctx(c.Request().Context()).Warn().Str("host", RequestHost(c)).Msg("no site matched request")
+
+				return echo.NewHTTPError(http.StatusNotFound, "document not found")
+			}
+
+			log.Ctx(c.Request().Context()).Info().
+				Str("site", site.Name).
+				Str("bucket", site.Bucket).
+				Str("key_prefix", site.KeyPrefix).
+				Msg("routed request")
+
+			c.Set(siteContextKey, site)
+
+			return next(c)
+		}
+	}
+}
+
+// Content serves the request using the content middleware of the current site
+func (r *SiteRouter) Content() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		handlers := make(map[*Site]echo.HandlerFunc, len(r.sites))
+		for _, s := range r.sites {
+			if s.Content != nil {
+				handlers[s] = s.Content(next)
+			}
+		}
+
+		return func(c echo.Context) error {
+			if h, ok := handlers[CurrentSite(c)]; ok {
+				return h(c)
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/website-openid-proxy/internal/flags"
+)
+
+func newSites() []*Site {
+	content := func(name string) echo.MiddlewareFunc {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				return c.String(http.StatusOK, name)
+			}
+		}
+	}
+
+	return []*Site{
+		{Site: flags.Site{Name: "docs", Hosts: []string{"*.example.com"}, PathPrefix: "/docs", KeyPrefix: "docs/"}, Content: content("docs")},
+		{Site: flags.Site{Name: "blog", Hosts: []string{"blog.example.com"}, PublicPaths: []string{"/**"}}, Content: content("blog")},
+		{Site: flags.Site{Name: "internal", Hosts: []string{"internal.example.com"}, IdentityAwarePaths: []string{"/index.html"}}, Content: content("internal")},
+	}
+}
+
+func TestSiteRouter_Match(t *testing.T) {
+	r := NewSiteRouter(newSites())
+
+	tests := []struct {
+		host, path string
+		want       string
+	}{
+		{host: "blog.example.com", path: "/docs/intro.html", want: "docs"},
+		{host: "blog.example.com", path: "/docs", want: "docs"},
+		{host: "blog.example.com:8443", path: "/documents/", want: "blog"},
+		{host: "internal.example.com", path: "/", want: "internal"},
+		{host: "other.com", path: "/", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host+tt.path, func(t *testing.T) {
+			var name string
+			if site := r.Match(tt.host, tt.path); site != nil {
+				name = site.Name
+			}
+			require.Equal(t, tt.want, name)
+		})
+	}
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+	key, ok := r.Match("a.example.com", "/docs/guide/intro.html").Key(c, "/docs/guide/intro.html")
+	require.True(t, ok)
+	require.Equal(t, "docs/guide/intro.html", key)
+
+	_, ok = r.Match("a.example.com", "/docs/../other/secret.html").Key(c, "/docs/../other/secret.html")
+	require.False(t, ok)
+}
+
+func TestSiteRouter_Middleware(t *testing.T) {
+	assert := require.New(t)
+
+	r := NewSiteRouter(newSites())
+
+	e := echo.New()
+	e.Use(r.Middleware(nil))
+	e.Use(CheckAuthWithConfig(Config{}))
+	e.Use(r.Content())
+
+	// the blog is public
+	req := httptest.NewRequest(http.MethodGet, "/post.html", nil)
+	req.Host = "blog.example.com"
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("blog", rec.Body.String())
+
+	// internal requires a login
+	req = httptest.NewRequest(http.MethodGet, "/post.html", nil)
+	req.Host = "internal.example.com"
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(http.StatusFound, rec.Code)
+
+	// except for the identity aware paths of the site
+	req = httptest.NewRequest(http.MethodGet, "/index.html", nil)
+	req.Host = "internal.example.com"
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("internal", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/docs/index.html", nil)
+	req.Host = "www.example.com"
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(http.StatusFound, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/post.html", nil)
+	req.Host = "other.com"
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/wolfeidau/website-openid-proxy/internal/echosessions"
+	"github.com/wolfeidau/website-openid-proxy/internal/ticket"
+)
+
+// SSO central auth host http handler which issues a ticket for the logged in user to a client site,
+// users who aren't logged in are sent to login first.
+func (l *Auth) SSO(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	returnTo, err := url.Parse(c.QueryParam("return_to"))
+	if err != nil || !returnTo.IsAbs() || !HostAllowed(l.authConfig.SSOClientHosts, returnTo.Host) {
+		log.Ctx(ctx).Error().Str("return_to", c.QueryParam("return_to")).Msg("invalid sso return_to")
+
+		// TODO: Need an error page
+		return c.String(http.StatusBadRequest, "failed to process request")
+	}
+
+	state := c.QueryParam("state")
+	if state == "" {
+		log.Ctx(ctx).Error().Msg("missing sso state")
+
+		// TODO: Need an error page
+		return c.String(http.StatusBadRequest, "failed to process request")
+	}
+
+	// come back here once the user has logged in
+	loginURL := l.authConfig.AuthPrefix + "/login?" + url.Values{"return_to": {c.Request().URL.RequestURI()}}.Encode()
+
+	loginSess, err := echosessions.Get(loggedInCookieName, c)
+	if err != nil {
+		return c.Redirect(http.StatusFound, loginURL)
+	}
+
+	info, err := userInfoFromSession(loginSess)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to read user info from session")
+
+		// TODO: Need an error page
+		return c.String(http.StatusInternalServerError, "failed to process request")
+	}
+
+	if info.Expired(time.Now(), l.authConfig.SessionIdleTimeout) {
+		return c.Redirect(http.StatusFound, loginURL)
+	}
+
+	// revoked sessions must not be able to login to the client sites
+	err = l.checkSession(ctx, info)
+	if errors.Is(err, ErrSessionRevoked) {
+		return c.Redirect(http.StatusFound, loginURL)
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to check session registry")
+
+		// TODO: Need an error page
+		return c.String(http.StatusInternalServerError, "failed to process request")
+	}
+
+	val, err := l.tickets.Encode(&ticket.Ticket{
+		Sub:      info.Sub,
+		Email:    info.Email,
+		Issuer:   info.Issuer,
+		AuthTime: info.AuthTime,
+		Claims:   info.Claims,
+		State:    state,
+		Audience: strings.ToLower(returnTo.Host),
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to encode ticket")
+
+		// TODO: Need an error page
+		return c.String(http.StatusInternalServerError, "failed to process request")
+	}
+
+	q := returnTo.Query()
+	q.Set("ticket", val)
+	returnTo.RawQuery = q.Encode()
+
+	log.Ctx(ctx).Info().Str("email", info.Email).Str("audience", returnTo.Host).Msg("issued sso ticket")
+
+	return c.Redirect(http.StatusFound, returnTo.String())
+}
+
+// Ticket client site http handler which exchanges a ticket issued by the central auth host for a local session.
+func (l *Auth) Ticket(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	authSess, err := echosessions.Get(authCookieName, c)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to get auth session")
+
+		// TODO: Need an error page
+		return c.String(http.StatusBadRequest, "failed to process request")
+	}
+
+	// clean up the completed auth session
+	defer authSess.Destroy(c.Response())
+
+	tkt, err := l.tickets.Decode(c.QueryParam("ticket"))
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to decode ticket")
+
+		// TODO: Need an error page
+		return c.String(http.StatusBadRequest, "failed to process request")
+	}
+
+	if tkt.State == "" || tkt.State != authSess.Get("state") {
+		log.Ctx(ctx).Error().Msg("failed to validate ticket state")
+
+		// TODO: Need an error page
+		return c.String(http.StatusBadRequest, "failed to process request")
+	}
+
+	if tkt.Audience != strings.ToLower(RequestHost(c)) {
+		log.Ctx(ctx).Error().Str("audience", tkt.Audience).Msg("failed to validate ticket audience")
+
+		// TODO: Need an error page
+		return c.String(http.StatusBadRequest, "failed to process request")
+	}
+
+	err = l.saveLogin(c, &UserInfo{
+		Sub:      tkt.Sub,
+		Email:    tkt.Email,
+		Issuer:   tkt.Issuer,
+		AuthTime: tkt.AuthTime,
+		Claims:   tkt.Claims,
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to save session")
+
+		// TODO: Need an error page
+		return c.String(http.StatusInternalServerError, "failed to process request")
+	}
+
+	return c.Redirect(http.StatusFound, safeReturnTo(authSess.Get("return_to")))
+}
+
+// loginCentral sends the user to the central auth host which will return a ticket to this site.
+func (l *Auth) loginCentral(c echo.Context) error {
+
+	ctx := c.Request().Context()
+
+	ticketURL, err := l.routeURL(c, "/ticket")
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("host", RequestHost(c)).Msg("failed to build ticket url")
+
+		// TODO: Need an error page
+		return c.String(http.StatusBadRequest, "failed to process request")
+	}
+
+	state := MustRandomState(stateLength)
+
+	authSess, err := echosessions.New(authCookieName, c)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to create new session")
+
+		// TODO: Need an error page
+		return c.String(http.StatusInternalServerError, "failed to process request")
+	}
+
+	authSess.Set("state", state)
+	authSess.Set("return_to", safeReturnTo(c.QueryParam("return_to")))
+
+	err = authSess.Save(c.Response())
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to save session")
+
+		// TODO: Need an error page
+		return c.String(http.StatusInternalServerError, "failed to process request")
+	}
+
+	ssoURL := strings.TrimSuffix(l.authConfig.CentralAuthURL, "/") + "/sso?" + url.Values{
+		"return_to": {ticketURL},
+		"state":     {state},
+	}.Encode()
+
+	return c.Redirect(http.StatusFound, ssoURL)
+}
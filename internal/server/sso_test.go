@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dghubble/sessions"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/website-openid-proxy/internal/echosessions"
+	"github.com/wolfeidau/website-openid-proxy/internal/logger"
+	"github.com/wolfeidau/website-openid-proxy/internal/registry"
+	"github.com/wolfeidau/website-openid-proxy/internal/ticket"
+)
+
+func TestSSO(t *testing.T) {
+	assert := require.New(t)
+
+	codec := ticket.NewCodec([]byte("shared"), time.Minute)
+
+	hostCfg := newConfig()
+	hostCfg.SSOClientHosts = []string{"*.docs.example.com"}
+
+	host, err := NewAuth(hostCfg, mockProviderFunc, WithTicketCodec(codec))
+	assert.NoError(err)
+
+	clientCfg := newConfig()
+	clientCfg.CentralAuthURL = "https://auth.example.com/auth"
+	clientCfg.AllowedHosts = []string{"*.docs.example.com"}
+
+	client, err := NewAuth(clientCfg, mockProviderFunc, WithTicketCodec(codec))
+	assert.NoError(err)
+
+	hostStore := sessions.NewCookieStore[string](sessions.DefaultCookieConfig, []byte("host"), nil)
+	clientStore := sessions.NewCookieStore[string](sessions.DefaultCookieConfig, []byte("client"), nil)
+
+	// client site sends the user to the central auth host
+	rec := serveSSO(t, clientStore, client.Login, httptest.NewRequest(http.MethodGet, "https://site.docs.example.com/auth/login?return_to=/guide/", nil))
+	assert.Equal(http.StatusFound, rec.Code)
+
+	ssoURL, err := url.Parse(rec.Header().Get(echo.HeaderLocation))
+	assert.NoError(err)
+	assert.Equal("auth.example.com", ssoURL.Host)
+	assert.Equal("/auth/sso", ssoURL.Path)
+	assert.Equal("https://site.docs.example.com/auth/ticket", ssoURL.Query().Get("return_to"))
+
+	authCookies := rec.Result().Cookies()
+
+	// central auth host issues a ticket for the logged in user
+	loginRec := httptest.NewRecorder()
+	loginSess := hostStore.New(loggedInCookieName)
+	loginSess.Set("sub", "abc123")
+	loginSess.Set("email", "mark@wolfe.id.au")
+	assert.NoError(loginSess.Save(loginRec))
+
+	req := httptest.NewRequest(http.MethodGet, ssoURL.String(), nil)
+	addCookies(req, loginRec.Result().Cookies())
+
+	rec = serveSSO(t, hostStore, host.SSO, req)
+	assert.Equal(http.StatusFound, rec.Code)
+
+	ticketURL, err := url.Parse(rec.Header().Get(echo.HeaderLocation))
+	assert.NoError(err)
+	assert.Equal("site.docs.example.com", ticketURL.Host)
+	assert.NotEmpty(ticketURL.Query().Get("ticket"))
+
+	// client site exchanges the ticket for a local session
+	req = httptest.NewRequest(http.MethodGet, ticketURL.String(), nil)
+	addCookies(req, authCookies)
+
+	rec = serveSSO(t, clientStore, client.Ticket, req)
+	assert.Equal(http.StatusFound, rec.Code)
+	assert.Equal("/guide/", rec.Header().Get(echo.HeaderLocation))
+
+	var loggedIn bool
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == loggedInCookieName && cookie.Value != "" {
+			loggedIn = true
+		}
+	}
+	assert.True(loggedIn)
+
+	// tickets are bound to the site they were issued for
+	req = httptest.NewRequest(http.MethodGet, ticketURL.String(), nil)
+	req.Host = "other.docs.example.com"
+	addCookies(req, authCookies)
+
+	rec = serveSSO(t, clientStore, client.Ticket, req)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+}
+
+func TestSSO_NotLoggedIn(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := newConfig()
+	cfg.SSOClientHosts = []string{"*.docs.example.com"}
+
+	host, err := NewAuth(cfg, mockProviderFunc, WithTicketCodec(ticket.NewCodec([]byte("shared"), time.Minute)))
+	assert.NoError(err)
+
+	store := sessions.NewCookieStore[string](sessions.DefaultCookieConfig, []byte("host"), nil)
+
+	rec := serveSSO(t, store, host.SSO, httptest.NewRequest(http.MethodGet, "/auth/sso?state=abc&return_to=https%3A%2F%2Fsite.docs.example.com%2Fauth%2Fticket", nil))
+	assert.Equal(http.StatusFound, rec.Code)
+	assert.Equal("/auth/login?return_to=%2Fauth%2Fsso%3Fstate%3Dabc%26return_to%3Dhttps%253A%252F%252Fsite.docs.example.com%252Fauth%252Fticket", rec.Header().Get(echo.HeaderLocation))
+
+	// only client hosts can receive tickets
+	rec = serveSSO(t, store, host.SSO, httptest.NewRequest(http.MethodGet, "/auth/sso?state=abc&return_to=https%3A%2F%2Fevil.example.com%2Fauth%2Fticket", nil))
+	assert.Equal(http.StatusBadRequest, rec.Code)
+}
+
+func TestSSO_RevokedSession(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := newConfig()
+	cfg.SSOClientHosts = []string{"*.docs.example.com"}
+
+	reg := registry.NewMemoryStore()
+
+	host, err := NewAuth(cfg, mockProviderFunc, WithTicketCodec(ticket.NewCodec([]byte("shared"), time.Minute)), WithSessionRegistry(reg))
+	assert.NoError(err)
+
+	store := sessions.NewCookieStore[string](sessions.DefaultCookieConfig, []byte("host"), nil)
+
+	rec := serveSSO(t, store, func(c echo.Context) error {
+		return host.saveLogin(c, &UserInfo{Sub: "abc123", Email: "mark@wolfe.id.au"})
+	}, httptest.NewRequest(http.MethodGet, "/auth/callback", nil))
+	loginCookies := rec.Result().Cookies()
+
+	sso := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/auth/sso?state=abc&return_to=https%3A%2F%2Fsite.docs.example.com%2Fauth%2Fticket", nil)
+		addCookies(req, loginCookies)
+
+		return serveSSO(t, store, host.SSO, req)
+	}
+
+	rec = sso()
+	assert.Equal(http.StatusFound, rec.Code)
+	assert.Contains(rec.Header().Get(echo.HeaderLocation), "https://site.docs.example.com/auth/ticket?")
+
+	list, err := reg.List(context.TODO(), "abc123")
+	assert.NoError(err)
+	assert.Len(list, 1)
+	assert.NoError(reg.Delete(context.TODO(), list[0].ID))
+
+	// a revoked session is sent to login rather than issued a ticket
+	rec = sso()
+	assert.Equal(http.StatusFound, rec.Code)
+	assert.True(strings.HasPrefix(rec.Header().Get(echo.HeaderLocation), "/auth/login?"))
+}
+
+func serveSSO(t *testing.T, store sessions.Store[string], handler echo.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	req = req.WithContext(logger.NewLoggerWithContext(context.TODO()))
+	req.Header.Set(echo.HeaderXForwardedProto, "https")
+
+	rec := httptest.NewRecorder()
+
+	h := echosessions.Middleware(store)(handler)
+
+	require.NoError(t, h(echo.New().NewContext(req, rec)))
+
+	return rec
+}
+
+func addCookies(req *http.Request, cookies []*http.Cookie) {
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+}
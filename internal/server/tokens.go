@@ -0,0 +1,386 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/wolfeidau/website-openid-proxy/internal/audit"
+	"github.com/wolfeidau/website-openid-proxy/internal/echosessions"
+	"github.com/wolfeidau/website-openid-proxy/internal/pathmatch"
+	"github.com/wolfeidau/website-openid-proxy/internal/tokens"
+)
+
+const maxTokenNameLength = 100
+
+var tokensTemplate = template.Must(template.New("tokens").Funcs(template.FuncMap{
+	"date": func(sec int64) string { return time.Unix(sec, 0).UTC().Format(time.RFC3339) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><title>Personal access tokens</title></head>
+<body>
+<h1>Personal access tokens</h1>
+{{if .Created}}<p>Copy the new token now, it won't be shown again.</p>
+<pre>{{.Created.Token}}</pre>
+{{end}}<table>
+<tr><th>Name</th>{{if .All}}<th>Email</th>{{end}}<th>Paths</th><th>Created</th><th>Expires</th><th></th></tr>
+{{range .Tokens}}<tr><td>{{.Name}}</td>{{if $.All}}<td>{{.Email}}</td>{{end}}<td>{{range .Paths}}{{.}} {{else}}all{{end}}</td><td>{{date .CreatedAt}}</td><td>{{date .ExpiresAt}}</td>
+<td><form method="post" action="{{$.Action}}/{{.ID}}/revoke"><input type="hidden" name="_csrf" value="{{$.Token}}"><button type="submit">Revoke</button></form></td></tr>
+{{end}}</table>
+{{if .Admin}}<p>{{if .All}}<a href="{{.Action}}">Your tokens</a>{{else}}<a href="{{.Action}}?all=true">All tokens</a>{{end}}</p>
+{{end}}<h2>New token</h2>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="_csrf" value="{{.Token}}">
+<label>Name <input name="name" required></label>
+<label>Paths <input name="paths" placeholder="/reports/**"></label>
+<label>Expires after <input name="ttl" placeholder="{{.MaxTTL}}"></label>
+<button type="submit">Create</button>
+</form>
+</body>
+</html>
+`))
+
+// TokenRequest the name of a new personal access token, the path patterns it is limited to and how long it
+// is valid, the ttl defaults to the configured maximum
+type TokenRequest struct {
+	Name  string   `json:"name" form:"name"`
+	Paths []string `json:"paths" form:"paths"`
+	TTL   string   `json:"ttl" form:"ttl"`
+}
+
+// TokenResponse a personal access token, the token value is only included when it is created
+type TokenResponse struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Sub       string   `json:"sub"`
+	Email     string   `json:"email"`
+	Paths     []string `json:"paths,omitempty"`
+	CreatedAt int64    `json:"created_at"`
+	ExpiresAt int64    `json:"expires_at"`
+	Token     string   `json:"token,omitempty"`
+}
+
+// Tokens tokens http handler which lists the personal access tokens of the user, admins can list the tokens
+// of all users by adding all=true.
+func (l *Auth) Tokens(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	info, err := l.sessionUser(c)
+	if err != nil {
+		return c.String(http.StatusUnauthorized, "failed to process request")
+	}
+
+	all := c.QueryParam("all") == "true"
+	if all && !l.isAdmin(info) {
+		return c.String(http.StatusForbidden, "forbidden")
+	}
+
+	subject := info.Sub
+	if all {
+		subject = ""
+	}
+
+	list, err := l.listTokens(c, subject)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to list tokens")
+
+		// TODO: Need an error page
+		return c.String(http.StatusInternalServerError, "failed to process request")
+	}
+
+	if IsAPIRequest(c) {
+		return c.JSON(http.StatusOK, list)
+	}
+
+	return l.renderTokens(c, info, list, all, nil)
+}
+
+// CreateToken create token http handler, the token authenticates as the user and is limited to the paths
+// in the request.
+func (l *Auth) CreateToken(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	info, err := l.sessionUser(c)
+	if err != nil {
+		return c.String(http.StatusUnauthorized, "failed to process request")
+	}
+
+	req := new(TokenRequest)
+
+	err = c.Bind(req)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "failed to process request")
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxTokenNameLength {
+		return c.String(http.StatusBadRequest, "invalid name")
+	}
+
+	// the form accepts several patterns in one field
+	var paths []string
+	for _, p := range req.Paths {
+		paths = append(paths, strings.FieldsFunc(p, func(r rune) bool { return r == ',' || r == ' ' })...)
+	}
+
+	for _, p := range paths {
+		if !pathmatch.Valid(p) {
+			return c.String(http.StatusBadRequest, "invalid path")
+		}
+	}
+
+	ttl := l.authConfig.TokenMaxTTL
+	if req.TTL != "" {
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 || ttl > l.authConfig.TokenMaxTTL {
+			return c.String(http.StatusBadRequest, "invalid ttl")
+		}
+	}
+
+	now := time.Now()
+
+	t, value, err := tokens.New(req.Name, paths, now, ttl)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to generate token")
+
+		// TODO: Need an error page
+		return c.String(http.StatusInternalServerError, "failed to process request")
+	}
+
+	t.Subject, t.Email, t.Issuer, t.Claims = info.Sub, info.Email, info.Issuer, info.Claims
+	t.ClaimsUpdatedAt = now.Unix()
+
+	err = l.tokens.Put(ctx, t)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to store token")
+
+		// TODO: Need an error page
+		return c.String(http.StatusInternalServerError, "failed to process request")
+	}
+
+	l.audit.Record(ctx, audit.Event{
+		Action:  "token_create",
+		Subject: info.Sub,
+		Email:   info.Email,
+		Allowed: true,
+		Fields:  map[string]interface{}{"token_id": t.ID, "name": t.Name, "ttl": ttl.String()},
+	})
+
+	created := tokenResponse(t)
+	created.Token = value
+
+	// browsers submitting the form are shown the token along with the others
+	if c.FormValue(csrfFormField) != "" {
+		list, err := l.listTokens(c, info.Sub)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("failed to list tokens")
+
+			// TODO: Need an error page
+			return c.String(http.StatusInternalServerError, "failed to process request")
+		}
+
+		return l.renderTokens(c, info, list, false, created)
+	}
+
+	return c.JSON(http.StatusCreated, created)
+}
+
+// RevokeToken revoke token http handler, users can revoke their own tokens and admins can revoke any token
+func (l *Auth) RevokeToken(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	info, err := l.sessionUser(c)
+	if err != nil {
+		return c.String(http.StatusUnauthorized, "failed to process request")
+	}
+
+	t, err := l.tokens.Get(ctx, c.Param("id"))
+	if errors.Is(err, tokens.ErrNotFound) {
+		return c.String(http.StatusNotFound, "not found")
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to get token")
+
+		// TODO: Need an error page
+		return c.String(http.StatusInternalServerError, "failed to process request")
+	}
+
+	evt := audit.Event{
+		Action:  "token_revoke",
+		Subject: info.Sub,
+		Email:   info.Email,
+		Fields:  map[string]interface{}{"token_id": t.ID, "name": t.Name, "owner": t.Subject},
+	}
+
+	// other users tokens are hidden from everyone but admins
+	if t.Subject != info.Sub && !l.isAdmin(info) {
+		l.audit.Record(ctx, evt)
+
+		return c.String(http.StatusNotFound, "not found")
+	}
+
+	err = l.tokens.Delete(ctx, t.ID)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to delete token")
+
+		// TODO: Need an error page
+		return c.String(http.StatusInternalServerError, "failed to process request")
+	}
+
+	evt.Allowed = true
+	l.audit.Record(ctx, evt)
+
+	if c.FormValue(csrfFormField) != "" {
+		return c.Redirect(http.StatusSeeOther, l.authConfig.AuthPrefix+"/tokens")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// verifyToken verifies a personal access token returning the user who created it, limited to the paths of the token
+func (l *Auth) verifyToken(c echo.Context, value string) (*UserInfo, error) {
+	id, secret, ok := tokens.Parse(value)
+	if !ok {
+		return nil, errors.New("malformed personal access token")
+	}
+
+	t, err := l.tokens.Get(c.Request().Context(), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get personal access token: %w", err)
+	}
+
+	if !t.Verify(secret) {
+		return nil, errors.New("invalid personal access token")
+	}
+
+	now := time.Now()
+
+	if t.Expired(now) {
+		return nil, errors.New("personal access token expired")
+	}
+
+	// the claims may no longer be current if the user hasn't logged in recently, so roles and groups granted
+	// by them are dropped
+	claims := t.Claims
+	if now.Sub(time.Unix(t.ClaimsUpdatedAt, 0)) > l.authConfig.TokenClaimsTTL {
+		claims = nil
+	}
+
+	return &UserInfo{
+		Sub:              t.Subject,
+		Email:            t.Email,
+		Issuer:           t.Issuer,
+		AuthTime:         t.CreatedAt,
+		SessionExpiresAt: t.ExpiresAt,
+		Claims:           claims,
+		paths:            t.Paths,
+	}, nil
+}
+
+// refreshTokens copies the current claims of the user into their personal access tokens
+func (l *Auth) refreshTokens(ctx context.Context, info *UserInfo, now time.Time) error {
+	list, err := l.tokens.List(ctx, info.Sub)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range list {
+		if t.Expired(now) {
+			continue
+		}
+
+		t.Email, t.Claims, t.ClaimsUpdatedAt = info.Email, info.Claims, now.Unix()
+
+		err = l.tokens.Put(ctx, t)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listTokens returns the unexpired tokens of the subject, or of all users when the subject is empty
+func (l *Auth) listTokens(c echo.Context, subject string) ([]*TokenResponse, error) {
+	all, err := l.tokens.List(c.Request().Context(), subject)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	list := []*TokenResponse{}
+
+	for _, t := range all {
+		if t.Expired(now) {
+			continue
+		}
+
+		list = append(list, tokenResponse(t))
+	}
+
+	return list, nil
+}
+
+func (l *Auth) renderTokens(c echo.Context, info *UserInfo, list []*TokenResponse, all bool, created *TokenResponse) error {
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	c.Response().WriteHeader(http.StatusOK)
+
+	return tokensTemplate.Execute(c.Response(), map[string]interface{}{
+		"Action":  l.authConfig.AuthPrefix + "/tokens",
+		"Token":   csrfToken(c),
+		"Tokens":  list,
+		"All":     all,
+		"Admin":   l.isAdmin(info),
+		"Created": created,
+		"MaxTTL":  l.authConfig.TokenMaxTTL.String(),
+	})
+}
+
+// sessionUser returns the user logged in with a session which hasn't expired
+func (l *Auth) sessionUser(c echo.Context) (*UserInfo, error) {
+	sess, err := echosessions.Get(loggedInCookieName, c)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := userInfoFromSession(sess)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Expired(time.Now(), l.authConfig.SessionIdleTimeout) {
+		return nil, errors.New("session expired")
+	}
+
+	err = l.checkSession(c.Request().Context(), info)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// isAdmin returns true if the user has the configured admin role
+func (l *Auth) isAdmin(info *UserInfo) bool {
+	return l.authConfig.AdminRole != "" && info.HasRole(l.authConfig.AdminClaim, l.authConfig.AdminRole)
+}
+
+func tokenResponse(t *tokens.Token) *TokenResponse {
+	return &TokenResponse{
+		ID:        t.ID,
+		Name:      t.Name,
+		Sub:       t.Subject,
+		Email:     t.Email,
+		Paths:     t.Paths,
+		CreatedAt: t.CreatedAt,
+		ExpiresAt: t.ExpiresAt,
+	}
+}
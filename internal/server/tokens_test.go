@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dghubble/sessions"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/website-openid-proxy/internal/audit"
+	"github.com/wolfeidau/website-openid-proxy/internal/tokens"
+)
+
+func TestTokens(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := newConfig()
+	cfg.Claims = []string{"groups"}
+	cfg.TokenMaxTTL = 24 * time.Hour
+	cfg.TokenClaimsTTL = time.Hour
+	cfg.AdminClaim = "groups"
+	cfg.AdminRole = "admins"
+
+	var events []audit.Event
+
+	tokenStore := tokens.NewMemoryStore()
+
+	auth, err := NewAuth(cfg, mockProviderFunc, WithTokenStore(tokenStore), WithAuditLogger(audit.LoggerFunc(func(ctx context.Context, evt audit.Event) {
+		events = append(events, evt)
+	})))
+	assert.NoError(err)
+
+	store := sessions.NewCookieStore[string](sessions.DefaultCookieConfig, []byte("test"), nil)
+
+	login := func(sub, email, claims string) []*http.Cookie {
+		rec := httptest.NewRecorder()
+		sess := store.New(loggedInCookieName)
+		sess.Set("sub", sub)
+		sess.Set("email", email)
+		if claims != "" {
+			sess.Set("claims", claims)
+		}
+		assert.NoError(sess.Save(rec))
+
+		return rec.Result().Cookies()
+	}
+
+	user := login("abc123", "mark@wolfe.id.au", `{"groups":["staff"]}`)
+	admin := login("def456", "admin@example.com", `{"groups":["admins"]}`)
+
+	serve := func(method, target, body string, cookies []*http.Cookie, handler echo.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+		addCookies(req, cookies)
+
+		return serveSSO(t, store, handler, req)
+	}
+
+	revoke := func(id string) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.SetParamNames("id")
+			c.SetParamValues(id)
+			return auth.RevokeToken(c)
+		}
+	}
+
+	rec := serve(http.MethodPost, "/auth/tokens", `{"name": "reports", "paths": ["/reports/**"], "ttl": "1h"}`, user, auth.CreateToken)
+	assert.Equal(http.StatusCreated, rec.Code)
+
+	created := new(TokenResponse)
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), created))
+	assert.True(tokens.IsToken(created.Token))
+	assert.Equal([]string{"/reports/**"}, created.Paths)
+
+	rec = serve(http.MethodPost, "/auth/tokens", `{"name": "reports", "ttl": "48h"}`, user, auth.CreateToken)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = serve(http.MethodPost, "/auth/tokens", `{"name": "reports", "paths": ["reports"]}`, user, auth.CreateToken)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = serve(http.MethodGet, "/auth/tokens", "", user, auth.Tokens)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), `"name":"reports"`)
+	assert.NotContains(rec.Body.String(), created.Token)
+
+	rec = serve(http.MethodGet, "/auth/tokens?all=true", "", user, auth.Tokens)
+	assert.Equal(http.StatusForbidden, rec.Code)
+
+	rec = serve(http.MethodGet, "/auth/tokens?all=true", "", admin, auth.Tokens)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), `"email":"mark@wolfe.id.au"`)
+
+	// the token authenticates as the user, limited to its paths
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/reports/summary.pdf", nil), httptest.NewRecorder())
+
+	info, err := auth.VerifyBearer(c, created.Token)
+	assert.NoError(err)
+	assert.Equal("abc123", info.Sub)
+	assert.Equal([]string{"staff"}, info.Groups())
+	assert.True(Authorize(nil, "/reports/summary.pdf", info))
+	assert.False(Authorize(nil, "/admin/users.csv", info))
+	assert.False(Authorize(nil, "/reports/../admin/users.csv", info))
+
+	// dot segments can't be used to leave the paths of the token
+	e := echo.New()
+	e.Use(CheckAuthWithConfig(Config{Bearer: auth.VerifyBearer}))
+	e.Any("/*", func(c echo.Context) error {
+		return c.String(http.StatusOK, CurrentUser(c).Email)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/reports/%2e%2e/admin/users.csv", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+created.Token)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(http.StatusBadRequest, rec.Code)
+
+	_, err = auth.VerifyBearer(c, created.Token+"x")
+	assert.Error(err)
+
+	// claims which haven't been copied recently aren't trusted
+	stored, err := tokenStore.Get(context.TODO(), created.ID)
+	assert.NoError(err)
+	stored.ClaimsUpdatedAt = time.Now().Add(-2 * time.Hour).Unix()
+	assert.NoError(tokenStore.Put(context.TODO(), stored))
+
+	info, err = auth.VerifyBearer(c, created.Token)
+	assert.NoError(err)
+	assert.Equal("abc123", info.Sub)
+	assert.Empty(info.Groups())
+
+	// they are copied again when the user logs in
+	assert.NoError(auth.refreshTokens(context.TODO(), &UserInfo{Sub: "abc123", Email: "mark@wolfe.id.au", Claims: map[string]interface{}{"groups": []interface{}{"editors"}}}, time.Now()))
+
+	info, err = auth.VerifyBearer(c, created.Token)
+	assert.NoError(err)
+	assert.Equal([]string{"editors"}, info.Groups())
+
+	// other users can't revoke the token
+	rec = serve(http.MethodPost, "/auth/tokens/"+created.ID+"/revoke", "", login("xyz789", "other@example.com", ""), revoke(created.ID))
+	assert.Equal(http.StatusNotFound, rec.Code)
+
+	rec = serve(http.MethodPost, "/auth/tokens/"+created.ID+"/revoke", "", admin, revoke(created.ID))
+	assert.Equal(http.StatusNoContent, rec.Code)
+
+	_, err = auth.VerifyBearer(c, created.Token)
+	assert.Error(err)
+
+	assert.Len(events, 3)
+	assert.Equal("token_create", events[0].Action)
+	assert.False(events[1].Allowed)
+	assert.Equal(audit.Event{Action: "token_revoke", Subject: "def456", Email: "admin@example.com", Allowed: true, Fields: map[string]interface{}{"token_id": created.ID, "name": "reports", "owner": "abc123"}}, events[2])
+
+	// users must be logged in
+	rec = serve(http.MethodGet, "/auth/tokens", "", nil, auth.Tokens)
+	assert.Equal(http.StatusUnauthorized, rec.Code)
+}
+
+func TestTokens_Form(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := newConfig()
+	cfg.TokenMaxTTL = 24 * time.Hour
+
+	auth, err := NewAuth(cfg, mockProviderFunc, WithTokenStore(tokens.NewMemoryStore()))
+	assert.NoError(err)
+
+	store := sessions.NewCookieStore[string](sessions.DefaultCookieConfig, []byte("test"), nil)
+
+	loginRec := httptest.NewRecorder()
+	loginSess := store.New(loggedInCookieName)
+	loginSess.Set("sub", "abc123")
+	loginSess.Set("email", "mark@wolfe.id.au")
+	assert.NoError(loginSess.Save(loginRec))
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/tokens", strings.NewReader("_csrf=token&name=deploy&paths=/reports/**+/docs/**"))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	addCookies(req, loginRec.Result().Cookies())
+
+	rec := serveSSO(t, store, auth.CreateToken, req)
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Contains(rec.Body.String(), "<pre>"+tokens.Prefix)
+	assert.Contains(rec.Body.String(), "/reports/** /docs/**")
+}
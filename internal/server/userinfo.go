@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"github.com/dghubble/sessions"
+	"golang.org/x/oauth2"
+)
+
+// UserInfo user info returned by user info route
+type UserInfo struct {
+	Sub    string `json:"sub,omitempty"`
+	Email  string `json:"email,omitempty"`
+	Issuer string `json:"issuer,omitempty"`
+	// AuthTime when the user authenticated in seconds since the epoch
+	AuthTime int64 `json:"auth_time,omitempty"`
+	// SessionExpiresAt when the session ends regardless of activity in seconds since the epoch
+	SessionExpiresAt int64 `json:"session_expires_at,omitempty"`
+	// IdleExpiresAt when the session ends if there is no further activity in seconds since the epoch
+	IdleExpiresAt int64 `json:"idle_expires_at,omitempty"`
+	// Claims the configured claims copied from the openid provider
+	Claims map[string]interface{} `json:"claims,omitempty"`
+	// CSRFToken the token required by state changing auth routes such as logout
+	CSRFToken string `json:"csrf_token,omitempty"`
+
+	lastSeen int64
+	// sessionID identifies the session in the registry of active sessions
+	sessionID string
+	// paths the user is limited to when authenticated by a personal access token
+	paths []string
+}
+
+// Expired returns true if the session has passed its expiry or has been idle for longer than the timeout
+func (u *UserInfo) Expired(now time.Time, idleTimeout time.Duration) bool {
+	if u.SessionExpiresAt != 0 && now.Unix() >= u.SessionExpiresAt {
+		return true
+	}
+
+	if idleTimeout > 0 && u.lastSeen != 0 && now.Unix() >= u.idleExpiry(idleTimeout) {
+		return true
+	}
+
+	return false
+}
+
+// Groups returns the groups claim if it was copied from the openid provider
+func (u *UserInfo) Groups() []string {
+	return u.claimValues("groups")
+}
+
+// HasRole returns true if the claim copied from the openid provider contains the role
+func (u *UserInfo) HasRole(claim, role string) bool {
+	for _, v := range u.claimValues(claim) {
+		if v == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// claimValues returns the claim as a list of strings, a single string is treated as a list of one
+func (u *UserInfo) claimValues(name string) []string {
+	var values []string
+
+	switch v := u.Claims[name].(type) {
+	case []interface{}:
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				values = append(values, s)
+			}
+		}
+	case string:
+		values = append(values, v)
+	}
+
+	return values
+}
+
+func (u *UserInfo) idleExpiry(idleTimeout time.Duration) int64 {
+	if idleTimeout <= 0 || u.lastSeen == 0 {
+		return 0
+	}
+
+	return u.lastSeen + int64(idleTimeout.Seconds())
+}
+
+func (u *UserInfo) save(sess *sessions.Session[string], now time.Time) error {
+	sess.Set("sub", u.Sub)
+	sess.Set("email", u.Email)
+	sess.Set("iss", u.Issuer)
+	sess.Set("auth_time", strconv.FormatInt(u.AuthTime, 10))
+	sess.Set("expires_at", strconv.FormatInt(u.SessionExpiresAt, 10))
+	sess.Set("last_seen", strconv.FormatInt(now.Unix(), 10))
+
+	u.lastSeen = now.Unix()
+
+	if u.sessionID != "" {
+		sess.Set("sid", u.sessionID)
+	}
+
+	if len(u.Claims) > 0 {
+		data, err := json.Marshal(u.Claims)
+		if err != nil {
+			return fmt.Errorf("failed to encode claims: %w", err)
+		}
+
+		sess.Set("claims", string(data))
+	}
+
+	return nil
+}
+
+func userInfoFromSession(val *sessions.Session[string]) (*UserInfo, error) {
+	sub, ok := val.GetOk("sub")
+	if !ok {
+		return nil, errors.New("failed to read sub")
+	}
+	email, ok := val.GetOk("email")
+	if !ok {
+		return nil, errors.New("failed to read email")
+	}
+
+	info := &UserInfo{
+		Sub:    sub,
+		Email:  email,
+		Issuer: val.Get("iss"),
+	}
+
+	// sessions created before these values were added won't have them
+	info.AuthTime, _ = strconv.ParseInt(val.Get("auth_time"), 10, 64)
+	info.SessionExpiresAt, _ = strconv.ParseInt(val.Get("expires_at"), 10, 64)
+	info.lastSeen, _ = strconv.ParseInt(val.Get("last_seen"), 10, 64)
+	info.sessionID = val.Get("sid")
+
+	if claims, ok := val.GetOk("claims"); ok {
+		err := json.Unmarshal([]byte(claims), &info.Claims)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read claims: %w", err)
+		}
+	}
+
+	return info, nil
+}
+
+// userInfoFromProvider builds the user info from the provider's userinfo endpoint, along with the verified
+// id token if one was returned, copying the configured claims.
+func (l *Auth) userInfoFromProvider(ctx context.Context, provider *oidc.Provider, tokens *oauth2.Token) (*UserInfo, error) {
+	userInfo, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(tokens))
+	if err != nil {
+		return nil, err
+	}
+
+	all := map[string]interface{}{}
+
+	err = userInfo.Claims(&all)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read userinfo claims: %w", err)
+	}
+
+	info := &UserInfo{
+		Sub:    userInfo.Subject,
+		Email:  userInfo.Email,
+		Issuer: l.authConfig.Issuer,
+	}
+
+	if rawIDToken, ok := tokens.Extra("id_token").(string); ok {
+		idToken, err := provider.Verifier(&oidc.Config{ClientID: l.authConfig.ClientID}).Verify(ctx, rawIDToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify id token: %w", err)
+		}
+
+		idClaims := map[string]interface{}{}
+
+		err = idToken.Claims(&idClaims)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read id token claims: %w", err)
+		}
+
+		// the userinfo endpoint takes precedence as it is the most up to date
+		for k, v := range idClaims {
+			if _, ok := all[k]; !ok {
+				all[k] = v
+			}
+		}
+
+		info.Issuer = idToken.Issuer
+
+		if authTime, ok := idClaims["auth_time"].(float64); ok {
+			info.AuthTime = int64(authTime)
+		}
+	}
+
+	info.Claims = selectClaims(all, l.authConfig.Claims)
+
+	return info, nil
+}
+
+func selectClaims(all map[string]interface{}, names []string) map[string]interface{} {
+	claims := map[string]interface{}{}
+
+	for _, name := range names {
+		if v, ok := all[name]; ok {
+			claims[name] = v
+		}
+	}
+
+	if len(claims) == 0 {
+		return nil
+	}
+
+	return claims
+}
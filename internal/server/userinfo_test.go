@@ -0,0 +1,30 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserInfo_ExpiredIdle(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Now()
+
+	info := &UserInfo{SessionExpiresAt: now.Add(time.Hour).Unix(), lastSeen: now.Add(-20 * time.Minute).Unix()}
+
+	assert.False(info.Expired(now, 0))
+	assert.False(info.Expired(now, 30*time.Minute))
+	assert.True(info.Expired(now, 15*time.Minute))
+	assert.True(info.Expired(now.Add(time.Hour), 0))
+}
+
+func TestSelectClaims(t *testing.T) {
+	assert := require.New(t)
+
+	all := map[string]interface{}{"sub": "abc123", "name": "Mark", "picture": "https://example.com/mark.png"}
+
+	assert.Equal(map[string]interface{}{"name": "Mark"}, selectClaims(all, []string{"name", "groups"}))
+	assert.Nil(selectClaims(all, nil))
+}
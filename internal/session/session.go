@@ -1,6 +1,10 @@
 package session
 
 import (
+	"net/http"
+	"strings"
+	"time"
+
 	"github.com/dghubble/sessions"
 	"github.com/labstack/echo/v4"
 	"github.com/wolfeidau/website-openid-proxy/internal/echosessions"
@@ -8,6 +12,16 @@ import (
 	"github.com/wolfeidau/website-openid-proxy/internal/secrets"
 )
 
+const (
+	// AuthCookieName the session used to store the oauth2 state during authentication
+	AuthCookieName   = "proxy_auth_session"
+	authCookieExpiry = 5 * time.Minute
+
+	// LoginCookieName the session used to store the logged in user
+	LoginCookieName   = "proxy_login_session"
+	loginCookieExpiry = 8 * time.Hour
+)
+
 // SetupMiddleware builds the session middleware after loading secrets
 func SetupMiddleware(cfg *flags.API, secretCache *secrets.Cache) (echo.MiddlewareFunc, error) {
 
@@ -18,12 +32,58 @@ func SetupMiddleware(cfg *flags.API, secretCache *secrets.Cache) (echo.Middlewar
 
 	// session middleware is available everwhere
 	sessionMiddleware := echosessions.MiddlewareWithConfig(echosessions.Config{
-		Store: sessions.NewCookieStore[string](
-			sessions.DefaultCookieConfig,
-			[]byte(sessionSecret),
-			nil,
-		),
+		Store: NewCookieStore([]byte(sessionSecret), Cookies(cfg.Cookies)),
 	})
 
 	return sessionMiddleware, nil
 }
+
+// Cookies builds the cookie for each session from the configured policies
+func Cookies(policies flags.Cookies) map[string]Cookie {
+	return map[string]Cookie{
+		AuthCookieName:  NewCookie(AuthCookieName, policies.Auth, authCookieExpiry),
+		LoginCookieName: NewCookie(LoginCookieName, policies.Login, loginCookieExpiry),
+	}
+}
+
+// LoginMaxAge returns how long a login session lasts using the policy
+func LoginMaxAge(policy flags.CookiePolicy) time.Duration {
+	if policy.MaxAge > 0 {
+		return policy.MaxAge
+	}
+
+	return loginCookieExpiry
+}
+
+// NewCookie builds a cookie from the policy, using secure defaults for any values which aren't set
+func NewCookie(name string, policy flags.CookiePolicy, maxAge time.Duration) Cookie {
+	cfg := &sessions.CookieConfig{
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HTTPOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		Domain:   policy.Domain,
+	}
+
+	if policy.Path != "" {
+		cfg.Path = policy.Path
+	}
+
+	if policy.MaxAge > 0 {
+		cfg.MaxAge = int(policy.MaxAge.Seconds())
+	}
+
+	if policy.Secure != nil {
+		cfg.Secure = *policy.Secure
+	}
+
+	switch strings.ToLower(policy.SameSite) {
+	case "strict":
+		cfg.SameSite = http.SameSiteStrictMode
+	case "none":
+		cfg.SameSite = http.SameSiteNoneMode
+	}
+
+	return Cookie{Name: policy.NamePrefix + name, Config: cfg}
+}
@@ -0,0 +1,134 @@
+package session
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dghubble/sessions"
+	"github.com/gorilla/securecookie"
+)
+
+// Cookie the name and attributes of the cookie used to store a named session
+type Cookie struct {
+	Name   string
+	Config *sessions.CookieConfig
+}
+
+type cookie struct {
+	Cookie
+	store sessions.Store[string]
+	codec securecookie.Codec
+}
+
+// CookieStore stores sessions in signed cookies, unlike the sessions cookie store each session name
+// has its own cookie name and attributes, and the max age is enforced when the cookie is read.
+type CookieStore struct {
+	secret   []byte
+	sessions map[string]*cookie
+	cookies  map[string]*cookie
+}
+
+var _ sessions.Store[string] = &CookieStore{}
+
+// NewCookieStore create a cookie store signing cookies with the secret, sessions which don't have
+// a cookie configured are stored using the session name and sessions.DefaultCookieConfig.
+func NewCookieStore(secret []byte, cookies map[string]Cookie) *CookieStore {
+	cs := &CookieStore{
+		secret:   secret,
+		sessions: make(map[string]*cookie),
+		cookies:  make(map[string]*cookie),
+	}
+
+	for name, c := range cookies {
+		sc := cs.build(name, c)
+
+		cs.sessions[name] = sc
+		cs.cookies[sc.Name] = sc
+	}
+
+	return cs
+}
+
+// New returns a new named session
+func (cs *CookieStore) New(name string) *sessions.Session[string] {
+	return sessions.NewSession[string](cs, cs.lookup(name).Name)
+}
+
+// Get returns the named session from the request, an error is returned if the cookie is missing,
+// fails verification or has exceeded the max age.
+func (cs *CookieStore) Get(req *http.Request, name string) (*sessions.Session[string], error) {
+	c := cs.lookup(name)
+
+	hc, err := req.Cookie(c.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+
+	err = securecookie.DecodeMulti(c.Name, hc.Value, &values, c.codec)
+	if err != nil {
+		return nil, err
+	}
+
+	sess := sessions.NewSession[string](cs, c.Name)
+	for k, v := range values {
+		sess.Set(k, v)
+	}
+
+	return sess, nil
+}
+
+// Save writes the session to the response
+func (cs *CookieStore) Save(w http.ResponseWriter, sess *sessions.Session[string]) error {
+	return cs.lookup(sess.Name()).store.Save(w, sess)
+}
+
+// Destroy expires the named session, this uses the same cookie attributes as when it was
+// saved so prefixed and domain cookies are removed.
+func (cs *CookieStore) Destroy(w http.ResponseWriter, name string) {
+	c := cs.lookup(name)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.Name,
+		Path:     c.Config.Path,
+		Domain:   c.Config.Domain,
+		MaxAge:   -1,
+		Expires:  time.Unix(1, 0),
+		Secure:   c.Config.Secure,
+		HttpOnly: c.Config.HTTPOnly,
+		SameSite: c.Config.SameSite,
+	})
+}
+
+func (cs *CookieStore) build(name string, c Cookie) *cookie {
+	if c.Name == "" {
+		c.Name = name
+	}
+
+	if c.Config == nil {
+		c.Config = sessions.DefaultCookieConfig
+	}
+
+	codec := securecookie.New(cs.secret, nil)
+	codec.MaxAge(c.Config.MaxAge)
+
+	return &cookie{
+		Cookie: c,
+		store:  sessions.NewCookieStore[string](c.Config, cs.secret, nil),
+		codec:  codec,
+	}
+}
+
+// lookup the cookie using either the session name or the cookie name
+func (cs *CookieStore) lookup(name string) *cookie {
+	if c, ok := cs.sessions[name]; ok {
+		return c
+	}
+
+	if c, ok := cs.cookies[name]; ok {
+		return c
+	}
+
+	return cs.build(name, Cookie{})
+}
@@ -0,0 +1,87 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/website-openid-proxy/internal/flags"
+)
+
+func TestCookieStore(t *testing.T) {
+	assert := require.New(t)
+
+	store := NewCookieStore([]byte("test"), Cookies(flags.Cookies{
+		Login: flags.CookiePolicy{NamePrefix: "__Host-", SameSite: "strict", MaxAge: time.Hour},
+	}))
+
+	sess := store.New(LoginCookieName)
+	sess.Set("sub", "abc123")
+
+	rec := httptest.NewRecorder()
+	assert.NoError(sess.Save(rec))
+
+	cookies := rec.Result().Cookies()
+	assert.Len(cookies, 1)
+	assert.Equal("__Host-proxy_login_session", cookies[0].Name)
+	assert.Equal("/", cookies[0].Path)
+	assert.Equal(3600, cookies[0].MaxAge)
+	assert.True(cookies[0].Secure)
+	assert.True(cookies[0].HttpOnly)
+	assert.Equal(http.SameSiteStrictMode, cookies[0].SameSite)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookies[0])
+
+	sess, err := store.Get(req, LoginCookieName)
+	assert.NoError(err)
+	assert.Equal("abc123", sess.Get("sub"))
+
+	rec = httptest.NewRecorder()
+	sess.Destroy(rec)
+
+	cookies = rec.Result().Cookies()
+	assert.Len(cookies, 1)
+	assert.Equal("__Host-proxy_login_session", cookies[0].Name)
+	assert.True(cookies[0].Secure)
+	assert.Equal(-1, cookies[0].MaxAge)
+}
+
+func TestCookieStore_Domain(t *testing.T) {
+	assert := require.New(t)
+
+	store := NewCookieStore([]byte("test"), Cookies(flags.Cookies{
+		Login: flags.CookiePolicy{Domain: "docs.example.com"},
+	}))
+
+	rec := httptest.NewRecorder()
+	store.Destroy(rec, LoginCookieName)
+
+	cookies := rec.Result().Cookies()
+	assert.Len(cookies, 1)
+	assert.Equal("docs.example.com", cookies[0].Domain)
+}
+
+func TestCookieStore_Expired(t *testing.T) {
+	assert := require.New(t)
+
+	store := NewCookieStore([]byte("test"), Cookies(flags.Cookies{
+		Auth: flags.CookiePolicy{MaxAge: time.Second},
+	}))
+
+	sess := store.New(AuthCookieName)
+	sess.Set("state", "abc")
+
+	rec := httptest.NewRecorder()
+	assert.NoError(sess.Save(rec))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(rec.Result().Cookies()[0])
+
+	time.Sleep(2100 * time.Millisecond)
+
+	_, err := store.Get(req, AuthCookieName)
+	assert.Error(err)
+}
@@ -0,0 +1,55 @@
+package ticket
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+const name = "proxy_sso_ticket"
+
+// ErrInvalidTicket returned when a ticket fails verification or has expired
+var ErrInvalidTicket = errors.New("invalid ticket")
+
+// Ticket a short lived assertion of the user's identity issued by the central auth host
+type Ticket struct {
+	Sub      string                 `json:"sub"`
+	Email    string                 `json:"email"`
+	Issuer   string                 `json:"iss,omitempty"`
+	AuthTime int64                  `json:"auth_time,omitempty"`
+	Claims   map[string]interface{} `json:"claims,omitempty"`
+	State    string                 `json:"state"`
+	Audience string                 `json:"aud"`
+}
+
+// Codec signs and verifies tickets using a secret shared by all the sites
+type Codec struct {
+	sc *securecookie.SecureCookie
+}
+
+// NewCodec create a new ticket codec, tickets are only valid for the duration of the ttl
+func NewCodec(secret []byte, ttl time.Duration) *Codec {
+	sc := securecookie.New(secret, nil)
+	sc.MaxAge(int(ttl.Seconds()))
+	sc.SetSerializer(securecookie.JSONEncoder{})
+
+	return &Codec{sc: sc}
+}
+
+// Encode sign the ticket returning a URL safe value
+func (tc *Codec) Encode(t *Ticket) (string, error) {
+	return tc.sc.Encode(name, t)
+}
+
+// Decode verify the value returning the ticket it contains
+func (tc *Codec) Decode(value string) (*Ticket, error) {
+	t := new(Ticket)
+
+	err := tc.sc.Decode(name, value, t)
+	if err != nil {
+		return nil, ErrInvalidTicket
+	}
+
+	return t, nil
+}
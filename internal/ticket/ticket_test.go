@@ -0,0 +1,24 @@
+package ticket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodec(t *testing.T) {
+	assert := require.New(t)
+
+	codec := NewCodec([]byte("test"), time.Minute)
+
+	val, err := codec.Encode(&Ticket{Sub: "abc123", Email: "mark@wolfe.id.au", State: "xyz", Audience: "site.example.com"})
+	assert.NoError(err)
+
+	tkt, err := codec.Decode(val)
+	assert.NoError(err)
+	assert.Equal(&Ticket{Sub: "abc123", Email: "mark@wolfe.id.au", State: "xyz", Audience: "site.example.com"}, tkt)
+
+	_, err = NewCodec([]byte("other"), time.Minute).Decode(val)
+	assert.ErrorIs(err, ErrInvalidTicket)
+}
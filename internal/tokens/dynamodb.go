@@ -0,0 +1,142 @@
+package tokens
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// DynamoDBStore keeps tokens in a DynamoDB table so they are shared by all instances of the service.
+//
+// The table requires a string partition key named "id", the "expires" attribute can be used as the TTL attribute
+// to remove expired tokens. Listing tokens scans the table, which is fine for the number of tokens people create.
+type DynamoDBStore struct {
+	dynamosvc dynamodbiface.DynamoDBAPI
+	table     string
+}
+
+// NewDynamoDBStore create a new store using the table
+func NewDynamoDBStore(awscfg *aws.Config, table string) *DynamoDBStore {
+	sess := session.Must(session.NewSession(awscfg))
+
+	return &DynamoDBStore{
+		dynamosvc: dynamodb.New(sess),
+		table:     table,
+	}
+}
+
+// Put stores the token
+func (ds *DynamoDBStore) Put(ctx context.Context, t *Token) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	_, err = ds.dynamosvc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(ds.table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"id":      {S: aws.String(t.ID)},
+			"sub":     {S: aws.String(t.Subject)},
+			"data":    {S: aws.String(string(data))},
+			"expires": {N: aws.String(strconv.FormatInt(t.ExpiresAt, 10))},
+		},
+	})
+
+	return err
+}
+
+// Get returns the token with the id
+func (ds *DynamoDBStore) Get(ctx context.Context, id string) (*Token, error) {
+	res, err := ds.dynamosvc.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(ds.table),
+		Key:            map[string]*dynamodb.AttributeValue{"id": {S: aws.String(id)}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Item == nil {
+		return nil, ErrNotFound
+	}
+
+	return decodeItem(res.Item)
+}
+
+// List returns the tokens of the subject, or all tokens when the subject is empty, oldest first
+func (ds *DynamoDBStore) List(ctx context.Context, subject string) ([]*Token, error) {
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(ds.table),
+	}
+
+	if subject != "" {
+		input.FilterExpression = aws.String("#s = :sub")
+		input.ExpressionAttributeNames = map[string]*string{"#s": aws.String("sub")}
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{":sub": {S: aws.String(subject)}}
+	}
+
+	var (
+		list    []*Token
+		itemErr error
+	)
+
+	err := ds.dynamosvc.ScanPagesWithContext(ctx, input, func(page *dynamodb.ScanOutput, last bool) bool {
+		for _, item := range page.Items {
+			t, err := decodeItem(item)
+			if err != nil {
+				itemErr = err
+				return false
+			}
+
+			list = append(list, t)
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if itemErr != nil {
+		return nil, itemErr
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt < list[j].CreatedAt
+	})
+
+	return list, nil
+}
+
+// Delete removes the token
+func (ds *DynamoDBStore) Delete(ctx context.Context, id string) error {
+	_, err := ds.dynamosvc.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(ds.table),
+		Key:       map[string]*dynamodb.AttributeValue{"id": {S: aws.String(id)}},
+	})
+
+	return err
+}
+
+func decodeItem(item map[string]*dynamodb.AttributeValue) (*Token, error) {
+	data, ok := item["data"]
+	if !ok {
+		return nil, errors.New("token item is missing data")
+	}
+
+	t := new(Token)
+
+	err := json.Unmarshal([]byte(aws.StringValue(data.S)), t)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
@@ -0,0 +1,78 @@
+package tokens
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps tokens in memory, they are only available to the process which created them and are lost
+// when it exits so this is intended for development.
+type MemoryStore struct {
+	mu     sync.Mutex
+	tokens map[string]*Token
+}
+
+// NewMemoryStore create a new in memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tokens: make(map[string]*Token)}
+}
+
+// Put stores the token
+func (ms *MemoryStore) Put(ctx context.Context, t *Token) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	cp := *t
+	ms.tokens[t.ID] = &cp
+
+	return nil
+}
+
+// Get returns the token with the id
+func (ms *MemoryStore) Get(ctx context.Context, id string) (*Token, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	t, ok := ms.tokens[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	cp := *t
+
+	return &cp, nil
+}
+
+// List returns the tokens of the subject, or all tokens when the subject is empty, oldest first
+func (ms *MemoryStore) List(ctx context.Context, subject string) ([]*Token, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var list []*Token
+
+	for _, t := range ms.tokens {
+		if subject != "" && t.Subject != subject {
+			continue
+		}
+
+		cp := *t
+		list = append(list, &cp)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt < list[j].CreatedAt
+	})
+
+	return list, nil
+}
+
+// Delete removes the token
+func (ms *MemoryStore) Delete(ctx context.Context, id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.tokens, id)
+
+	return nil
+}
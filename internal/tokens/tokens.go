@@ -0,0 +1,125 @@
+package tokens
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/wolfeidau/website-openid-proxy/internal/pathmatch"
+)
+
+// Prefix identifies personal access tokens so they can be told apart from other bearer tokens
+const Prefix = "pat_"
+
+const (
+	idLength     = 8
+	secretLength = 32
+)
+
+// ErrNotFound returned when the store doesn't contain the token
+var ErrNotFound = errors.New("token not found")
+
+// Token a personal access token which authenticates as the user who created it.
+//
+// Only a hash of the secret is stored, the token value is shown to the user once when it is created.
+type Token struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Subject string `json:"sub"`
+	Email   string `json:"email"`
+	Issuer  string `json:"iss,omitempty"`
+	// Claims copied from the session of the user when the token was created, these are used by policies and
+	// copied again each time the user logs in
+	Claims map[string]interface{} `json:"claims,omitempty"`
+	// ClaimsUpdatedAt when the claims were copied in seconds since the epoch
+	ClaimsUpdatedAt int64 `json:"claims_updated_at,omitempty"`
+	// Paths patterns the token is limited to, when empty the token can access any path the user can
+	Paths []string `json:"paths,omitempty"`
+	// CreatedAt and ExpiresAt in seconds since the epoch
+	CreatedAt int64 `json:"created_at"`
+	ExpiresAt int64 `json:"expires_at"`
+	// Hash of the secret part of the token
+	Hash string `json:"hash"`
+}
+
+// Store keeps personal access tokens
+type Store interface {
+	Put(ctx context.Context, t *Token) error
+	// Get returns ErrNotFound if the token doesn't exist
+	Get(ctx context.Context, id string) (*Token, error)
+	// List returns the tokens of the subject, or all tokens when the subject is empty
+	List(ctx context.Context, subject string) ([]*Token, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// New create a token valid for the ttl returning the value to give to the user
+func New(name string, paths []string, now time.Time, ttl time.Duration) (*Token, string, error) {
+	id := make([]byte, idLength)
+	secret := make([]byte, secretLength)
+
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+
+	t := &Token{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Paths:     paths,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+
+	value := base64.RawURLEncoding.EncodeToString(secret)
+	t.Hash = hash(value)
+
+	return t, Prefix + t.ID + "_" + value, nil
+}
+
+// IsToken reports whether the bearer token looks like a personal access token
+func IsToken(raw string) bool {
+	return strings.HasPrefix(raw, Prefix)
+}
+
+// Parse split a token value into the id and secret
+func Parse(raw string) (id, secret string, ok bool) {
+	if !IsToken(raw) {
+		return "", "", false
+	}
+
+	id, secret, ok = strings.Cut(raw[len(Prefix):], "_")
+	if !ok || len(id) != idLength*2 || secret == "" {
+		return "", "", false
+	}
+
+	return id, secret, true
+}
+
+// Verify reports whether the secret matches the token
+func (t *Token) Verify(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash(secret)), []byte(t.Hash)) == 1
+}
+
+// Expired returns true if the token has passed its expiry
+func (t *Token) Expired(now time.Time) bool {
+	return now.Unix() >= t.ExpiresAt
+}
+
+// Allows reports whether the token may be used to access the path
+func (t *Token) Allows(p string) bool {
+	return len(t.Paths) == 0 || pathmatch.MatchAny(t.Paths, p)
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,78 @@
+package tokens
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	assert := require.New(t)
+
+	now := time.Unix(1700000000, 0)
+
+	tok, value, err := New("deploy", []string{"/reports/**"}, now, time.Hour)
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(value, Prefix+tok.ID+"_"))
+	assert.NotContains(tok.Hash, strings.TrimPrefix(value, Prefix+tok.ID+"_"))
+	assert.Equal(now.Add(time.Hour).Unix(), tok.ExpiresAt)
+
+	id, secret, ok := Parse(value)
+	assert.True(ok)
+	assert.Equal(tok.ID, id)
+	assert.True(tok.Verify(secret))
+	assert.False(tok.Verify(secret + "x"))
+
+	assert.False(tok.Expired(now))
+	assert.True(tok.Expired(now.Add(time.Hour)))
+
+	assert.True(tok.Allows("/reports/2023/summary.pdf"))
+	assert.False(tok.Allows("/admin/users.csv"))
+	assert.True((&Token{}).Allows("/admin/users.csv"))
+}
+
+func TestParse(t *testing.T) {
+	assert := require.New(t)
+
+	for _, raw := range []string{"", "eyJhbGciOi.abc.def", "pat_", "pat_0123456789abcdef", "pat_0123456789abcdef_", "pat_abc_secret"} {
+		_, _, ok := Parse(raw)
+		assert.False(ok, raw)
+	}
+
+	id, secret, ok := Parse("pat_0123456789abcdef_c2VjcmV0_x")
+	assert.True(ok)
+	assert.Equal("0123456789abcdef", id)
+	assert.Equal("c2VjcmV0_x", secret)
+}
+
+func TestMemoryStore(t *testing.T) {
+	assert := require.New(t)
+
+	ctx := context.TODO()
+	store := NewMemoryStore()
+
+	assert.NoError(store.Put(ctx, &Token{ID: "b", Subject: "abc123", CreatedAt: 2}))
+	assert.NoError(store.Put(ctx, &Token{ID: "a", Subject: "abc123", CreatedAt: 1}))
+	assert.NoError(store.Put(ctx, &Token{ID: "c", Subject: "def456", CreatedAt: 3}))
+
+	list, err := store.List(ctx, "abc123")
+	assert.NoError(err)
+	assert.Len(list, 2)
+	assert.Equal("a", list[0].ID)
+
+	list, err = store.List(ctx, "")
+	assert.NoError(err)
+	assert.Len(list, 3)
+
+	assert.NoError(store.Delete(ctx, "a"))
+
+	_, err = store.Get(ctx, "a")
+	assert.ErrorIs(err, ErrNotFound)
+
+	got, err := store.Get(ctx, "b")
+	assert.NoError(err)
+	assert.Equal("abc123", got.Subject)
+}